@@ -0,0 +1,172 @@
+// Command ssl-import hands existing certificates to a running ssl-manager.
+//
+//	ssl-import -token $TOKEN -cert cert.pem -key key.pem [-chain chain.pem]
+//	ssl-import -token $TOKEN -certbot /etc/letsencrypt/live
+//
+// -certbot takes either one live/<name> directory or live/ itself, in which
+// case every certificate below it is imported.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	clients "ssl-manager/internal/clients"
+	models "ssl-manager/internal/models"
+	"strings"
+	"time"
+)
+
+func main() {
+	var (
+		apiURL    = flag.String("url", "http://localhost:8080", "ssl-manager base URL")
+		token     = flag.String("token", os.Getenv("SSL_MANAGER_TOKEN"), "API bearer token")
+		certPath  = flag.String("cert", "", "PEM certificate, may include the chain")
+		keyPath   = flag.String("key", "", "PEM private key")
+		chainPath = flag.String("chain", "", "PEM intermediates or full chain")
+		certbot   = flag.String("certbot", "", "certbot live/ or live/<name> directory")
+		domain    = flag.String("domain", "", "primary name, defaults to the first name in the certificate")
+		ca        = flag.String("ca", "", "CA used for renewals, defaults to the configured default")
+		method    = flag.String("method", "", "verification method used for renewals")
+		autoRenew = flag.Bool("auto-renew", false, "renew the imported certificates through ACME")
+	)
+	flag.Parse()
+
+	if *token == "" {
+		log.Fatal("missing -token or SSL_MANAGER_TOKEN")
+	}
+
+	base := models.ImportCertificateReq{
+		Domain:             *domain,
+		CA:                 *ca,
+		VerificationMethod: *method,
+		AutoRenew:          *autoRenew,
+	}
+
+	var reqs []models.ImportCertificateReq
+	switch {
+	case *certbot != "":
+		dirs, err := certbotDirs(*certbot)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(dirs) > 1 && *domain != "" {
+			log.Fatal("-domain can only be used when importing a single certificate")
+		}
+		for _, dir := range dirs {
+			cert, key, chain, err := clients.ReadCertbotLive(dir)
+			if err != nil {
+				log.Fatal(err)
+			}
+			reqs = append(reqs, withPEM(base, cert, key, chain))
+		}
+	case *certPath != "" && *keyPath != "":
+		cert, key, chain, err := readFiles(*certPath, *keyPath, *chainPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		reqs = append(reqs, withPEM(base, cert, key, chain))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	failed := 0
+	for _, req := range reqs {
+		domainID, err := importCertificate(httpClient, *apiURL, *token, req)
+		if err != nil {
+			log.Print("import failed: ", err)
+			failed++
+			continue
+		}
+		fmt.Println("imported", domainID)
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d of %d imports failed", failed, len(reqs))
+	}
+}
+
+// certbotDirs resolves -certbot to the live/<name> directories to import.
+func certbotDirs(path string) ([]string, error) {
+	if _, err := os.Stat(filepath.Join(path, "cert.pem")); err == nil {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for _, entry := range entries {
+		dir := filepath.Join(path, entry.Name())
+		if _, err := os.Stat(filepath.Join(dir, "cert.pem")); err == nil {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("no certbot certificates found in %s", path)
+	}
+	return dirs, nil
+}
+
+func readFiles(certPath, keyPath, chainPath string) (cert, key, chain []byte, err error) {
+	if cert, err = os.ReadFile(certPath); err != nil {
+		return nil, nil, nil, err
+	}
+	if key, err = os.ReadFile(keyPath); err != nil {
+		return nil, nil, nil, err
+	}
+	if chainPath != "" {
+		if chain, err = os.ReadFile(chainPath); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return cert, key, chain, nil
+}
+
+func withPEM(req models.ImportCertificateReq, cert, key, chain []byte) models.ImportCertificateReq {
+	req.Cert, req.Key, req.Chain = string(cert), string(key), string(chain)
+	return req
+}
+
+func importCertificate(httpClient *http.Client, apiURL, token string, req models.ImportCertificateReq) (string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(apiURL, "/")+"/api/v1/domains/import", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var result struct {
+		DomainID string `json:"domain_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return result.DomainID, nil
+}
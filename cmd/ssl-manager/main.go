@@ -1,16 +1,24 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
 	routes "ssl-manager/internal/api/routes"
 	clients "ssl-manager/internal/clients"
+	deployers "ssl-manager/internal/deployers"
+	docker "ssl-manager/internal/docker"
+	envelope "ssl-manager/internal/envelope"
+	kube "ssl-manager/internal/kube"
 	repositories "ssl-manager/internal/repositories"
+	sds "ssl-manager/internal/sds"
 	services "ssl-manager/internal/services"
+	storage "ssl-manager/internal/storage"
 	utils "ssl-manager/internal/utils"
 
 	"github.com/joho/godotenv"
+	"k8s.io/client-go/kubernetes"
 )
 
 func main() {
@@ -41,24 +49,75 @@ func main() {
 	}
 	log.Info("Migrations applied successfully")
 
+	// certificate storage
+	store, err := storage.New(cfg, repo.DB, log)
+	if err != nil {
+		log.Fatal("Error creating certificate storage: ", err)
+	}
+	log.Info("Certificate storage created successful")
+
+	// private key encryption, nil when not configured
+	sealer, err := envelope.New(cfg)
+	if err != nil {
+		log.Fatal("Error creating key encryption: ", err)
+	}
+
 	// creating clients for external apis
-	clients, err := clients.NewClient(log, cfg)
+	clients, err := clients.NewClient(log, cfg, store, sealer)
 	if err != nil {
 		log.Fatal("Error creating clients: ", err)
 	}
 	log.Info("Clients created successful")
 
+	// deploy targets
+	dockerClient := docker.NewClient(cfg.Docker.Socket)
+	var kubeClient kubernetes.Interface
+	if cfg.Kubernetes.Enabled {
+		kubeClient, err = kube.NewClientset(cfg.Kubernetes.Kubeconfig)
+		if err != nil {
+			log.Fatal("Error creating kubernetes client: ", err)
+		}
+	}
+	var sdsServer *sds.Server
+	if cfg.Envoy.SDS.Listen != "" {
+		sdsServer = sds.NewServer(log)
+	}
+	deployerBuilder, err := deployers.NewBuilder(dockerClient, kubeClient, sdsServer, cfg.Deployers)
+	if err != nil {
+		log.Fatal("Error creating deployers: ", err)
+	}
+
 	// creating service
-	service, err := services.NewService(cfg, clients, repo, log)
+	service, err := services.NewService(cfg, clients, deployerBuilder, repo, log)
 	if err != nil {
 		log.Fatal("Error creating service: ", err)
 	}
 	log.Info("Service created successful")
 
+	// serving certificates to envoy
+	if sdsServer != nil {
+		service.StartSDSRefresh(cfg.Envoy.SDS.RefreshInterval)
+		go func() {
+			if err := sdsServer.ListenAndServe(context.Background(), cfg.Envoy.SDS); err != nil {
+				log.Fatal("Error starting envoy sds: ", err)
+			}
+		}()
+	}
+
 	// starting scheduler
 	service.StartCertificateRenewalScheduler()
 	log.Info("Certificate renewal scheduler started")
 
+	// registering domains from container labels
+	if cfg.Discovery.Docker.Enabled {
+		service.StartDockerDiscovery(dockerClient)
+		log.Info("Docker discovery started")
+	}
+	if cfg.Discovery.Kubernetes.Enabled {
+		service.StartIngressDiscovery(kubeClient)
+		log.Info("Ingress discovery started")
+	}
+
 	// creating routes
 	router, err := routes.CreateRoutes(service, cfg, log)
 	if err != nil {
@@ -66,6 +125,20 @@ func main() {
 	}
 	log.Info("Routes created successful")
 
+	// starting separate http-01 listener
+	if cfg.Certs.HTTP01.ListenAddr != "" {
+		challengeRouter, err := routes.CreateChallengeRoutes(service, cfg, log)
+		if err != nil {
+			log.Fatal("Error creating challenge routes: ", err)
+		}
+		go func() {
+			log.Info("Starting http-01 responder on ", cfg.Certs.HTTP01.ListenAddr)
+			if err := http.ListenAndServe(cfg.Certs.HTTP01.ListenAddr, challengeRouter); err != nil {
+				log.Fatal("Error starting http-01 responder: ", err)
+			}
+		}()
+	}
+
 	// starting http server
 	log.Info("Starting the server on port ", cfg.Server.Port)
 	if err := http.ListenAndServe(":"+cfg.Server.Port, router); err != nil {
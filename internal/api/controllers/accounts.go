@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	clients "ssl-manager/internal/clients"
+	models "ssl-manager/internal/models"
+)
+
+func (c *Controller) HandleGetACMEAccounts() http.HandlerFunc {
+	return c.withAuth(func(w http.ResponseWriter, r *http.Request, token string, userid string) {
+		accounts, err := c.Service.GetACMEAccounts()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, accounts)
+	})
+}
+
+func (c *Controller) HandleRegisterACMEAccount() http.HandlerFunc {
+	return c.withAuth(func(w http.ResponseWriter, r *http.Request, token string, userid string) {
+		var req models.RegisterACMEAccountReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.UserID = userid
+
+		accountID, err := c.Service.RegisterACMEAccount(req)
+		if err != nil {
+			http.Error(w, err.Error(), accountErrorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Account registered successfully", "account_id": accountID})
+	})
+}
+
+func (c *Controller) HandleUpdateACMEAccount() http.HandlerFunc {
+	return c.withAuth(func(w http.ResponseWriter, r *http.Request, token string, userid string) {
+		var req models.UpdateACMEAccountReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.AccountID = r.PathValue("id")
+		req.UserID = userid
+
+		if err := c.Service.UpdateACMEAccount(req); err != nil {
+			http.Error(w, err.Error(), accountErrorStatus(err))
+			return
+		}
+
+		writeJSON(w, map[string]string{"message": "Account updated successfully"})
+	})
+}
+
+func (c *Controller) HandleRolloverACMEAccountKey() http.HandlerFunc {
+	return c.withAuth(func(w http.ResponseWriter, r *http.Request, token string, userid string) {
+		req := models.ACMEAccountActionReq{
+			AccountID: r.PathValue("id"),
+			UserID:    userid,
+		}
+
+		if err := c.Service.RolloverACMEAccountKey(req); err != nil {
+			http.Error(w, err.Error(), accountErrorStatus(err))
+			return
+		}
+
+		writeJSON(w, map[string]string{"message": "Account key rotated successfully"})
+	})
+}
+
+func (c *Controller) HandleDeactivateACMEAccount() http.HandlerFunc {
+	return c.withAuth(func(w http.ResponseWriter, r *http.Request, token string, userid string) {
+		req := models.ACMEAccountActionReq{
+			AccountID: r.PathValue("id"),
+			UserID:    userid,
+		}
+
+		if err := c.Service.DeactivateACMEAccount(req); err != nil {
+			http.Error(w, err.Error(), accountErrorStatus(err))
+			return
+		}
+
+		writeJSON(w, map[string]string{"message": "Account deactivated successfully"})
+	})
+}
+
+func accountErrorStatus(err error) int {
+	var eabErr *clients.EABError
+	switch {
+	case errors.Is(err, models.ErrAccountNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, clients.ErrEABRequired), errors.As(err, &eabErr):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+)
+
+const acmeChallengePrefix = "/.well-known/acme-challenge/"
+
+// HandleACMEChallenge answers http-01 validation requests from the CA, so it
+// is deliberately not wrapped in withAuth.
+func (c *Controller) HandleACMEChallenge() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.URL.Path, acmeChallengePrefix)
+		if token == "" || strings.Contains(token, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		keyAuth, err := c.Service.GetHTTP01Response(token)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(keyAuth))
+	}
+}
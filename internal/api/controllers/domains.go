@@ -2,11 +2,17 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	models "ssl-manager/internal/models"
 	utils "ssl-manager/internal/utils"
 )
 
+// revocationReasonCessationOfOperation is the RFC 5280 reason sent when a
+// certificate is revoked because its domain is deleted.
+const revocationReasonCessationOfOperation = 5
+
 func (c *Controller) HandleGetDomains() http.HandlerFunc {
 	return c.withAuth(func(w http.ResponseWriter, r *http.Request, token string, userid string) {
 		query := r.URL.Query()
@@ -47,6 +53,34 @@ func (c *Controller) HandleCreateDomain() http.HandlerFunc {
 	})
 }
 
+func (c *Controller) HandleImportCertificate() http.HandlerFunc {
+	return c.withAuth(func(w http.ResponseWriter, r *http.Request, token string, userid string) {
+		var req models.ImportCertificateReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Cert == "" || req.Key == "" {
+			http.Error(w, "missing cert or key", http.StatusBadRequest)
+			return
+		}
+		req.CreatedBy = userid
+
+		domainID, err := c.Service.ImportCertificate(req)
+		if errors.Is(err, models.ErrDomainExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Certificate imported successfully", "domain_id": domainID})
+	})
+}
+
 func (c *Controller) HandleDeleteDomain() http.HandlerFunc {
 	return c.withAuth(func(w http.ResponseWriter, r *http.Request, token string, userid string) {
 		query := r.URL.Query()
@@ -63,8 +97,15 @@ func (c *Controller) HandleDeleteDomain() http.HandlerFunc {
 		if domName != "" {
 			filters.DomainName = domName
 		}
+		filters.Revoke = query.Get("revoke") == "true"
+		filters.RevocationReason = utils.GetDefaultIntegerQueryValue(query, "reason", revocationReasonCessationOfOperation)
 		filters.UserID = userid
 
+		if filters.Revoke && !utils.IsValidRevocationReason(filters.RevocationReason) {
+			http.Error(w, "invalid revocation reason", http.StatusBadRequest)
+			return
+		}
+
 		err := c.Service.DeleteDomain(filters)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -75,3 +116,72 @@ func (c *Controller) HandleDeleteDomain() http.HandlerFunc {
 		json.NewEncoder(w).Encode(map[string]string{"message": "Domain deleted successfully"})
 	})
 }
+
+// HandleExportCertificate serves the current certificate of a domain. The
+// PKCS#12 password comes in the X-Export-Password header to keep it out of
+// access logs.
+func (c *Controller) HandleExportCertificate() http.HandlerFunc {
+	return c.withAuth(func(w http.ResponseWriter, r *http.Request, token string, userid string) {
+		req := models.ExportCertificateReq{
+			DomainID: r.PathValue("id"),
+			Format:   utils.GetDefaultQueryValue(r.URL.Query(), "format", utils.ExportFormatPEM),
+			Password: r.Header.Get("X-Export-Password"),
+			UserID:   userid,
+		}
+		if !utils.IsValidExportFormat(req.Format) {
+			http.Error(w, "unsupported export format", http.StatusBadRequest)
+			return
+		}
+		if (req.Format == utils.ExportFormatPKCS12 || req.Format == utils.ExportFormatPKCS12Legacy) && req.Password == "" {
+			http.Error(w, "missing X-Export-Password header", http.StatusBadRequest)
+			return
+		}
+
+		export, err := c.Service.GetCertificateExport(req)
+		if errors.Is(err, models.ErrDomainNotFound) || errors.Is(err, models.ErrCertificateNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", export.ContentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.FileName))
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(export.Data)
+	})
+}
+
+func (c *Controller) HandleRevokeCertificate() http.HandlerFunc {
+	return c.withAuth(func(w http.ResponseWriter, r *http.Request, token string, userid string) {
+		var req models.RevokeCertificateReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !utils.IsValidRevocationReason(req.Reason) {
+			http.Error(w, "invalid revocation reason", http.StatusBadRequest)
+			return
+		}
+		req.DomainID = r.PathValue("id")
+		req.CertificateID = r.PathValue("certId")
+		req.UserID = userid
+
+		err := c.Service.RevokeCertificate(req)
+		switch {
+		case errors.Is(err, models.ErrDomainNotFound), errors.Is(err, models.ErrCertificateNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, models.ErrCertificateRevoked):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, map[string]string{"message": "Certificate revoked successfully"})
+	})
+}
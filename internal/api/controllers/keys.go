@@ -0,0 +1,22 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	envelope "ssl-manager/internal/envelope"
+)
+
+func (c *Controller) HandleRotateKeyEncryptionKey() http.HandlerFunc {
+	return c.withAuth(func(w http.ResponseWriter, r *http.Request, token string, userid string) {
+		resp, err := c.Service.RotateKeyEncryptionKey()
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, envelope.ErrNoKEK) {
+				status = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		writeJSON(w, resp)
+	})
+}
@@ -31,5 +31,108 @@ func CreateRoutes(service services.ServiceInterface, cfg *utils.Config, log *uti
 		}
 	})
 
+	mux.HandleFunc("/api/v1/domains/import", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			domains.HandleImportCertificate()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/domains/{id}/certificate", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			domains.HandleExportCertificate()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/domains/{id}/certificates/{certId}/revoke", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			domains.HandleRevokeCertificate()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/accounts", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			domains.HandleGetACMEAccounts()(w, r)
+		case http.MethodPost:
+			domains.HandleRegisterACMEAccount()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/accounts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPatch:
+			domains.HandleUpdateACMEAccount()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/accounts/{id}/key-change", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			domains.HandleRolloverACMEAccountKey()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/accounts/{id}/deactivate", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			domains.HandleDeactivateACMEAccount()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/keys/rotate", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			domains.HandleRotateKeyEncryptionKey()(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/.well-known/acme-challenge/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		domains.HandleACMEChallenge()(w, r)
+	})
+
+	return mux, nil
+}
+
+// CreateChallengeRoutes serves only the http-01 responder, for running it on
+// its own listener (usually :80) next to the API.
+func CreateChallengeRoutes(service services.ServiceInterface, cfg *utils.Config, log *utils.Logger) (http.Handler, error) {
+	if service == nil {
+		return nil, errors.New("service is nil")
+	}
+
+	challenges := controllers.NewController(service, cfg, log)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/acme-challenge/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		challenges.HandleACMEChallenge()(w, r)
+	})
+
 	return mux, nil
 }
@@ -0,0 +1,183 @@
+// Package certificates holds the certificate material of a domain: the leaf,
+// its intermediates and, unless the certificate was issued for a supplied
+// CSR, the private key. Everything written to disk goes through it.
+package certificates
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoCertificate = errors.New("no certificate found")
+	ErrKeyMismatch   = errors.New("private key does not match the certificate")
+)
+
+type Material struct {
+	Leaf          *x509.Certificate
+	Intermediates []*x509.Certificate
+	Key           crypto.Signer // nil for certificates issued for a supplied csr
+}
+
+// FromDER builds material from a chain as returned by the CA, leaf first.
+func FromDER(chain [][]byte, key crypto.Signer) (*Material, error) {
+	certs := make([]*x509.Certificate, 0, len(chain))
+	for _, der := range chain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	return newMaterial(certs, key)
+}
+
+// Parse builds material from PEM. certPEM starts with the leaf and may carry
+// the intermediates itself; chainPEM may hold the intermediates or the full
+// chain. keyPEM may be empty.
+func Parse(certPEM, keyPEM, chainPEM []byte) (*Material, error) {
+	certs, err := ParseCertificates(append(append([]byte{}, certPEM...), chainPEM...))
+	if err != nil {
+		return nil, err
+	}
+
+	var key crypto.Signer
+	if len(keyPEM) > 0 {
+		key, err = ParsePrivateKey(keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+	}
+
+	return newMaterial(certs, key)
+}
+
+func newMaterial(certs []*x509.Certificate, key crypto.Signer) (*Material, error) {
+	certs = uniqueCertificates(certs)
+	if len(certs) == 0 {
+		return nil, ErrNoCertificate
+	}
+
+	m := &Material{Leaf: certs[0], Intermediates: certs[1:], Key: key}
+	if key != nil && !KeyMatches(key, m.Leaf) {
+		return nil, ErrKeyMismatch
+	}
+	return m, nil
+}
+
+// KeyMatches reports whether key is the private key of cert.
+func KeyMatches(key crypto.Signer, cert *x509.Certificate) bool {
+	pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && pub.Equal(cert.PublicKey)
+}
+
+// Verify builds a chain from the leaf through the intermediates to one of
+// roots, as of at. A nil roots uses the system pool.
+func (m *Material) Verify(roots *x509.CertPool, at time.Time) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range m.Intermediates {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := m.Leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("certificate chain does not verify: %w", err)
+	}
+	return nil
+}
+
+// Names lists the DNS names of the leaf, falling back to the common name for
+// certificates without SANs.
+func (m *Material) Names() []string {
+	names := make([]string, 0, len(m.Leaf.DNSNames)+1)
+	seen := map[string]bool{}
+	for _, name := range m.Leaf.DNSNames {
+		name = strings.ToLower(name)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if cn := strings.ToLower(m.Leaf.Subject.CommonName); cn != "" && !seen[cn] {
+		names = append(names, cn)
+	}
+	return names
+}
+
+// Covers checks that the leaf is valid for every one of names.
+func (m *Material) Covers(names []string) error {
+	var missing []string
+	for _, name := range names {
+		if !containsFold(m.Leaf.DNSNames, name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("certificate does not cover %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// CertPEM is the leaf alone.
+func (m *Material) CertPEM() []byte {
+	return EncodeCertificates([][]byte{m.Leaf.Raw})
+}
+
+// ChainPEM is the intermediates without the leaf.
+func (m *Material) ChainPEM() []byte {
+	ders := make([][]byte, 0, len(m.Intermediates))
+	for _, cert := range m.Intermediates {
+		ders = append(ders, cert.Raw)
+	}
+	return EncodeCertificates(ders)
+}
+
+// FullchainPEM is the leaf followed by the intermediates.
+func (m *Material) FullchainPEM() []byte {
+	return append(m.CertPEM(), m.ChainPEM()...)
+}
+
+// KeyPEM encodes the private key, or returns nil when there is none.
+func (m *Material) KeyPEM() ([]byte, error) {
+	if m.Key == nil {
+		return nil, nil
+	}
+	return EncodePrivateKey(m.Key)
+}
+
+func uniqueCertificates(certs []*x509.Certificate) []*x509.Certificate {
+	unique := make([]*x509.Certificate, 0, len(certs))
+	for _, cert := range certs {
+		duplicate := false
+		for _, seen := range unique {
+			if seen.Equal(cert) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			unique = append(unique, cert)
+		}
+	}
+	return unique
+}
+
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+package certificates
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// fixture is a locally generated root, intermediate and leaf for
+// example.com, www.example.com and *.example.com.
+type fixture struct {
+	root, intermediate, leaf *x509.Certificate
+	leafKey                  crypto.Signer
+	roots                    *x509.CertPool
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	now := time.Now()
+
+	rootKey := newKey(t)
+	root := issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+	}, nil, rootKey, rootKey)
+
+	intermediateKey := newKey(t)
+	intermediate := issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test Intermediate"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+	}, root, intermediateKey, rootKey)
+
+	leafKey := newKey(t)
+	leaf := issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "example.com"},
+		DNSNames:    []string{"example.com", "www.example.com", "*.example.com"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.Add(12 * time.Hour),
+	}, intermediate, leafKey, intermediateKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	return &fixture{root: root, intermediate: intermediate, leaf: leaf, leafKey: leafKey, roots: roots}
+}
+
+func newKey(t *testing.T) crypto.Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+var serial int64
+
+// issue signs template with signerKey as parent, or self-signs it when
+// parent is nil.
+func issue(t *testing.T, template, parent *x509.Certificate, key, signerKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+	serial++
+	template.SerialNumber = big.NewInt(serial)
+	if parent == nil {
+		parent = template
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func (f *fixture) pem(t *testing.T) (leaf, intermediate, key []byte) {
+	t.Helper()
+	key, err := EncodePrivateKey(f.leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return EncodeCertificates([][]byte{f.leaf.Raw}), EncodeCertificates([][]byte{f.intermediate.Raw}), key
+}
+
+func TestParse(t *testing.T) {
+	f := newFixture(t)
+	leafPEM, intermediatePEM, keyPEM := f.pem(t)
+	fullchain := append(append([]byte{}, leafPEM...), intermediatePEM...)
+
+	tests := []struct {
+		name           string
+		cert, chain    []byte
+		intermediates  int
+		intermediateCN string
+	}{
+		{"chain separate", leafPEM, intermediatePEM, 1, "Test Intermediate"},
+		{"chain in cert", fullchain, nil, 1, "Test Intermediate"},
+		{"chain in both", fullchain, intermediatePEM, 1, "Test Intermediate"},
+		{"full chain as chain", leafPEM, fullchain, 1, "Test Intermediate"},
+		{"leaf only", leafPEM, nil, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(tt.cert, keyPEM, tt.chain)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !m.Leaf.Equal(f.leaf) {
+				t.Errorf("leaf is %s", m.Leaf.Subject.CommonName)
+			}
+			if len(m.Intermediates) != tt.intermediates {
+				t.Fatalf("got %d intermediates, want %d", len(m.Intermediates), tt.intermediates)
+			}
+			if tt.intermediates > 0 && m.Intermediates[0].Subject.CommonName != tt.intermediateCN {
+				t.Errorf("intermediate is %s", m.Intermediates[0].Subject.CommonName)
+			}
+		})
+	}
+
+	if _, err := Parse(nil, keyPEM, nil); !errors.Is(err, ErrNoCertificate) {
+		t.Errorf("Parse without certificate: got %v, want %v", err, ErrNoCertificate)
+	}
+}
+
+func TestParseKeyMismatch(t *testing.T) {
+	f := newFixture(t)
+	leafPEM, intermediatePEM, _ := f.pem(t)
+	otherKey, err := EncodePrivateKey(newKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Parse(leafPEM, otherKey, intermediatePEM); !errors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("got %v, want %v", err, ErrKeyMismatch)
+	}
+	// supplied csrs leave no key
+	m, err := Parse(leafPEM, nil, intermediatePEM)
+	if err != nil {
+		t.Fatalf("Parse without key: %v", err)
+	}
+	if m.Key != nil {
+		t.Error("material has a key")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	f := newFixture(t)
+	leafPEM, intermediatePEM, keyPEM := f.pem(t)
+	other := newFixture(t)
+
+	tests := []struct {
+		name    string
+		chain   []byte
+		roots   *x509.CertPool
+		at      time.Time
+		wantErr bool
+	}{
+		{"fixture roots", intermediatePEM, f.roots, time.Now(), false},
+		{"wrong roots", intermediatePEM, other.roots, time.Now(), true},
+		{"missing intermediate", nil, f.roots, time.Now(), true},
+		{"expired", intermediatePEM, f.roots, time.Now().Add(13 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(leafPEM, keyPEM, tt.chain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Verify(tt.roots, tt.at); (err != nil) != tt.wantErr {
+				t.Errorf("Verify: got %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCovers(t *testing.T) {
+	f := newFixture(t)
+	m := &Material{Leaf: f.leaf}
+
+	tests := []struct {
+		name    string
+		names   []string
+		wantErr bool
+	}{
+		{"domain", []string{"example.com"}, false},
+		{"sans", []string{"example.com", "www.example.com"}, false},
+		{"case insensitive", []string{"WWW.Example.com"}, false},
+		{"wildcard", []string{"*.example.com"}, false},
+		// names are matched as listed, a wildcard domain is only covered by
+		// the wildcard itself
+		{"name under wildcard", []string{"api.example.com"}, true},
+		{"other wildcard", []string{"*.www.example.com"}, true},
+		{"one missing", []string{"example.com", "example.org"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := m.Covers(tt.names); (err != nil) != tt.wantErr {
+				t.Errorf("Covers(%v): got %v, want error %v", tt.names, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPEMRoundTrip(t *testing.T) {
+	f := newFixture(t)
+	leafPEM, intermediatePEM, keyPEM := f.pem(t)
+	m, err := Parse(leafPEM, keyPEM, intermediatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := m.KeyPEM()
+	if err != nil {
+		t.Fatalf("KeyPEM: %v", err)
+	}
+	again, err := Parse(m.FullchainPEM(), key, nil)
+	if err != nil {
+		t.Fatalf("Parse of FullchainPEM and KeyPEM: %v", err)
+	}
+	if !again.Leaf.Equal(f.leaf) || len(again.Intermediates) != 1 || !again.Intermediates[0].Equal(f.intermediate) {
+		t.Error("chain changed in the round trip")
+	}
+	if !KeyMatches(again.Key, f.leaf) {
+		t.Error("key changed in the round trip")
+	}
+	if !bytes.Equal(again.CertPEM(), leafPEM) || !bytes.Equal(again.ChainPEM(), intermediatePEM) {
+		t.Error("CertPEM or ChainPEM differ from the input")
+	}
+	if err := again.Verify(f.roots, time.Now()); err != nil {
+		t.Errorf("round trip no longer verifies: %v", err)
+	}
+
+	noKey := &Material{Leaf: f.leaf}
+	if key, err := noKey.KeyPEM(); key != nil || err != nil {
+		t.Errorf("KeyPEM without key: got %q, %v", key, err)
+	}
+}
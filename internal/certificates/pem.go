@@ -0,0 +1,105 @@
+package certificates
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// EncodeCertificates PEM-encodes DER certificates in order.
+func EncodeCertificates(ders [][]byte) []byte {
+	result := []byte{}
+	for _, der := range ders {
+		result = append(result, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	return result
+}
+
+// ParseCertificates reads every CERTIFICATE block of data, skipping other
+// block types.
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+}
+
+func EncodePrivateKey(key crypto.PrivateKey) ([]byte, error) {
+	var (
+		privBytes []byte
+		err       error
+		blockType string
+	)
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		privBytes = x509.MarshalPKCS1PrivateKey(k)
+		blockType = "RSA PRIVATE KEY"
+
+	case *ecdsa.PrivateKey:
+		privBytes, err = x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal ECDSA private key: %w", err)
+		}
+		blockType = "EC PRIVATE KEY"
+
+	case ed25519.PrivateKey:
+		privBytes, err = x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal Ed25519 private key: %w", err)
+		}
+		blockType = "PRIVATE KEY"
+
+	default:
+		return nil, fmt.Errorf("unsupported private key type: %T", key)
+	}
+
+	block := &pem.Block{
+		Type:  blockType,
+		Bytes: privBytes,
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type: %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+}
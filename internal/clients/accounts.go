@@ -0,0 +1,230 @@
+package clients
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	certificates "ssl-manager/internal/certificates"
+	models "ssl-manager/internal/models"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+)
+
+var errNoAccount = errors.New("no acme account loaded")
+
+// HasAccount reports whether an account is loaded for issuance with caName.
+func (c *Client) HasAccount(caName string) bool {
+	ca, err := c.ca(caName)
+	if err != nil {
+		return false
+	}
+	_, err = ca.active()
+	return err == nil
+}
+
+// LoadAccount makes the account identified by keyPEM and accountURL the one
+// used for issuance with caName.
+func (c *Client) LoadAccount(caName string, keyPEM []byte, accountURL string) error {
+	ca, err := c.ca(caName)
+	if err != nil {
+		return err
+	}
+
+	key, err := certificates.ParsePrivateKey(keyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to parse account key: %w", err)
+	}
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.acme = ca.newACMEClient(key, accountURL)
+	ca.accountURL = accountURL
+	c.log.Info("Using ACME account ", accountURL, " for ca ", caName)
+	return nil
+}
+
+// UnloadAccount stops using accountURL for issuance if it is the active one.
+func (c *Client) UnloadAccount(caName, accountURL string) {
+	ca, err := c.ca(caName)
+	if err != nil {
+		return
+	}
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if ca.accountURL == accountURL {
+		ca.acme = nil
+		ca.accountURL = ""
+	}
+}
+
+// RegisterAccount creates an account with the CA under a freshly generated
+// key. eab overrides the External Account Binding configured for the CA.
+func (c *Client) RegisterAccount(ctx context.Context, caName string, emails []string, eab *models.EABCredentials) (*models.ACMEAccountData, error) {
+	ca, err := c.ca(caName)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, &ACMEError{Step: StepAccount, CA: caName, Err: err}
+	}
+
+	ac := ca.newACMEClient(key, "")
+	binding, err := ca.externalAccountBinding(ctx, ac, eab)
+	if err != nil {
+		return nil, &ACMEError{Step: StepAccount, CA: caName, Err: err}
+	}
+
+	account, err := ac.Register(ctx, &acme.Account{
+		Contact:                mailtoContacts(emails),
+		ExternalAccountBinding: binding,
+	}, acme.AcceptTOS)
+	if errors.Is(err, acme.ErrAccountAlreadyExists) {
+		account, err = ac.GetReg(ctx, "")
+	}
+	if err != nil {
+		if binding != nil && isEABRejection(err) {
+			err = &EABError{CA: caName, KeyID: binding.KID, Err: err}
+		}
+		return nil, &ACMEError{Step: StepAccount, CA: caName, Err: err}
+	}
+
+	data, err := accountData(account, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if binding != nil {
+		data.EABKeyID = binding.KID
+		// a CA that does not require a binding may accept and ignore it
+		dir, discoverErr := ac.Discover(ctx)
+		if discoverErr != nil {
+			c.log.Warn("Failed to fetch directory of ca ", caName, ", unknown whether binding ", binding.KID, " is required: ", discoverErr)
+		} else {
+			data.EABRequired = dir.ExternalAccountRequired
+		}
+		if !data.EABRequired {
+			c.log.Warn("CA ", caName, " does not require external account binding, binding ", binding.KID, " may have been ignored")
+		}
+	}
+
+	return data, nil
+}
+
+// UpdateAccount replaces the contact emails of an account.
+func (c *Client) UpdateAccount(ctx context.Context, caName string, keyPEM []byte, accountURL string, emails []string) (*models.ACMEAccountData, error) {
+	ca, err := c.ca(caName)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := certificates.ParsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse account key: %w", err)
+	}
+
+	account, err := ca.newACMEClient(key, accountURL).UpdateReg(ctx, &acme.Account{Contact: mailtoContacts(emails)})
+	if err != nil {
+		return nil, &ACMEError{Step: StepAccount, CA: caName, Err: err}
+	}
+
+	return accountData(account, key)
+}
+
+// RolloverAccountKey replaces the account key using the ACME key-change flow
+// and switches issuance over to it when the account is the active one.
+func (c *Client) RolloverAccountKey(ctx context.Context, caName string, keyPEM []byte, accountURL string) (*models.ACMEAccountData, error) {
+	ca, err := c.ca(caName)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := certificates.ParsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse account key: %w", err)
+	}
+
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate account key: %w", err)
+	}
+
+	ac := ca.newACMEClient(key, accountURL)
+	if err := ac.AccountKeyRollover(ctx, newKey); err != nil {
+		return nil, &ACMEError{Step: StepAccount, CA: caName, Err: err}
+	}
+
+	account, err := ac.GetReg(ctx, "")
+	if err != nil {
+		return nil, &ACMEError{Step: StepAccount, CA: caName, Err: err}
+	}
+
+	ca.mu.Lock()
+	if ca.accountURL == accountURL {
+		ca.acme = ca.newACMEClient(newKey, accountURL)
+	}
+	ca.mu.Unlock()
+
+	return accountData(account, newKey)
+}
+
+// DeactivateAccount permanently deactivates an account with the CA.
+func (c *Client) DeactivateAccount(ctx context.Context, caName string, keyPEM []byte, accountURL string) error {
+	ca, err := c.ca(caName)
+	if err != nil {
+		return err
+	}
+
+	key, err := certificates.ParsePrivateKey(keyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to parse account key: %w", err)
+	}
+
+	if err := ca.newACMEClient(key, accountURL).DeactivateReg(ctx); err != nil {
+		return &ACMEError{Step: StepAccount, CA: caName, Err: err}
+	}
+
+	c.UnloadAccount(caName, accountURL)
+	return nil
+}
+
+func accountData(account *acme.Account, key crypto.Signer) (*models.ACMEAccountData, error) {
+	keyPEM, err := certificates.EncodePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	registration, err := json.Marshal(account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal account: %w", err)
+	}
+
+	emails := make([]string, 0, len(account.Contact))
+	for _, contact := range account.Contact {
+		emails = append(emails, strings.TrimPrefix(contact, "mailto:"))
+	}
+
+	return &models.ACMEAccountData{
+		URL:          account.URI,
+		Emails:       emails,
+		Status:       account.Status,
+		Key:          keyPEM,
+		Registration: registration,
+	}, nil
+}
+
+func mailtoContacts(emails []string) []string {
+	contacts := make([]string, 0, len(emails))
+	for _, email := range emails {
+		contacts = append(contacts, "mailto:"+email)
+	}
+	return contacts
+}
@@ -0,0 +1,223 @@
+package clients
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	certificates "ssl-manager/internal/certificates"
+	models "ssl-manager/internal/models"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+const userAgent = "ssl-manager"
+
+// challengePreference is the order challenges are tried in when an
+// authorization offers more than one we can solve.
+var challengePreference = []string{"http-01", "dns-01"}
+
+// ChallengeSolver fulfils a single ACME challenge type. keyAuth is the value
+// the CA expects to find: the HTTP response body for http-01, the TXT record
+// value for dns-01.
+type ChallengeSolver interface {
+	Present(ctx context.Context, domain, token, keyAuth string) error
+	CleanUp(ctx context.Context, domain, token, keyAuth string) error
+}
+
+// RegisterSolver makes the client able to answer challenges of the given type.
+func (c *Client) RegisterSolver(challengeType string, solver ChallengeSolver) {
+	c.solvers[challengeType] = solver
+}
+
+// CreateCertificate runs a full ACME v2 order for domain: new-order,
+// authorization and challenge, CSR finalize and chain download.
+func (c *Client) CreateCertificate(req models.CertificateOrder) (*models.CertificateData, error) {
+	domain := req.Domain
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Certs.OrderTimeout)
+	defer cancel()
+
+	ca, err := c.ca(req.CA)
+	if err != nil {
+		return nil, &ACMEError{Step: StepAccount, CA: req.CA, Domain: domain, Err: err}
+	}
+	ac, err := ca.active()
+	if err != nil {
+		return nil, &ACMEError{Step: StepAccount, CA: req.CA, Domain: domain, Err: err}
+	}
+
+	names := append([]string{domain}, req.SANs...)
+
+	c.log.Debug("Creating order for names: ", names)
+	order, err := ac.AuthorizeOrder(ctx, acme.DomainIDs(names...))
+	if err != nil {
+		return nil, &ACMEError{Step: StepOrder, CA: req.CA, Domain: domain, Err: err}
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		if err := c.authorize(ctx, ac, req.CA, domain, authzURL, req.VerificationMethod); err != nil {
+			return nil, err
+		}
+	}
+
+	order, err = ac.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, &ACMEError{Step: StepOrder, CA: req.CA, Domain: domain, Err: err}
+	}
+
+	// a supplied CSR is finalized as is, its key never leaves the owner
+	var key crypto.Signer
+	csr := req.CSR
+	if csr == nil {
+		key, err = c.certificateKey(ctx, req.KeyType, req.ReuseKeyPath)
+		if err != nil {
+			return nil, &ACMEError{Step: StepFinalize, CA: req.CA, Domain: domain, Err: fmt.Errorf("failed to generate key: %w", err)}
+		}
+
+		csr, err = x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: domain},
+			DNSNames: names,
+		}, key)
+		if err != nil {
+			return nil, &ACMEError{Step: StepFinalize, CA: req.CA, Domain: domain, Err: fmt.Errorf("failed to create csr: %w", err)}
+		}
+	}
+
+	c.log.Debug("Finalizing order: ", order.URI)
+	der, certURL, err := ac.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, &ACMEError{Step: StepFinalize, CA: req.CA, Domain: domain, Err: err}
+	}
+	if len(der) == 0 {
+		return nil, &ACMEError{Step: StepDownload, CA: req.CA, Domain: domain, Err: fmt.Errorf("empty certificate chain at %s", certURL)}
+	}
+
+	material, err := certificates.FromDER(der, key)
+	if err != nil {
+		return nil, &ACMEError{Step: StepDownload, CA: req.CA, Domain: domain, Err: err}
+	}
+	if err := material.Covers(names); err != nil {
+		return nil, &ACMEError{Step: StepDownload, CA: req.CA, Domain: domain, Err: err}
+	}
+	if !ca.cfg.SkipChainVerification {
+		if err := material.Verify(ca.roots, time.Now()); err != nil {
+			return nil, &ACMEError{Step: StepDownload, CA: req.CA, Domain: domain, Err: err}
+		}
+	}
+
+	return certificateData(req.CA, material)
+}
+
+// certificateData renders material into the files kept for a domain.
+func certificateData(issuer string, material *certificates.Material) (*models.CertificateData, error) {
+	keyPEM, err := material.KeyPEM()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CertificateData{
+		Issuer:    issuer,
+		KeyType:   keyTypeOfPublic(material.Leaf.PublicKey),
+		Cert:      material.CertPEM(),
+		Key:       keyPEM,
+		Chain:     material.ChainPEM(),
+		Fullchain: material.FullchainPEM(),
+		ValidFrom: material.Leaf.NotBefore,
+		ValidTo:   material.Leaf.NotAfter,
+	}, nil
+}
+
+func (c *Client) authorize(ctx context.Context, ac *acme.Client, caName, domain, authzURL, method string) error {
+	authz, err := ac.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return &ACMEError{Step: StepAuthorization, CA: caName, Domain: domain, Err: err}
+	}
+
+	identifier := authz.Identifier.Value
+	switch authz.Status {
+	case acme.StatusValid:
+		return nil
+	case acme.StatusPending:
+	default:
+		return &ACMEError{Step: StepAuthorization, CA: caName, Domain: identifier, Err: fmt.Errorf("authorization %s is %s", authz.URI, authz.Status)}
+	}
+
+	// wildcard names can only be validated over DNS
+	if authz.Wildcard {
+		method = "dns-01"
+	}
+
+	chal, solver, err := c.selectChallenge(authz, method)
+	if err != nil {
+		return &ACMEError{Step: StepChallenge, CA: caName, Domain: identifier, Err: err}
+	}
+
+	keyAuth, err := keyAuthorization(ac, chal)
+	if err != nil {
+		return &ACMEError{Step: StepChallenge, CA: caName, Domain: identifier, Err: err}
+	}
+
+	c.log.Debug("Presenting ", chal.Type, " challenge for: ", identifier)
+	if err := solver.Present(ctx, identifier, chal.Token, keyAuth); err != nil {
+		return &ACMEError{Step: StepChallenge, CA: caName, Domain: identifier, Err: fmt.Errorf("failed to present %s challenge: %w", chal.Type, err)}
+	}
+	defer func() {
+		if err := solver.CleanUp(context.Background(), identifier, chal.Token, keyAuth); err != nil {
+			c.log.Warn("Failed to clean up ", chal.Type, " challenge for ", identifier, ": ", err)
+		}
+	}()
+
+	if _, err := ac.Accept(ctx, chal); err != nil {
+		return &ACMEError{Step: StepChallenge, CA: caName, Domain: identifier, Err: err}
+	}
+
+	if _, err := ac.WaitAuthorization(ctx, authz.URI); err != nil {
+		return &ACMEError{Step: StepAuthorization, CA: caName, Domain: identifier, Err: err}
+	}
+
+	return nil
+}
+
+// selectChallenge picks the challenge for method, or the first solvable one
+// in challengePreference order when no method is given.
+func (c *Client) selectChallenge(authz *acme.Authorization, method string) (*acme.Challenge, ChallengeSolver, error) {
+	preference := challengePreference
+	if method != "" {
+		if _, ok := c.solvers[method]; !ok {
+			return nil, nil, fmt.Errorf("no solver configured for %s", method)
+		}
+		preference = []string{method}
+	}
+
+	for _, typ := range preference {
+		solver, ok := c.solvers[typ]
+		if !ok {
+			continue
+		}
+		for _, chal := range authz.Challenges {
+			if chal.Type == typ {
+				return chal, solver, nil
+			}
+		}
+	}
+
+	offered := make([]string, 0, len(authz.Challenges))
+	for _, chal := range authz.Challenges {
+		offered = append(offered, chal.Type)
+	}
+	return nil, nil, fmt.Errorf("no solver for offered challenges %v", offered)
+}
+
+func keyAuthorization(ac *acme.Client, chal *acme.Challenge) (string, error) {
+	switch chal.Type {
+	case "http-01":
+		return ac.HTTP01ChallengeResponse(chal.Token)
+	case "dns-01":
+		return ac.DNS01ChallengeRecord(chal.Token)
+	default:
+		return "", fmt.Errorf("unsupported challenge type %s", chal.Type)
+	}
+}
@@ -0,0 +1,330 @@
+package clients
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	certificates "ssl-manager/internal/certificates"
+	models "ssl-manager/internal/models"
+	utils "ssl-manager/internal/utils"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// fakeOrderCA issues certificates for a single-name order validated over
+// http-01. failAt names the step it refuses: "order", "authorization",
+// "challenge", "validation", "finalize" or "names", which issues the
+// certificate for another name.
+type fakeOrderCA struct {
+	failAt  string
+	root    *x509.Certificate
+	rootKey crypto.Signer
+
+	mu       sync.Mutex
+	accepted bool
+	chain    []byte
+}
+
+func (ca *fakeOrderCA) start(t *testing.T) *httptest.Server {
+	t.Helper()
+	ca.root, ca.rootKey = testRoot(t)
+	srv, mux := fakeACME(t, nil)
+
+	order := func(status string) map[string]interface{} {
+		o := map[string]interface{}{
+			"status":         status,
+			"identifiers":    []map[string]string{{"type": "dns", "value": "example.com"}},
+			"authorizations": []string{srv.URL + "/authz/1"},
+			"finalize":       srv.URL + "/finalize/1",
+		}
+		if status == "valid" {
+			o["certificate"] = srv.URL + "/cert/1"
+		}
+		return o
+	}
+	challenge := func(status string) map[string]interface{} {
+		c := map[string]interface{}{"type": "http-01", "url": srv.URL + "/chal/1", "token": "token-1", "status": status}
+		if status == "invalid" {
+			c["error"] = map[string]string{"type": "urn:ietf:params:acme:error:unauthorized", "detail": "wrong key authorization"}
+		}
+		return c
+	}
+	answer := func(w http.ResponseWriter, status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+
+	mux.HandleFunc("/order", func(w http.ResponseWriter, r *http.Request) {
+		if ca.failAt == "order" {
+			acmeProblem(w, http.StatusForbidden, "rejectedIdentifier", "example.com is not allowed")
+			return
+		}
+		w.Header().Set("Location", srv.URL+"/order/1")
+		answer(w, http.StatusCreated, order("pending"))
+	})
+	mux.HandleFunc("/authz/1", func(w http.ResponseWriter, r *http.Request) {
+		ca.mu.Lock()
+		defer ca.mu.Unlock()
+		status, chal := "pending", challenge("pending")
+		switch {
+		case ca.failAt == "authorization":
+			status, chal = "deactivated", challenge("pending")
+		case ca.accepted && ca.failAt == "validation":
+			status, chal = "invalid", challenge("invalid")
+		case ca.accepted:
+			status, chal = "valid", challenge("valid")
+		}
+		answer(w, http.StatusOK, map[string]interface{}{
+			"status":     status,
+			"identifier": map[string]string{"type": "dns", "value": "example.com"},
+			"challenges": []interface{}{chal},
+		})
+	})
+	mux.HandleFunc("/chal/1", func(w http.ResponseWriter, r *http.Request) {
+		if ca.failAt == "challenge" {
+			acmeProblem(w, http.StatusBadRequest, "malformed", "challenge cannot be accepted")
+			return
+		}
+		ca.mu.Lock()
+		ca.accepted = true
+		ca.mu.Unlock()
+		answer(w, http.StatusOK, challenge("processing"))
+	})
+	mux.HandleFunc("/order/1", func(w http.ResponseWriter, r *http.Request) {
+		ca.mu.Lock()
+		defer ca.mu.Unlock()
+		w.Header().Set("Location", srv.URL+"/order/1")
+		if ca.chain != nil {
+			answer(w, http.StatusOK, order("valid"))
+			return
+		}
+		answer(w, http.StatusOK, order("ready"))
+	})
+	mux.HandleFunc("/finalize/1", func(w http.ResponseWriter, r *http.Request) {
+		if ca.failAt == "finalize" {
+			acmeProblem(w, http.StatusForbidden, "badCSR", "csr is refused")
+			return
+		}
+		var finalize struct {
+			CSR string `json:"csr"`
+		}
+		if err := acmePayload(r, &finalize); err != nil {
+			acmeProblem(w, http.StatusBadRequest, "malformed", err.Error())
+			return
+		}
+		der, err := base64.RawURLEncoding.DecodeString(finalize.CSR)
+		if err != nil {
+			acmeProblem(w, http.StatusBadRequest, "badCSR", err.Error())
+			return
+		}
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil {
+			acmeProblem(w, http.StatusBadRequest, "badCSR", err.Error())
+			return
+		}
+		names := csr.DNSNames
+		if ca.failAt == "names" {
+			names = []string{"other.example.com"}
+		}
+		leaf, err := ca.issue(csr.PublicKey, names)
+		if err != nil {
+			acmeProblem(w, http.StatusInternalServerError, "serverInternal", err.Error())
+			return
+		}
+
+		ca.mu.Lock()
+		ca.chain = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.root.Raw})...)
+		ca.mu.Unlock()
+		w.Header().Set("Location", srv.URL+"/order/1")
+		answer(w, http.StatusOK, order("valid"))
+	})
+	mux.HandleFunc("/cert/1", func(w http.ResponseWriter, r *http.Request) {
+		ca.mu.Lock()
+		defer ca.mu.Unlock()
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_, _ = w.Write(ca.chain)
+	})
+	return srv
+}
+
+func (ca *fakeOrderCA) issue(key crypto.PublicKey, names []string) ([]byte, error) {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	return x509.CreateCertificate(rand.Reader, template, ca.root, key, ca.rootKey)
+}
+
+func testRoot(t *testing.T) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake ca root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root, key
+}
+
+// recordingSolver records the challenges it is asked to present and clean
+// up.
+type recordingSolver struct {
+	mu               sync.Mutex
+	presented, clean []string
+}
+
+func (s *recordingSolver) Present(ctx context.Context, domain, token, keyAuth string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.presented = append(s.presented, domain+" "+token+" "+keyAuth)
+	return nil
+}
+
+func (s *recordingSolver) CleanUp(ctx context.Context, domain, token, keyAuth string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clean = append(s.clean, domain+" "+token+" "+keyAuth)
+	return nil
+}
+
+func TestCreateCertificate(t *testing.T) {
+	tests := []struct {
+		failAt  string
+		method  string
+		step    Step
+		present bool // whether the challenge was presented, and cleaned up
+	}{
+		{failAt: "", present: true},
+		{failAt: "order", step: StepOrder},
+		{failAt: "authorization", step: StepAuthorization},
+		{failAt: "challenge", step: StepChallenge, present: true},
+		{failAt: "validation", step: StepAuthorization, present: true},
+		// offered http-01 only
+		{failAt: "", method: "dns-01", step: StepChallenge},
+		{failAt: "finalize", step: StepFinalize, present: true},
+		{failAt: "names", step: StepDownload, present: true},
+	}
+	for _, tt := range tests {
+		name := tt.failAt
+		if name == "" {
+			name = "success"
+		}
+		if tt.method != "" {
+			name = "no solver"
+		}
+		t.Run(name, func(t *testing.T) {
+			fake := &fakeOrderCA{failAt: tt.failAt}
+			srv := fake.start(t)
+
+			ca, err := newCAClient(utils.CAConfig{Name: "fake", DirectoryURL: srv.URL + "/directory"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ca.roots.AddCert(fake.root)
+			accountKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ca.acme = ca.newACMEClient(accountKey, srv.URL+"/account/1")
+
+			cfg := &utils.Config{}
+			cfg.Certs.OrderTimeout = 10 * time.Second
+			solver := &recordingSolver{}
+			c := &Client{
+				log:     utils.NewLogger("error"),
+				cfg:     cfg,
+				cas:     map[string]*caClient{"fake": ca},
+				solvers: map[string]ChallengeSolver{"http-01": solver},
+			}
+
+			data, err := c.CreateCertificate(models.CertificateOrder{CA: "fake", Domain: "example.com", VerificationMethod: tt.method})
+
+			keyAuth, _ := ca.acme.HTTP01ChallengeResponse("token-1")
+			var want []string
+			if tt.present {
+				want = []string{"example.com token-1 " + keyAuth}
+			}
+			if !slices.Equal(solver.presented, want) || !slices.Equal(solver.clean, want) {
+				t.Errorf("presented %q, cleaned up %q, want %q", solver.presented, solver.clean, want)
+			}
+
+			if tt.step != "" {
+				var acmeErr *ACMEError
+				if !errors.As(err, &acmeErr) {
+					t.Fatalf("got %v, want an ACMEError", err)
+				}
+				if acmeErr.Step != tt.step || acmeErr.CA != "fake" || acmeErr.Domain != "example.com" {
+					t.Errorf("got step %s for %s at %s, want %s", acmeErr.Step, acmeErr.Domain, acmeErr.CA, tt.step)
+				}
+				// the problem of the failed challenge reaches the caller
+				var authzErr *acme.AuthorizationError
+				if tt.failAt == "validation" && !errors.As(err, &authzErr) {
+					t.Errorf("got %v, want an AuthorizationError", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("CreateCertificate: %v", err)
+			}
+			if data.Issuer != "fake" || data.KeyType != utils.KeyTypeECDSAP256 {
+				t.Errorf("issuer %q, key type %q", data.Issuer, data.KeyType)
+			}
+			block, _ := pem.Decode(data.Cert)
+			if block == nil {
+				t.Fatalf("certificate is not pem: %q", data.Cert)
+			}
+			leaf, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(leaf.DNSNames, []string{"example.com"}) || !data.ValidTo.Equal(leaf.NotAfter) {
+				t.Errorf("leaf for %v until %v, data until %v", leaf.DNSNames, leaf.NotAfter, data.ValidTo)
+			}
+			key, err := certificates.ParsePrivateKey(data.Key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !key.Public().(*ecdsa.PublicKey).Equal(leaf.PublicKey) {
+				t.Error("key does not match the certificate")
+			}
+		})
+	}
+}
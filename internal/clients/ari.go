@@ -0,0 +1,167 @@
+package clients
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	models "ssl-manager/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrARIUnsupported is returned when the CA's directory has no renewalInfo
+// endpoint (RFC 9773).
+var ErrARIUnsupported = errors.New("ca does not support acme renewal information")
+
+// defaultARIRetryAfter is used when the CA sends no Retry-After header.
+const defaultARIRetryAfter = 6 * time.Hour
+
+type renewalInfoResponse struct {
+	SuggestedWindow struct {
+		Start time.Time `json:"start"`
+		End   time.Time `json:"end"`
+	} `json:"suggestedWindow"`
+	ExplanationURL string `json:"explanationURL"`
+}
+
+// RenewalInfo fetches the renewal window the CA suggests for the certificate
+// stored at certPath. golang.org/x/crypto/acme has no ARI support, so the
+// endpoint is queried directly; it is unauthenticated.
+func (c *Client) RenewalInfo(ctx context.Context, caName, certPath string) (*models.RenewalInfo, error) {
+	ca, err := c.ca(caName)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint, err := ca.renewalInfoEndpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM, err := c.store.Read(ctx, certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found in %s", certPath)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	certID, err := ariCertID(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp renewalInfoResponse
+	header, err := ca.getJSON(ctx, strings.TrimSuffix(endpoint, "/")+"/"+certID, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch renewal info: %w", err)
+	}
+
+	window := resp.SuggestedWindow
+	if window.Start.IsZero() || !window.End.After(window.Start) {
+		return nil, fmt.Errorf("invalid renewal window %s - %s", window.Start, window.End)
+	}
+
+	return &models.RenewalInfo{
+		WindowStart:    window.Start,
+		WindowEnd:      window.End,
+		ExplanationURL: resp.ExplanationURL,
+		RetryAfter:     retryAfter(header.Get("Retry-After")),
+	}, nil
+}
+
+// renewalInfoEndpoint reads renewalInfo from the directory, which
+// acme.Directory does not expose. The result is cached per CA.
+func (ca *caClient) renewalInfoEndpoint(ctx context.Context) (string, error) {
+	ca.mu.RLock()
+	endpoint, loaded := ca.renewalInfo, ca.renewalInfoLoaded
+	ca.mu.RUnlock()
+	if loaded {
+		if endpoint == "" {
+			return "", ErrARIUnsupported
+		}
+		return endpoint, nil
+	}
+
+	var dir struct {
+		RenewalInfo string `json:"renewalInfo"`
+	}
+	if _, err := ca.getJSON(ctx, ca.cfg.DirectoryURL, &dir); err != nil {
+		return "", fmt.Errorf("failed to fetch directory: %w", err)
+	}
+
+	ca.mu.Lock()
+	ca.renewalInfo, ca.renewalInfoLoaded = dir.RenewalInfo, true
+	ca.mu.Unlock()
+
+	if dir.RenewalInfo == "" {
+		return "", ErrARIUnsupported
+	}
+	return dir.RenewalInfo, nil
+}
+
+func (ca *caClient) getJSON(ctx context.Context, url string, v interface{}) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := ca.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s: unexpected status %d: %s", url, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	return resp.Header, nil
+}
+
+// ariCertID builds the RFC 9773 certificate identifier: the authority key
+// identifier and the DER serial number, both base64url encoded.
+func ariCertID(cert *x509.Certificate) (string, error) {
+	if len(cert.AuthorityKeyId) == 0 {
+		return "", errors.New("certificate has no authority key identifier")
+	}
+
+	serial := cert.SerialNumber.Bytes()
+	if len(serial) == 0 || serial[0]&0x80 != 0 {
+		// keep the DER INTEGER positive
+		serial = append([]byte{0}, serial...)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(cert.AuthorityKeyId) + "." +
+		base64.RawURLEncoding.EncodeToString(serial), nil
+}
+
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return defaultARIRetryAfter
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && time.Until(t) > 0 {
+		return time.Until(t)
+	}
+	return defaultARIRetryAfter
+}
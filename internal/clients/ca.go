@@ -0,0 +1,115 @@
+package clients
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	utils "ssl-manager/internal/utils"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// caClient holds the connection settings and the active account for one
+// configured certificate authority.
+type caClient struct {
+	cfg        utils.CAConfig
+	httpClient *http.Client
+	roots      *x509.CertPool // system pool plus the configured trusted roots
+
+	mu         sync.RWMutex
+	acme       *acme.Client // active account, set by LoadAccount
+	accountURL string
+
+	renewalInfo       string // ARI endpoint from the directory
+	renewalInfoLoaded bool
+}
+
+func newCAClient(cfg utils.CAConfig) (*caClient, error) {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	for _, path := range cfg.TrustedRoots {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trusted root %s: %w", path, err)
+		}
+		if !roots.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in trusted root %s", path)
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+
+	return &caClient{
+		cfg:        cfg,
+		httpClient: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		roots:      roots,
+	}, nil
+}
+
+func (ca *caClient) newACMEClient(key crypto.Signer, accountURL string) *acme.Client {
+	return &acme.Client{
+		Key:          key,
+		KID:          acme.KeyID(accountURL),
+		DirectoryURL: ca.cfg.DirectoryURL,
+		HTTPClient:   ca.httpClient,
+		UserAgent:    userAgent,
+	}
+}
+
+func (ca *caClient) active() (*acme.Client, error) {
+	ca.mu.RLock()
+	defer ca.mu.RUnlock()
+	if ca.acme == nil {
+		return nil, errNoAccount
+	}
+	return ca.acme, nil
+}
+
+func (c *Client) ca(name string) (*caClient, error) {
+	ca, ok := c.cas[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown ca %q", name)
+	}
+	return ca, nil
+}
+
+// HasCA reports whether name is a configured CA.
+func (c *Client) HasCA(name string) bool {
+	_, ok := c.cas[name]
+	return ok
+}
+
+// CANames returns the configured CAs in config order.
+func (c *Client) CANames() []string {
+	names := make([]string, 0, len(c.cfg.Certs.CAs))
+	for _, ca := range c.cfg.Certs.CAs {
+		names = append(names, ca.Name)
+	}
+	return names
+}
+
+// CADirectoryURL returns the ACME directory of a configured CA.
+func (c *Client) CADirectoryURL(name string) string {
+	if ca, ok := c.cas[name]; ok {
+		return ca.cfg.DirectoryURL
+	}
+	return ""
+}
+
+// CAForDirectory finds the configured CA serving directoryURL.
+func (c *Client) CAForDirectory(directoryURL string) (string, bool) {
+	for name, ca := range c.cas {
+		if ca.cfg.DirectoryURL == directoryURL {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -1,153 +1,108 @@
 package clients
 
 import (
-	"crypto/ecdsa"
-	"crypto/ed25519"
-	"crypto/rsa"
-	"crypto/tls"
-	"crypto/x509"
-	"encoding/pem"
+	"context"
 	"fmt"
-	"os"
-	"path/filepath"
+	envelope "ssl-manager/internal/envelope"
 	models "ssl-manager/internal/models"
+	storage "ssl-manager/internal/storage"
 	utils "ssl-manager/internal/utils"
-	"time"
-
-	"golang.org/x/crypto/acme/autocert"
 )
 
 type Client struct {
 	log     *utils.Logger
 	cfg     *utils.Config
-	Manager *autocert.Manager
+	store   storage.CertStore
+	sealer  *envelope.Sealer // nil when keys are stored unencrypted
+	cas     map[string]*caClient
+	solvers map[string]ChallengeSolver
+	http01  *http01Responder
 }
 
-func NewClient(log *utils.Logger, cfg *utils.Config) (*Client, error) {
-	manager := &autocert.Manager{
-		Prompt: autocert.AcceptTOS,
-		Cache:  autocert.DirCache(cfg.Certs.StorageDir),
-		Email:  cfg.Certs.Email,
-	}
-	return &Client{
+func NewClient(log *utils.Logger, cfg *utils.Config, store storage.CertStore, sealer *envelope.Sealer) (*Client, error) {
+	client := &Client{
 		log:     log,
 		cfg:     cfg,
-		Manager: manager,
-	}, nil
-}
-
-func (c *Client) CreateCertificate(domain string) (*models.CertificateData, error) {
-	cert, err := c.Manager.GetCertificate(&tls.ClientHelloInfo{ServerName: domain})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get certificate for domain %s: %w", domain, err)
+		store:   store,
+		sealer:  sealer,
+		cas:     make(map[string]*caClient),
+		solvers: make(map[string]ChallengeSolver),
 	}
 
-	certPEM := cert.Certificate[0]
-	keyBytes := cert.PrivateKey
-
-	var validFrom, validTo time.Time
-	if len(cert.Leaf.NotBefore.String()) > 0 {
-		validFrom = cert.Leaf.NotBefore
-		validTo = cert.Leaf.NotAfter
+	for _, caCfg := range cfg.Certs.CAs {
+		ca, err := newCAClient(caCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up ca %s: %w", caCfg.Name, err)
+		}
+		client.cas[caCfg.Name] = ca
 	}
 
-	return &models.CertificateData{
-		Cert:      certPEM,
-		Key:       encodePrivateKeyToPEM(keyBytes),
-		Chain:     joinCertChain(cert.Certificate),
-		ValidFrom: validFrom,
-		ValidTo:   validTo,
-	}, nil
-}
-
-func (c *Client) SaveCertificateFiles(domain string, certData *models.CertificateData) (*models.CertificatePaths, error) {
-	dir := filepath.Join(c.cfg.Certs.StorageDir, domain)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create cert dir: %w", err)
+	switch cfg.Certs.HTTP01.Mode {
+	case "", "responder":
+		client.http01 = newHTTP01Responder()
+		client.RegisterSolver("http-01", client.http01)
+	case "webroot":
+		webroot, err := newHTTP01Webroot(cfg)
+		if err != nil {
+			return nil, err
+		}
+		client.RegisterSolver("http-01", webroot)
+	default:
+		return nil, fmt.Errorf("unknown http-01 mode %q", cfg.Certs.HTTP01.Mode)
 	}
 
-	certPath := filepath.Join(dir, "cert.pem")
-	keyPath := filepath.Join(dir, "key.pem")
-	chainPath := filepath.Join(dir, "chain.pem")
-
-	if err := os.WriteFile(certPath, certData.Cert, 0600); err != nil {
-		return nil, fmt.Errorf("failed to write cert: %w", err)
-	}
-	if err := os.WriteFile(keyPath, certData.Key, 0600); err != nil {
-		return nil, fmt.Errorf("failed to write key: %w", err)
-	}
-	if err := os.WriteFile(chainPath, certData.Chain, 0600); err != nil {
-		return nil, fmt.Errorf("failed to write chain: %w", err)
+	if cfg.Certs.DNS.Provider != "" {
+		provider, err := newDNSProvider(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create dns provider: %w", err)
+		}
+		client.RegisterSolver("dns-01", newDNS01Solver(provider, cfg.Certs.DNS.Resolvers, log))
 	}
 
-	return &models.CertificatePaths{
-		Cert:  certPath,
-		Key:   keyPath,
-		Chain: chainPath,
-	}, nil
+	return client, nil
 }
 
-func (c *Client) DeleteCertificateFiles(certPath, keyPath, chainPath string) error {
-	paths := []string{certPath, keyPath, chainPath}
-
-	for _, p := range paths {
-		if p == "" {
-			continue
-		}
-
-		if _, err := os.Stat(p); os.IsNotExist(err) {
-			continue
+// SaveCertificateFiles stores certData as a new version of domain and makes
+// it the current one. The returned paths are store references, which never
+// change once written.
+func (c *Client) SaveCertificateFiles(ctx context.Context, domain string, certData *models.CertificateData) (*models.CertificatePaths, error) {
+	files := map[string][]byte{
+		"cert.pem":      certData.Cert,
+		"chain.pem":     certData.Chain,
+		"fullchain.pem": certData.Fullchain,
+	}
+	// certificates issued for a supplied csr have no key on our side
+	if len(certData.Key) > 0 {
+		key, err := c.seal(ctx, "key.pem", certData.Key)
+		if err != nil {
+			return nil, err
 		}
+		files["key.pem"] = key
+	}
 
-		if err := os.Remove(p); err != nil {
-			return fmt.Errorf("failed to delete file %s: %w", p, err)
-		}
+	refs, err := c.store.Save(ctx, domain, files)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return &models.CertificatePaths{
+		Cert:      refs["cert.pem"],
+		Key:       refs["key.pem"],
+		Chain:     refs["chain.pem"],
+		Fullchain: refs["fullchain.pem"],
+	}, nil
 }
 
-func joinCertChain(chain [][]byte) []byte {
-	result := []byte{}
-	for _, c := range chain {
-		result = append(result, c...)
-	}
-	return result
+// ActivateCertificateVersion makes the version certPath belongs to the
+// current one again, e.g. when its successor could not be recorded. It
+// leaves a version other than the one replacedPath belongs to in place and
+// returns storage.ErrVersionReplaced then.
+func (c *Client) ActivateCertificateVersion(ctx context.Context, certPath, replacedPath string) error {
+	return c.store.Activate(ctx, certPath, replacedPath)
 }
 
-func encodePrivateKeyToPEM(key interface{}) []byte {
-	var (
-		privBytes []byte
-		err       error
-		blockType string
-	)
-
-	switch k := key.(type) {
-	case *rsa.PrivateKey:
-		privBytes = x509.MarshalPKCS1PrivateKey(k)
-		blockType = "RSA PRIVATE KEY"
-
-	case *ecdsa.PrivateKey:
-		privBytes, err = x509.MarshalECPrivateKey(k)
-		if err != nil {
-			panic(fmt.Errorf("failed to marshal ECDSA private key: %w", err))
-		}
-		blockType = "EC PRIVATE KEY"
-
-	case ed25519.PrivateKey:
-		privBytes, err = x509.MarshalPKCS8PrivateKey(k)
-		if err != nil {
-			panic(fmt.Errorf("failed to marshal Ed25519 private key: %w", err))
-		}
-		blockType = "PRIVATE KEY"
-
-	default:
-		panic(fmt.Errorf("unsupported private key type: %T", key))
-	}
-
-	block := &pem.Block{
-		Type:  blockType,
-		Bytes: privBytes,
-	}
-	return pem.EncodeToMemory(block)
+// DeleteCertificateFiles removes every stored version of the certificate
+// certPath belongs to, exports included.
+func (c *Client) DeleteCertificateFiles(ctx context.Context, certPath string) error {
+	return c.store.Delete(ctx, certPath)
 }
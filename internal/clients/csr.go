@@ -0,0 +1,67 @@
+package clients
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidateCSR checks a user-supplied PEM CSR: it must be self-signed
+// correctly and request exactly names. It returns the DER to finalize the
+// order with and the type of the key it was made for.
+func ValidateCSR(csrPEM []byte, names []string) ([]byte, string, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || (block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST") {
+		return nil, "", errors.New("no certificate request found in csr")
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse csr: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, "", fmt.Errorf("invalid csr signature: %w", err)
+	}
+	if len(csr.IPAddresses) > 0 || len(csr.EmailAddresses) > 0 || len(csr.URIs) > 0 {
+		return nil, "", errors.New("csr may only request dns names")
+	}
+
+	requested := map[string]bool{}
+	for _, name := range csr.DNSNames {
+		requested[strings.ToLower(name)] = true
+	}
+	if cn := csr.Subject.CommonName; cn != "" {
+		requested[strings.ToLower(cn)] = true
+	}
+
+	expected := map[string]bool{}
+	for _, name := range names {
+		expected[strings.ToLower(name)] = true
+	}
+
+	if missing, extra := diffNames(expected, requested), diffNames(requested, expected); len(missing) > 0 || len(extra) > 0 {
+		return nil, "", fmt.Errorf("csr names do not match the domain: missing %v, unexpected %v", missing, extra)
+	}
+
+	keyType := keyTypeOfPublic(csr.PublicKey)
+	if keyType == "" {
+		return nil, "", fmt.Errorf("unsupported csr key %T", csr.PublicKey)
+	}
+
+	return block.Bytes, keyType, nil
+}
+
+// diffNames returns the names of a that are not in b, sorted.
+func diffNames(a, b map[string]bool) []string {
+	var diff []string
+	for name := range a {
+		if !b[name] {
+			diff = append(diff, name)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
@@ -0,0 +1,57 @@
+package clients
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	certificates "ssl-manager/internal/certificates"
+	deployers "ssl-manager/internal/deployers"
+	models "ssl-manager/internal/models"
+)
+
+// DeploymentCertificate loads the certificate files at paths, decrypted,
+// together with the exports in formats, for the domain's deployers.
+func (c *Client) DeploymentCertificate(ctx context.Context, domain string, paths models.CertificatePaths, formats []string, password string) (*deployers.Certificate, error) {
+	files := map[string][]byte{}
+	for name, ref := range map[string]string{
+		"cert.pem":      paths.Cert,
+		"key.pem":       paths.Key,
+		"chain.pem":     paths.Chain,
+		"fullchain.pem": paths.Fullchain,
+	} {
+		if ref == "" {
+			continue
+		}
+		data, err := c.readFile(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		files[name] = data
+	}
+	for _, format := range formats {
+		file, ok := exportFiles[format]
+		if !ok {
+			continue
+		}
+		export, err := c.ExportCertificate(ctx, paths, format, password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", format, err)
+		}
+		files[file] = export.Data
+	}
+
+	material, err := certificates.Parse(files["cert.pem"], nil, files["chain.pem"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	fingerprint := sha256.Sum256(material.Leaf.Raw)
+
+	return &deployers.Certificate{
+		Domain:      domain,
+		Files:       files,
+		Serial:      material.Leaf.SerialNumber.Text(16),
+		Fingerprint: hex.EncodeToString(fingerprint[:]),
+		NotAfter:    material.Leaf.NotAfter,
+	}, nil
+}
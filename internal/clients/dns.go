@@ -0,0 +1,161 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	utils "ssl-manager/internal/utils"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var defaultResolvers = []string{"1.1.1.1:53", "8.8.8.8:53"}
+
+// DNSProvider publishes and removes the TXT record for a dns-01 challenge.
+type DNSProvider interface {
+	Present(domain, token, keyAuth string) error
+	CleanUp(domain, token, keyAuth string) error
+	// Timeout returns how long to wait for the record to propagate and how
+	// often to check.
+	Timeout() (timeout, interval time.Duration)
+}
+
+func newDNSProvider(cfg *utils.Config) (DNSProvider, error) {
+	switch cfg.Certs.DNS.Provider {
+	case "rfc2136":
+		return newRFC2136Provider(cfg)
+	case "exec":
+		return newExecProvider(cfg)
+	default:
+		return nil, fmt.Errorf("unknown dns provider %q", cfg.Certs.DNS.Provider)
+	}
+}
+
+// dns01Solver adapts a DNSProvider to a ChallengeSolver and blocks until the
+// record is visible on every configured resolver.
+type dns01Solver struct {
+	provider  DNSProvider
+	resolvers []string
+	log       *utils.Logger
+}
+
+func newDNS01Solver(provider DNSProvider, resolvers []string, log *utils.Logger) *dns01Solver {
+	if len(resolvers) == 0 {
+		resolvers = defaultResolvers
+	}
+	return &dns01Solver{
+		provider:  provider,
+		resolvers: resolvers,
+		log:       log,
+	}
+}
+
+func (s *dns01Solver) Present(ctx context.Context, domain, token, keyAuth string) error {
+	if err := s.provider.Present(domain, token, keyAuth); err != nil {
+		return err
+	}
+
+	timeout, interval := s.provider.Timeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	fqdn := challengeFQDN(domain)
+	for {
+		ok, err := s.propagated(fqdn, keyAuth)
+		if ok {
+			return nil
+		}
+		s.log.Debug("Waiting for ", fqdn, " to propagate: ", err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("record %s not propagated after %s: %v", fqdn, timeout, err)
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (s *dns01Solver) CleanUp(ctx context.Context, domain, token, keyAuth string) error {
+	return s.provider.CleanUp(domain, token, keyAuth)
+}
+
+func (s *dns01Solver) propagated(fqdn, value string) (bool, error) {
+	for _, resolver := range s.resolvers {
+		records, err := lookupTXT(fqdn, resolver)
+		if err != nil {
+			return false, fmt.Errorf("resolver %s: %w", resolver, err)
+		}
+		if !containsString(records, value) {
+			return false, fmt.Errorf("resolver %s does not return the challenge record yet", resolver)
+		}
+	}
+	return true, nil
+}
+
+func lookupTXT(fqdn, resolver string) ([]string, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(fqdn, dns.TypeTXT)
+	msg.RecursionDesired = true
+
+	resp, _, err := new(dns.Client).Exchange(msg, resolver)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("unexpected rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	var records []string
+	for _, rr := range resp.Answer {
+		if txt, ok := rr.(*dns.TXT); ok {
+			records = append(records, strings.Join(txt.Txt, ""))
+		}
+	}
+	return records, nil
+}
+
+// findZone walks up fqdn until a resolver answers with the SOA of the zone
+// that contains it.
+func findZone(fqdn string, resolvers []string) (string, error) {
+	if len(resolvers) == 0 {
+		resolvers = defaultResolvers
+	}
+
+	labels := dns.SplitDomainName(fqdn)
+	for i := range labels {
+		name := dns.Fqdn(strings.Join(labels[i:], "."))
+
+		msg := new(dns.Msg)
+		msg.SetQuestion(name, dns.TypeSOA)
+		msg.RecursionDesired = true
+
+		for _, resolver := range resolvers {
+			resp, _, err := new(dns.Client).Exchange(msg, resolver)
+			if err != nil || resp.Rcode != dns.RcodeSuccess {
+				continue
+			}
+			for _, rr := range resp.Answer {
+				if soa, ok := rr.(*dns.SOA); ok {
+					return soa.Hdr.Name, nil
+				}
+			}
+			break
+		}
+	}
+
+	return "", fmt.Errorf("could not find zone for %s", fqdn)
+}
+
+func challengeFQDN(domain string) string {
+	return dns.Fqdn("_acme-challenge." + strings.TrimPrefix(domain, "*."))
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
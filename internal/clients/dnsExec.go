@@ -0,0 +1,55 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	utils "ssl-manager/internal/utils"
+	"time"
+)
+
+// execProvider hands challenge records to an external script, called as
+//
+//	<path> present <fqdn> <value>
+//	<path> cleanup <fqdn> <value>
+type execProvider struct {
+	path     string
+	timeout  time.Duration
+	interval time.Duration
+}
+
+func newExecProvider(cfg *utils.Config) (*execProvider, error) {
+	if cfg.Certs.DNS.Exec.Path == "" {
+		return nil, errors.New("exec dns provider path is not configured")
+	}
+
+	return &execProvider{
+		path:     cfg.Certs.DNS.Exec.Path,
+		timeout:  cfg.Certs.DNS.PropagationTimeout,
+		interval: cfg.Certs.DNS.PollingInterval,
+	}, nil
+}
+
+func (p *execProvider) Present(domain, token, keyAuth string) error {
+	return p.run("present", challengeFQDN(domain), keyAuth)
+}
+
+func (p *execProvider) CleanUp(domain, token, keyAuth string) error {
+	return p.run("cleanup", challengeFQDN(domain), keyAuth)
+}
+
+func (p *execProvider) Timeout() (time.Duration, time.Duration) {
+	return p.timeout, p.interval
+}
+
+func (p *execProvider) run(action, fqdn, value string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, p.path, action, fqdn, value).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w: %s", p.path, action, err, out)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package clients
+
+import (
+	"errors"
+	"fmt"
+	utils "ssl-manager/internal/utils"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// rfc2136Provider manages challenge records through DNS UPDATE messages,
+// optionally signed with TSIG.
+type rfc2136Provider struct {
+	nameserver string
+	zone       string
+	tsigKey    string
+	tsigSecret string
+	tsigAlgo   string
+	ttl        uint32
+	resolvers  []string
+	timeout    time.Duration
+	interval   time.Duration
+}
+
+func newRFC2136Provider(cfg *utils.Config) (*rfc2136Provider, error) {
+	c := cfg.Certs.DNS.RFC2136
+	if c.Nameserver == "" {
+		return nil, errors.New("rfc2136 nameserver is not configured")
+	}
+	if (c.TSIGKey == "") != (c.TSIGSecret == "") {
+		return nil, errors.New("rfc2136 tsig_key and tsig_secret must be set together")
+	}
+
+	return &rfc2136Provider{
+		nameserver: c.Nameserver,
+		zone:       c.Zone,
+		tsigKey:    dns.Fqdn(c.TSIGKey),
+		tsigSecret: c.TSIGSecret,
+		tsigAlgo:   dns.Fqdn(c.TSIGAlgorithm),
+		ttl:        uint32(c.TTL),
+		resolvers:  cfg.Certs.DNS.Resolvers,
+		timeout:    cfg.Certs.DNS.PropagationTimeout,
+		interval:   cfg.Certs.DNS.PollingInterval,
+	}, nil
+}
+
+func (p *rfc2136Provider) Present(domain, token, keyAuth string) error {
+	return p.update(challengeFQDN(domain), keyAuth, true)
+}
+
+func (p *rfc2136Provider) CleanUp(domain, token, keyAuth string) error {
+	return p.update(challengeFQDN(domain), keyAuth, false)
+}
+
+func (p *rfc2136Provider) Timeout() (time.Duration, time.Duration) {
+	return p.timeout, p.interval
+}
+
+func (p *rfc2136Provider) update(fqdn, value string, insert bool) error {
+	zone := p.zone
+	if zone == "" {
+		var err error
+		zone, err = findZone(fqdn, p.resolvers)
+		if err != nil {
+			return err
+		}
+	}
+
+	rr := &dns.TXT{
+		Hdr: dns.RR_Header{Name: fqdn, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: p.ttl},
+		Txt: []string{value},
+	}
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(dns.Fqdn(zone))
+	if insert {
+		msg.Insert([]dns.RR{rr})
+	} else {
+		msg.Remove([]dns.RR{rr})
+	}
+
+	client := new(dns.Client)
+	if p.tsigSecret != "" {
+		msg.SetTsig(p.tsigKey, p.tsigAlgo, 300, time.Now().Unix())
+		client.TsigSecret = map[string]string{p.tsigKey: p.tsigSecret}
+	}
+
+	resp, _, err := client.Exchange(msg, p.nameserver)
+	if err != nil {
+		return fmt.Errorf("dns update to %s failed: %w", p.nameserver, err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("dns update to %s rejected: %s", p.nameserver, dns.RcodeToString[resp.Rcode])
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package clients
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	models "ssl-manager/internal/models"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+)
+
+// ErrEABRequired is returned when the CA's directory demands an External
+// Account Binding and no credentials were supplied.
+var ErrEABRequired = errors.New("ca requires external account binding but no eab credentials are configured")
+
+// EABError means the CA refused the External Account Binding.
+type EABError struct {
+	CA    string
+	KeyID string
+	Err   error
+}
+
+func (e *EABError) Error() string {
+	return fmt.Sprintf("ca %s rejected external account binding for key id %s: %v", e.CA, e.KeyID, e.Err)
+}
+
+func (e *EABError) Unwrap() error {
+	return e.Err
+}
+
+// externalAccountBinding picks the explicit credentials or falls back to the
+// ones configured for the CA, and checks them against the directory.
+func (ca *caClient) externalAccountBinding(ctx context.Context, ac *acme.Client, creds *models.EABCredentials) (*acme.ExternalAccountBinding, error) {
+	if creds == nil && ca.cfg.EABKeyID != "" {
+		creds = &models.EABCredentials{KeyID: ca.cfg.EABKeyID, HMACKey: ca.cfg.EABHMACKey}
+	}
+
+	dir, err := ac.Discover(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch directory: %w", err)
+	}
+
+	if creds == nil {
+		if dir.ExternalAccountRequired {
+			return nil, ErrEABRequired
+		}
+		return nil, nil
+	}
+
+	hmacKey, err := DecodeEABHMACKey(creds.HMACKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &acme.ExternalAccountBinding{KID: creds.KeyID, Key: hmacKey}, nil
+}
+
+// DecodeEABHMACKey decodes an EAB HMAC key as handed out by CAs: base64url,
+// with or without padding.
+func DecodeEABHMACKey(encoded string) ([]byte, error) {
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid eab hmac key: %w", err)
+	}
+	if len(key) == 0 {
+		return nil, errors.New("invalid eab hmac key: empty")
+	}
+	return key, nil
+}
+
+// isEABRejection tells whether a registration error is the CA refusing the
+// binding rather than some unrelated failure.
+func isEABRejection(err error) bool {
+	var problem *acme.Error
+	if !errors.As(err, &problem) {
+		return false
+	}
+	switch problem.ProblemType {
+	case "urn:ietf:params:acme:error:externalAccountRequired",
+		"urn:ietf:params:acme:error:unauthorized",
+		"urn:ietf:params:acme:error:malformed":
+		return true
+	}
+	return false
+}
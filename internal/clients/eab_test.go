@@ -0,0 +1,166 @@
+package clients
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	models "ssl-manager/internal/models"
+	utils "ssl-manager/internal/utils"
+	"testing"
+)
+
+// jws is a request body as ACME clients send it.
+type jws struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// fakeACME serves the directory of a fake CA, with meta, and nonces on
+// every response. Tests add the resources they need to the returned mux;
+// the directory points newAccount at /account and newOrder at /order.
+func fakeACME(t *testing.T, meta map[string]interface{}) (*httptest.Server, *http.ServeMux) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "nonce")
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("/directory", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"newNonce":   srv.URL + "/nonce",
+			"newAccount": srv.URL + "/account",
+			"newOrder":   srv.URL + "/order",
+			"meta":       meta,
+		})
+	})
+	mux.HandleFunc("/nonce", func(w http.ResponseWriter, r *http.Request) {})
+	return srv, mux
+}
+
+// acmeProblem answers with an RFC 8555 problem of type kind.
+func acmeProblem(w http.ResponseWriter, status int, kind, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"type": "urn:ietf:params:acme:error:" + kind, "detail": detail})
+}
+
+// acmePayload decodes the payload of the jws in r into v. The signature is
+// not checked.
+func acmePayload(r *http.Request, v interface{}) error {
+	var outer jws
+	if err := json.NewDecoder(r.Body).Decode(&outer); err != nil {
+		return err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(outer.Payload)
+	if err != nil || v == nil {
+		return err
+	}
+	return json.Unmarshal(payload, v)
+}
+
+// fakeEABCA is a stand-in for a CA such as Pebble run with
+// externalAccountRequired: it only registers accounts carrying a binding
+// signed with hmacKey under keyID.
+func fakeEABCA(t *testing.T, keyID string, hmacKey []byte) *httptest.Server {
+	t.Helper()
+	srv, mux := fakeACME(t, map[string]interface{}{"externalAccountRequired": true})
+
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		var account struct {
+			Binding *jws `json:"externalAccountBinding"`
+		}
+		if err := acmePayload(r, &account); err != nil {
+			acmeProblem(w, http.StatusBadRequest, "malformed", err.Error())
+			return
+		}
+		if account.Binding == nil {
+			acmeProblem(w, http.StatusForbidden, "externalAccountRequired", "no binding")
+			return
+		}
+
+		header, _ := base64.RawURLEncoding.DecodeString(account.Binding.Protected)
+		var protected struct {
+			Alg string `json:"alg"`
+			KID string `json:"kid"`
+		}
+		_ = json.Unmarshal(header, &protected)
+		mac := hmac.New(sha256.New, hmacKey)
+		mac.Write([]byte(account.Binding.Protected + "." + account.Binding.Payload))
+		signature, _ := base64.RawURLEncoding.DecodeString(account.Binding.Signature)
+		if protected.Alg != "HS256" || protected.KID != keyID || !hmac.Equal(signature, mac.Sum(nil)) {
+			acmeProblem(w, http.StatusForbidden, "unauthorized", "external account binding does not verify")
+			return
+		}
+
+		w.Header().Set("Location", srv.URL+"/account/1")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"status": "valid"})
+	})
+	return srv
+}
+
+func TestRegisterAccountEAB(t *testing.T) {
+	hmacKey := []byte("0123456789abcdef0123456789abcdef")
+	srv := fakeEABCA(t, "kid-1", hmacKey)
+
+	ca, err := newCAClient(utils.CAConfig{Name: "pebble", DirectoryURL: srv.URL + "/directory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{log: utils.NewLogger("error"), cas: map[string]*caClient{"pebble": ca}}
+
+	tests := []struct {
+		name    string
+		creds   *models.EABCredentials
+		wantErr error
+	}{
+		{
+			name:  "valid binding",
+			creds: &models.EABCredentials{KeyID: "kid-1", HMACKey: base64.RawURLEncoding.EncodeToString(hmacKey)},
+		},
+		{
+			name:    "wrong hmac key",
+			creds:   &models.EABCredentials{KeyID: "kid-1", HMACKey: base64.RawURLEncoding.EncodeToString([]byte("not the key"))},
+			wantErr: &EABError{},
+		},
+		{
+			name:    "unknown key id",
+			creds:   &models.EABCredentials{KeyID: "kid-2", HMACKey: base64.RawURLEncoding.EncodeToString(hmacKey)},
+			wantErr: &EABError{},
+		},
+		{
+			name:    "no binding",
+			wantErr: ErrEABRequired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := c.RegisterAccount(t.Context(), "pebble", []string{"admin@example.com"}, tt.creds)
+			switch want := tt.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("RegisterAccount: %v", err)
+				}
+				if data.URL != srv.URL+"/account/1" || data.EABKeyID != "kid-1" || !data.EABRequired {
+					t.Errorf("got url %q, key id %q, eab required %v", data.URL, data.EABKeyID, data.EABRequired)
+				}
+			case *EABError:
+				if !errors.As(err, &want) {
+					t.Fatalf("got %v, want an EABError", err)
+				}
+			default:
+				if !errors.Is(err, want) {
+					t.Fatalf("got %v, want %v", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	envelope "ssl-manager/internal/envelope"
+	models "ssl-manager/internal/models"
+	storage "ssl-manager/internal/storage"
+	utils "ssl-manager/internal/utils"
+)
+
+// sealedFiles are the stored files holding a private key: key.pem and the
+// exports of every format including it. With certs.encryption configured
+// they are written sealed and only ever decrypted in memory or into the
+// deploy dir.
+var sealedFiles = func() map[string]bool {
+	sealed := map[string]bool{"key.pem": true}
+	for format, file := range exportFiles {
+		if utils.ExportFormatNeedsKey(format) {
+			sealed[file] = true
+		}
+	}
+	return sealed
+}()
+
+// seal encrypts the contents of file when it holds a private key and
+// encryption is configured.
+func (c *Client) seal(ctx context.Context, file string, data []byte) ([]byte, error) {
+	if c.sealer == nil || !sealedFiles[file] || len(data) == 0 {
+		return data, nil
+	}
+	sealed, err := c.sealer.Seal(ctx, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt %s: %w", file, err)
+	}
+	return sealed, nil
+}
+
+// readFile reads a stored file and decrypts it when it was sealed. Files
+// written before encryption was configured are returned as they are.
+func (c *Client) readFile(ctx context.Context, ref string) ([]byte, error) {
+	data, err := c.store.Read(ctx, ref)
+	if err != nil || !envelope.IsSealed(data) {
+		return data, err
+	}
+	if c.sealer == nil {
+		return nil, envelope.ErrNoKEK
+	}
+	return c.sealer.Open(ctx, data)
+}
+
+// SealAccountKey encrypts an acme account key for the acme_accounts table.
+// It is sealed like the stored private keys when encryption is configured,
+// and encrypted with certs.account_key_secret otherwise.
+func (c *Client) SealAccountKey(ctx context.Context, keyPEM []byte) (string, error) {
+	if c.sealer == nil {
+		return utils.EncryptWithSecret(c.cfg.Certs.AccountKeySecret, keyPEM)
+	}
+	sealed, err := c.sealer.Seal(ctx, keyPEM)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt account key: %w", err)
+	}
+	return string(sealed), nil
+}
+
+// OpenAccountKey decrypts an account key stored by SealAccountKey, whether
+// it was sealed or encrypted with certs.account_key_secret.
+func (c *Client) OpenAccountKey(ctx context.Context, stored string) ([]byte, error) {
+	if !envelope.IsSealed([]byte(stored)) {
+		return utils.DecryptWithSecret(c.cfg.Certs.AccountKeySecret, stored)
+	}
+	if c.sealer == nil {
+		return nil, envelope.ErrNoKEK
+	}
+	return c.sealer.Open(ctx, []byte(stored))
+}
+
+// RewrapAccountKey is RewrapKeys for an account key stored by
+// SealAccountKey, counted in resp. Keys encrypted with
+// certs.account_key_secret are sealed. The bool is false when the key was
+// already wrapped with the current KEK.
+func (c *Client) RewrapAccountKey(ctx context.Context, stored string, resp *models.KeyRotationResp) (string, bool, error) {
+	if c.sealer == nil {
+		return "", false, envelope.ErrNoKEK
+	}
+
+	if envelope.IsSealed([]byte(stored)) {
+		rewrapped, changed, err := c.sealer.Rewrap(ctx, []byte(stored))
+		if err != nil {
+			return "", false, err
+		}
+		if changed {
+			resp.Rewrapped++
+		} else {
+			resp.Unchanged++
+		}
+		return string(rewrapped), changed, nil
+	}
+
+	keyPEM, err := utils.DecryptWithSecret(c.cfg.Certs.AccountKeySecret, stored)
+	if err != nil {
+		return "", false, err
+	}
+	sealed, err := c.sealer.Seal(ctx, keyPEM)
+	if err != nil {
+		return "", false, err
+	}
+	resp.Encrypted++
+	return string(sealed), true, nil
+}
+
+// RewrapKeys wraps the data key of every stored private key with the
+// current KEK, and encrypts the keys stored before encryption was
+// configured.
+func (c *Client) RewrapKeys(ctx context.Context) (*models.KeyRotationResp, error) {
+	if c.sealer == nil {
+		return nil, envelope.ErrNoKEK
+	}
+
+	refs, err := c.store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored files: %w", err)
+	}
+
+	resp := &models.KeyRotationResp{}
+	for _, ref := range refs {
+		if !sealedFiles[storage.FileName(ref)] {
+			continue
+		}
+		data, err := c.store.Read(ctx, ref)
+		if err != nil {
+			return resp, fmt.Errorf("failed to read %s: %w", ref, err)
+		}
+
+		var changed bool
+		if envelope.IsSealed(data) {
+			data, changed, err = c.sealer.Rewrap(ctx, data)
+			if changed {
+				resp.Rewrapped++
+			}
+		} else {
+			data, err = c.sealer.Seal(ctx, data)
+			changed = true
+			resp.Encrypted++
+		}
+		if err != nil {
+			return resp, fmt.Errorf("failed to re-wrap %s: %w", ref, err)
+		}
+		if !changed {
+			resp.Unchanged++
+			continue
+		}
+		if err := c.store.Update(ctx, ref, data); err != nil {
+			return resp, fmt.Errorf("failed to update %s: %w", ref, err)
+		}
+	}
+	return resp, nil
+}
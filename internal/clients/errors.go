@@ -0,0 +1,83 @@
+package clients
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/acme"
+)
+
+// Step names the stage of an ACME order an error happened in.
+type Step string
+
+const (
+	StepAccount       Step = "account"
+	StepOrder         Step = "order"
+	StepAuthorization Step = "authorization"
+	StepChallenge     Step = "challenge"
+	StepFinalize      Step = "finalize"
+	StepDownload      Step = "download"
+	StepRevoke        Step = "revoke"
+)
+
+// ACMEError is returned by every step of the order flow.
+type ACMEError struct {
+	Step   Step
+	CA     string
+	Domain string
+	Err    error
+}
+
+func (e *ACMEError) Error() string {
+	if e.Domain == "" {
+		return fmt.Sprintf("acme %s failed with ca %s: %v", e.Step, e.CA, e.Err)
+	}
+	return fmt.Sprintf("acme %s failed for %s with ca %s: %v", e.Step, e.Domain, e.CA, e.Err)
+}
+
+func (e *ACMEError) Unwrap() error {
+	return e.Err
+}
+
+// Metadata flattens the error into a form suitable for events.metadata.
+func (e *ACMEError) Metadata() map[string]interface{} {
+	meta := map[string]interface{}{
+		"step":   e.Step,
+		"ca":     e.CA,
+		"domain": e.Domain,
+		"error":  e.Err.Error(),
+	}
+
+	var problem *acme.Error
+	if errors.As(e.Err, &problem) {
+		meta["status_code"] = problem.StatusCode
+		meta["problem_type"] = problem.ProblemType
+		meta["detail"] = problem.Detail
+		if len(problem.Subproblems) > 0 {
+			meta["subproblems"] = problem.Subproblems
+		}
+	}
+
+	var authzErr *acme.AuthorizationError
+	if errors.As(e.Err, &authzErr) {
+		meta["authorization_url"] = authzErr.URI
+		meta["identifier"] = authzErr.Identifier
+	}
+
+	var eabErr *EABError
+	if errors.As(e.Err, &eabErr) {
+		meta["eab_key_id"] = eabErr.KeyID
+	}
+
+	var orderErr *acme.OrderError
+	if errors.As(e.Err, &orderErr) {
+		meta["order_url"] = orderErr.OrderURL
+		meta["order_status"] = orderErr.Status
+	}
+
+	if retryAfter, ok := acme.RateLimit(e.Err); ok {
+		meta["retry_after"] = retryAfter.String()
+	}
+
+	return meta
+}
@@ -0,0 +1,119 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	certificates "ssl-manager/internal/certificates"
+	models "ssl-manager/internal/models"
+	storage "ssl-manager/internal/storage"
+	utils "ssl-manager/internal/utils"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// exportFiles are the names export formats are stored under, next to
+// cert.pem. pem and fullchain are always stored by SaveCertificateFiles.
+var exportFiles = map[string]string{
+	utils.ExportFormatCombined:     "combined.pem",
+	utils.ExportFormatPKCS12:       "cert.p12",
+	utils.ExportFormatPKCS12Legacy: "cert-legacy.p12",
+	utils.ExportFormatDER:          "cert.der",
+}
+
+var errNoKey = errors.New("certificate was issued for a supplied csr, its key is not on file")
+
+// ExportCertificate renders the stored certificate in format. password
+// protects PKCS#12 output.
+func (c *Client) ExportCertificate(ctx context.Context, paths models.CertificatePaths, format, password string) (*models.CertificateExport, error) {
+	certPEM, err := c.store.Read(ctx, paths.Cert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	var chainPEM []byte
+	if paths.Chain != "" {
+		chainPEM, err = c.store.Read(ctx, paths.Chain)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("failed to read chain: %w", err)
+		}
+	}
+
+	var keyPEM []byte
+	if utils.ExportFormatNeedsKey(format) {
+		if paths.Key == "" {
+			return nil, errNoKey
+		}
+		if keyPEM, err = c.readFile(ctx, paths.Key); err != nil {
+			return nil, fmt.Errorf("failed to read key: %w", err)
+		}
+	}
+
+	material, err := certificates.Parse(certPEM, keyPEM, chainPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	name := "certificate"
+	if names := material.Names(); len(names) > 0 {
+		name = strings.ReplaceAll(names[0], "*", "_")
+	}
+	switch format {
+	case utils.ExportFormatPEM:
+		return &models.CertificateExport{Data: material.CertPEM(), ContentType: "application/x-pem-file", FileName: name + ".pem"}, nil
+
+	case utils.ExportFormatFullchain:
+		return &models.CertificateExport{Data: material.FullchainPEM(), ContentType: "application/x-pem-file", FileName: name + ".fullchain.pem"}, nil
+
+	case utils.ExportFormatCombined:
+		// HAProxy reads the chain and the key from one file
+		keyPEM, err := material.KeyPEM()
+		if err != nil {
+			return nil, err
+		}
+		data := append(material.FullchainPEM(), keyPEM...)
+		return &models.CertificateExport{Data: data, ContentType: "application/x-pem-file", FileName: name + ".combined.pem"}, nil
+
+	case utils.ExportFormatPKCS12, utils.ExportFormatPKCS12Legacy:
+		encoder := pkcs12.Modern2023
+		if format == utils.ExportFormatPKCS12Legacy {
+			// readable by Java 8 keytool and older Windows
+			encoder = pkcs12.LegacyDES
+		}
+		data, err := encoder.Encode(material.Key, material.Leaf, material.Intermediates, password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode pkcs12: %w", err)
+		}
+		return &models.CertificateExport{Data: data, ContentType: "application/x-pkcs12", FileName: name + ".p12"}, nil
+
+	case utils.ExportFormatDER:
+		return &models.CertificateExport{Data: material.Leaf.Raw, ContentType: "application/pkix-cert", FileName: name + ".der"}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+// WriteExportFiles stores formats with the certificate version paths belong
+// to.
+func (c *Client) WriteExportFiles(ctx context.Context, paths models.CertificatePaths, formats []string, password string) error {
+	files := map[string][]byte{}
+	for _, format := range formats {
+		file, ok := exportFiles[format]
+		if !ok {
+			continue
+		}
+
+		export, err := c.ExportCertificate(ctx, paths, format, password)
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %w", format, err)
+		}
+		if files[file], err = c.seal(ctx, file, export.Data); err != nil {
+			return err
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	return c.store.Attach(ctx, paths.Cert, files)
+}
@@ -0,0 +1,84 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	utils "ssl-manager/internal/utils"
+	"sync"
+)
+
+const http01PathPrefix = "/.well-known/acme-challenge/"
+
+// http01Responder keeps pending tokens in memory; they are served by the
+// /.well-known/acme-challenge/ route.
+type http01Responder struct {
+	mu     sync.RWMutex
+	tokens map[string]string
+}
+
+func newHTTP01Responder() *http01Responder {
+	return &http01Responder{tokens: make(map[string]string)}
+}
+
+func (r *http01Responder) Present(ctx context.Context, domain, token, keyAuth string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[token] = keyAuth
+	return nil
+}
+
+func (r *http01Responder) CleanUp(ctx context.Context, domain, token, keyAuth string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tokens, token)
+	return nil
+}
+
+func (r *http01Responder) lookup(token string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	keyAuth, ok := r.tokens[token]
+	return keyAuth, ok
+}
+
+// http01Webroot writes tokens under a directory that an existing web server
+// already serves.
+type http01Webroot struct {
+	dir string
+}
+
+func newHTTP01Webroot(cfg *utils.Config) (*http01Webroot, error) {
+	if cfg.Certs.HTTP01.Webroot == "" {
+		return nil, fmt.Errorf("http-01 webroot is not configured")
+	}
+	return &http01Webroot{dir: filepath.Join(cfg.Certs.HTTP01.Webroot, filepath.FromSlash(http01PathPrefix))}, nil
+}
+
+func (w *http01Webroot) Present(ctx context.Context, domain, token, keyAuth string) error {
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create webroot challenge dir: %w", err)
+	}
+	// must be world-readable for the web server serving it
+	if err := os.WriteFile(filepath.Join(w.dir, token), []byte(keyAuth), 0644); err != nil {
+		return fmt.Errorf("failed to write challenge token: %w", err)
+	}
+	return nil
+}
+
+func (w *http01Webroot) CleanUp(ctx context.Context, domain, token, keyAuth string) error {
+	err := os.Remove(filepath.Join(w.dir, token))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove challenge token: %w", err)
+	}
+	return nil
+}
+
+// HTTP01Response returns the key authorization for a pending http-01 token.
+func (c *Client) HTTP01Response(token string) (string, bool) {
+	if c.http01 == nil {
+		return "", false
+	}
+	return c.http01.lookup(token)
+}
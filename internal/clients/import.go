@@ -0,0 +1,69 @@
+package clients
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	certificates "ssl-manager/internal/certificates"
+	models "ssl-manager/internal/models"
+	"time"
+)
+
+// ReadCertbotLive reads the certificate, key and intermediates of one
+// certbot live/<name> directory. ssl-import runs it on the machine holding
+// the directory, the server never reads keys from paths it is sent.
+func ReadCertbotLive(dir string) (certPEM, keyPEM, chainPEM []byte, err error) {
+	if certPEM, err = os.ReadFile(filepath.Join(dir, "cert.pem")); err != nil {
+		return nil, nil, nil, err
+	}
+	if keyPEM, err = os.ReadFile(filepath.Join(dir, "privkey.pem")); err != nil {
+		return nil, nil, nil, err
+	}
+	if chainPEM, err = os.ReadFile(filepath.Join(dir, "chain.pem")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil, err
+	}
+	return certPEM, keyPEM, chainPEM, nil
+}
+
+// ParseCertificateBundle turns existing PEM material into certificate data.
+// certPEM starts with the leaf and may carry the intermediates itself;
+// chainPEM may be the intermediates or the full chain. The key must belong to
+// the leaf. The issuer recorded is the configured CA whose roots verify the
+// chain, preferredCA when it does, else the first in config order. A chain
+// that no configured CA verifies is only logged, as imported certificates
+// may come from private CAs, and its issuer is marked external so it is
+// never revoked through ACME. The names the certificate covers are returned
+// with it.
+func (c *Client) ParseCertificateBundle(certPEM, keyPEM, chainPEM []byte, preferredCA string) (*models.CertificateData, []string, error) {
+	if len(keyPEM) == 0 {
+		return nil, nil, errors.New("private key is required")
+	}
+
+	material, err := certificates.Parse(certPEM, keyPEM, chainPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := c.CANames()
+	if c.HasCA(preferredCA) {
+		names = append([]string{preferredCA}, names...)
+	}
+	issuer := ""
+	var verifyErr error
+	for _, name := range names {
+		if verifyErr = material.Verify(c.cas[name].roots, time.Now()); verifyErr == nil {
+			issuer = name
+			break
+		}
+	}
+	if issuer == "" {
+		c.log.Warn("Importing certificate for ", material.Names(), ": ", verifyErr)
+		issuer = models.ExternalIssuerPrefix + material.Leaf.Issuer.CommonName
+	}
+
+	data, err := certificateData(issuer, material)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, material.Names(), nil
+}
@@ -0,0 +1,111 @@
+package clients
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	certificates "ssl-manager/internal/certificates"
+	utils "ssl-manager/internal/utils"
+)
+
+// defaultCAKeyTypes are accepted by a CA that does not list key_types.
+// Most public CAs reject Ed25519 certificate keys.
+var defaultCAKeyTypes = []string{
+	utils.KeyTypeRSA2048, utils.KeyTypeRSA3072, utils.KeyTypeRSA4096,
+	utils.KeyTypeECDSAP256, utils.KeyTypeECDSAP384,
+}
+
+// CASupportsKeyType reports whether caName issues certificates for keyType.
+func (c *Client) CASupportsKeyType(caName, keyType string) bool {
+	ca, ok := c.cas[caName]
+	if !ok {
+		return false
+	}
+	allowed := ca.cfg.KeyTypes
+	if len(allowed) == 0 {
+		allowed = defaultCAKeyTypes
+	}
+	return containsString(allowed, keyType)
+}
+
+func generateKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case utils.KeyTypeRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case utils.KeyTypeRSA3072:
+		return rsa.GenerateKey(rand.Reader, 3072)
+	case utils.KeyTypeRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case "", utils.KeyTypeECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case utils.KeyTypeECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case utils.KeyTypeEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", keyType)
+	}
+}
+
+// keyTypeOf names the key type of key, or returns "" for anything
+// generateKey cannot produce.
+func keyTypeOf(key crypto.Signer) string {
+	return keyTypeOfPublic(key.Public())
+}
+
+func keyTypeOfPublic(pub crypto.PublicKey) string {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		switch k.N.BitLen() {
+		case 2048:
+			return utils.KeyTypeRSA2048
+		case 3072:
+			return utils.KeyTypeRSA3072
+		case 4096:
+			return utils.KeyTypeRSA4096
+		}
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return utils.KeyTypeECDSAP256
+		case elliptic.P384():
+			return utils.KeyTypeECDSAP384
+		}
+	case ed25519.PublicKey:
+		return utils.KeyTypeEd25519
+	}
+	return ""
+}
+
+// certificateKey reuses the key at keyPath when it has the requested type
+// and generates a new one otherwise.
+func (c *Client) certificateKey(ctx context.Context, keyType, keyPath string) (crypto.Signer, error) {
+	if keyType == "" {
+		keyType = utils.KeyTypeECDSAP256
+	}
+	if keyPath == "" {
+		return generateKey(keyType)
+	}
+
+	data, err := c.readFile(ctx, keyPath)
+	if err != nil {
+		c.log.Warn("Cannot reuse key ", keyPath, ", generating a new one: ", err)
+		return generateKey(keyType)
+	}
+	key, err := certificates.ParsePrivateKey(data)
+	if err != nil {
+		c.log.Warn("Cannot reuse key ", keyPath, ", generating a new one: ", err)
+		return generateKey(keyType)
+	}
+	if keyTypeOf(key) != keyType {
+		c.log.Info("Key ", keyPath, " is not ", keyType, ", generating a new one")
+		return generateKey(keyType)
+	}
+	return key, nil
+}
@@ -0,0 +1,58 @@
+package clients
+
+import (
+	"context"
+	"crypto"
+	"encoding/pem"
+	"fmt"
+	certificates "ssl-manager/internal/certificates"
+
+	"golang.org/x/crypto/acme"
+)
+
+// RevokeCertificate revokes the certificate stored at certPath with caName.
+// When keyPath is set the request is signed with the certificate key instead
+// of the account key, which works even if the certificate was issued to a
+// different account.
+func (c *Client) RevokeCertificate(ctx context.Context, caName, certPath, keyPath string, reason int) error {
+	ca, err := c.ca(caName)
+	if err != nil {
+		return err
+	}
+
+	certPEM, err := c.store.Read(ctx, certPath)
+	if err != nil {
+		return fmt.Errorf("failed to read certificate: %w", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return fmt.Errorf("no certificate found in %s", certPath)
+	}
+
+	var (
+		ac  *acme.Client
+		key crypto.Signer
+	)
+	if keyPath != "" {
+		keyPEM, err := c.readFile(ctx, keyPath)
+		if err != nil {
+			return fmt.Errorf("failed to read certificate key: %w", err)
+		}
+		key, err = certificates.ParsePrivateKey(keyPEM)
+		if err != nil {
+			return fmt.Errorf("failed to parse certificate key: %w", err)
+		}
+		ac = ca.newACMEClient(key, "")
+	} else {
+		ac, err = ca.active()
+		if err != nil {
+			return &ACMEError{Step: StepRevoke, CA: caName, Err: err}
+		}
+	}
+
+	if err := ac.RevokeCert(ctx, key, block.Bytes, acme.CRLReasonCode(reason)); err != nil {
+		return &ACMEError{Step: StepRevoke, CA: caName, Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package clients
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	certificates "ssl-manager/internal/certificates"
+	models "ssl-manager/internal/models"
+	"time"
+)
+
+// VerifyServedCertificate connects to address with serverName as SNI and
+// compares the leaf served there with the expected serial and sha-256
+// fingerprint. The served chain must verify on its own against the roots
+// of a configured CA, so a missing intermediate is caught as well.
+func (c *Client) VerifyServedCertificate(ctx context.Context, address, serverName, serial, fingerprint string) models.TLSVerification {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "443")
+	}
+
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: 10 * time.Second},
+		// verified below, against the expected certificate
+		Config: &tls.Config{ServerName: serverName, InsecureSkipVerify: true},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return models.TLSVerification{Status: models.TLSVerificationUnreachable, Error: err.Error()}
+	}
+	defer conn.Close()
+
+	served := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(served) == 0 {
+		return models.TLSVerification{Status: models.TLSVerificationUnreachable, Error: "no certificate served"}
+	}
+	sum := sha256.Sum256(served[0].Raw)
+	result := models.TLSVerification{
+		Serial:      served[0].SerialNumber.Text(16),
+		Fingerprint: hex.EncodeToString(sum[:]),
+	}
+
+	if result.Fingerprint != fingerprint {
+		result.Status = models.TLSVerificationMismatch
+		result.Error = fmt.Sprintf("%s serves serial %s, expected %s", address, result.Serial, serial)
+		return result
+	}
+
+	material := &certificates.Material{Leaf: served[0], Intermediates: served[1:]}
+	var verifyErr error
+	for _, ca := range c.cas {
+		if verifyErr = material.Verify(ca.roots, time.Now()); verifyErr == nil {
+			break
+		}
+	}
+	if verifyErr != nil {
+		result.Status = models.TLSVerificationIncompleteChain
+		result.Error = verifyErr.Error()
+		return result
+	}
+
+	result.Status = models.TLSVerificationOK
+	return result
+}
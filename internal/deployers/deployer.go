@@ -0,0 +1,182 @@
+// Package deployers hands a freshly issued certificate to the services that
+// use it: copying the files into place and reloading the server. A domain
+// runs its deployers in order after every issuance.
+package deployers
+
+import (
+	"context"
+	"fmt"
+	docker "ssl-manager/internal/docker"
+	models "ssl-manager/internal/models"
+	sds "ssl-manager/internal/sds"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	TypeDocker     = "docker"
+	TypeSystemd    = "systemd"
+	TypeCommand    = "command"
+	TypeWebhook    = "webhook"
+	TypeFile       = "file"
+	TypeKubernetes = "kubernetes"
+	TypeHAProxy    = "haproxy"
+	TypeEnvoy      = "envoy"
+)
+
+// domainPlaceholder stands for the domain in configured deployers.
+const domainPlaceholder = "{domain}"
+
+type Deployer interface {
+	// Name identifies the deployer in events, e.g. "docker:nginx".
+	Name() string
+	// Deploy installs cert on the target and returns what the target
+	// printed, also when it fails.
+	Deploy(ctx context.Context, cert *Certificate) (string, error)
+}
+
+// Certificate is the current certificate of a domain with its files
+// decrypted, keyed by name: cert.pem, key.pem (absent for supplied csrs),
+// chain.pem, fullchain.pem and the configured exports.
+type Certificate struct {
+	Domain      string
+	Files       map[string][]byte
+	Serial      string
+	Fingerprint string // hex sha-256 of the leaf
+	NotAfter    time.Time
+}
+
+// Fullchain is the leaf followed by the intermediates, put together for
+// certificates stored before fullchain.pem was written.
+func (c *Certificate) Fullchain() []byte {
+	if fullchain, ok := c.Files["fullchain.pem"]; ok {
+		return fullchain
+	}
+	return append(append([]byte{}, c.Files["cert.pem"]...), c.Files["chain.pem"]...)
+}
+
+// Builder creates deployers from their configs, handing them the clients
+// they share.
+type Builder struct {
+	docker  *docker.Client
+	kube    kubernetes.Interface
+	sds     *sds.Server
+	targets map[string]models.DeployerConfig
+}
+
+// NewBuilder takes the clients deployers need, kube is nil when
+// kubernetes is not configured and sds when envoy sds is not. targets are
+// the deployers of the config, checked here so a typo fails at startup.
+func NewBuilder(docker *docker.Client, kube kubernetes.Interface, sds *sds.Server, targets map[string]models.DeployerConfig) (*Builder, error) {
+	b := &Builder{docker: docker, kube: kube, sds: sds, targets: targets}
+	for name, cfg := range targets {
+		if _, err := b.build(cfg); err != nil {
+			return nil, fmt.Errorf("deployer %s: %w", name, err)
+		}
+	}
+	return b, nil
+}
+
+// SDS is the envoy sds server, nil when it is not configured.
+func (b *Builder) SDS() *sds.Server {
+	return b.sds
+}
+
+// New creates the deployer cfg describes for domain, the configured one
+// for a target.
+func (b *Builder) New(cfg models.DeployerConfig, domain string) (Deployer, error) {
+	cfg, err := b.Resolve(cfg, domain)
+	if err != nil {
+		return nil, err
+	}
+	return b.build(cfg)
+}
+
+// Resolve returns the config of the deployer cfg names, or cfg itself when
+// it names none. {domain} in the path and secret of a configured deployer
+// is replaced by domain, so one deployer serves many domains.
+func (b *Builder) Resolve(cfg models.DeployerConfig, domain string) (models.DeployerConfig, error) {
+	if cfg.Target == "" {
+		return cfg, nil
+	}
+	target, ok := b.targets[cfg.Target]
+	if !ok {
+		return cfg, fmt.Errorf("unknown deployer %q", cfg.Target)
+	}
+	target.Path = strings.ReplaceAll(target.Path, domainPlaceholder, domain)
+	target.Secret = strings.ReplaceAll(target.Secret, domainPlaceholder, domain)
+	return target, nil
+}
+
+// Pipeline turns the deployer names a domain is created with into its
+// pipeline. Only configured deployers can be named, commands, paths and
+// addresses never come from the api.
+func (b *Builder) Pipeline(names []string) ([]models.DeployerConfig, error) {
+	var cfgs []models.DeployerConfig
+	for i, name := range names {
+		if _, ok := b.targets[name]; !ok {
+			return nil, fmt.Errorf("deployer %d: unknown deployer %q", i+1, name)
+		}
+		cfgs = append(cfgs, models.DeployerConfig{Target: name})
+	}
+	return cfgs, nil
+}
+
+func (b *Builder) build(cfg models.DeployerConfig) (Deployer, error) {
+	switch cfg.Type {
+	case TypeDocker:
+		if cfg.Container == "" {
+			return nil, fmt.Errorf("docker deployer needs a container")
+		}
+		if cfg.Signal != "" && len(cfg.Command) > 0 {
+			return nil, fmt.Errorf("docker deployer takes either a command or a signal")
+		}
+		return NewDockerExec(b.docker, cfg.Container, cfg.Command, cfg.Signal, cfg.Test), nil
+	case TypeSystemd:
+		if cfg.Unit == "" {
+			return nil, fmt.Errorf("systemd deployer needs a unit")
+		}
+		return NewSystemdReload(cfg.Unit, cfg.Test), nil
+	case TypeCommand:
+		if len(cfg.Command) == 0 {
+			return nil, fmt.Errorf("command deployer needs a command")
+		}
+		return NewCommand(cfg.Command, cfg.Test), nil
+	case TypeWebhook:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("webhook deployer needs a url")
+		}
+		return NewWebhook(cfg.URL, cfg.Headers), nil
+	case TypeFile:
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("file deployer needs a path")
+		}
+		return NewFileCopy(cfg.Path, cfg.Files), nil
+	case TypeKubernetes:
+		if cfg.Secret == "" {
+			return nil, fmt.Errorf("kubernetes deployer needs a secret")
+		}
+		return NewKubernetesSecret(b.kube, cfg.Namespace, cfg.Secret), nil
+	case TypeHAProxy:
+		if cfg.Socket == "" || cfg.Path == "" {
+			return nil, fmt.Errorf("haproxy deployer needs a socket and a path")
+		}
+		return NewHAProxyRuntime(cfg.Socket, cfg.Path), nil
+	case TypeEnvoy:
+		return NewEnvoySDS(b.sds, cfg.Secret), nil
+	}
+	return nil, fmt.Errorf("unknown deployer type %q", cfg.Type)
+}
+
+// Validate checks a pipeline discovery built before it is stored.
+func Validate(cfgs []models.DeployerConfig) error {
+	var b Builder
+	for i, cfg := range cfgs {
+		if _, err := b.New(cfg, ""); err != nil {
+			return fmt.Errorf("deployer %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package deployers
+
+import (
+	models "ssl-manager/internal/models"
+	"strings"
+	"testing"
+)
+
+func TestNewBuilderChecksTargets(t *testing.T) {
+	if _, err := NewBuilder(nil, nil, nil, map[string]models.DeployerConfig{
+		"nginx": {Type: TypeCommand, Command: []string{"nginx", "-s", "reload"}},
+		"certs": {Type: TypeFile, Path: "/etc/nginx/certs"},
+	}); err != nil {
+		t.Fatalf("NewBuilder: %v", err)
+	}
+
+	_, err := NewBuilder(nil, nil, nil, map[string]models.DeployerConfig{
+		"broken": {Type: TypeFile},
+	})
+	if err == nil || !strings.Contains(err.Error(), "deployer broken") {
+		t.Errorf("NewBuilder with a file deployer without path: %v", err)
+	}
+}
+
+func TestBuilderPipeline(t *testing.T) {
+	b, err := NewBuilder(nil, nil, nil, map[string]models.DeployerConfig{
+		"nginx": {Type: TypeSystemd, Unit: "nginx.service"},
+		"certs": {Type: TypeFile, Path: "/etc/nginx/certs/{domain}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pipeline, err := b.Pipeline([]string{"certs", "nginx"})
+	if err != nil {
+		t.Fatalf("Pipeline: %v", err)
+	}
+	// only the names are stored, the config stays with the operator
+	want := []models.DeployerConfig{{Target: "certs"}, {Target: "nginx"}}
+	if len(pipeline) != len(want) || pipeline[0].Target != want[0].Target || pipeline[1].Target != want[1].Target {
+		t.Fatalf("pipeline = %+v, want %+v", pipeline, want)
+	}
+	for i, name := range []string{"file:/etc/nginx/certs/example.com", "systemd:nginx.service"} {
+		deployer, err := b.New(pipeline[i], "example.com")
+		if err != nil {
+			t.Fatalf("New %s: %v", pipeline[i].Target, err)
+		}
+		if deployer.Name() != name {
+			t.Errorf("deployer %d is %s, want %s", i, deployer.Name(), name)
+		}
+	}
+
+	if _, err := b.Pipeline([]string{"certs", "/usr/bin/id"}); err == nil || !strings.Contains(err.Error(), "deployer 2") {
+		t.Errorf("Pipeline with an unknown name: %v", err)
+	}
+	if _, err := b.New(models.DeployerConfig{Target: "gone"}, "example.com"); err == nil {
+		t.Error("New with a target removed from the config succeeded")
+	}
+}
+
+func TestBuilderResolve(t *testing.T) {
+	envoy := models.DeployerConfig{Type: TypeEnvoy, Secret: "shop-{domain}"}
+	b, err := NewBuilder(nil, nil, nil, map[string]models.DeployerConfig{"envoy": envoy})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := b.Resolve(models.DeployerConfig{Target: "envoy"}, "example.com")
+	if err != nil || cfg.Type != TypeEnvoy || cfg.Secret != "shop-example.com" {
+		t.Errorf("Resolve target = %+v, %v", cfg, err)
+	}
+	if b.targets["envoy"].Secret != "shop-{domain}" {
+		t.Error("Resolve changed the configured deployer")
+	}
+	// discovery pipelines are stored whole
+	inline := models.DeployerConfig{Type: TypeDocker, Container: "web", Signal: "SIGHUP"}
+	if cfg, err := b.Resolve(inline, "example.com"); err != nil || cfg.Container != "web" {
+		t.Errorf("Resolve inline = %+v, %v", cfg, err)
+	}
+}
@@ -0,0 +1,75 @@
+package deployers
+
+import (
+	"context"
+	"fmt"
+	docker "ssl-manager/internal/docker"
+	"strings"
+)
+
+// DockerExec reloads a container through the Docker Engine API, either by
+// running a command in it, by default `nginx -s reload`, or by sending its
+// main process a signal. When set, test runs in the container first and
+// the reload is skipped unless it succeeds; the default reload is tested
+// with `nginx -t`.
+type DockerExec struct {
+	docker    *docker.Client
+	container string
+	command   []string
+	signal    string
+	test      []string
+}
+
+func NewDockerExec(client *docker.Client, container string, command []string, signal string, test []string) *DockerExec {
+	if len(command) == 0 && signal == "" {
+		command = []string{"nginx", "-s", "reload"}
+		if len(test) == 0 {
+			test = []string{"nginx", "-t"}
+		}
+	}
+	return &DockerExec{docker: client, container: container, command: command, signal: signal, test: test}
+}
+
+func (d *DockerExec) Name() string {
+	return TypeDocker + ":" + d.container
+}
+
+func (d *DockerExec) Deploy(ctx context.Context, cert *Certificate) (string, error) {
+	if d.docker == nil {
+		return "", fmt.Errorf("docker is not configured")
+	}
+	container, err := d.docker.RunningContainer(ctx, d.container)
+	if err != nil {
+		return "", err
+	}
+
+	var output []string
+	if len(d.test) > 0 {
+		out, err := d.exec(ctx, container.ID, d.test)
+		output = append(output, out)
+		if err != nil {
+			return joinOutput(output), fmt.Errorf("config test failed, not reloading: %w", err)
+		}
+	}
+
+	if d.signal != "" {
+		if err := d.docker.Signal(ctx, container.ID, d.signal); err != nil {
+			return joinOutput(output), fmt.Errorf("failed to send %s: %w", d.signal, err)
+		}
+		return joinOutput(append(output, "sent "+d.signal)), nil
+	}
+
+	out, err := d.exec(ctx, container.ID, d.command)
+	return joinOutput(append(output, out)), err
+}
+
+func (d *DockerExec) exec(ctx context.Context, container string, command []string) (string, error) {
+	result, err := d.docker.Exec(ctx, container, command)
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		return result.Output, fmt.Errorf("%s exited with code %d", strings.Join(command, " "), result.ExitCode)
+	}
+	return result.Output, nil
+}
@@ -0,0 +1,143 @@
+package deployers
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	docker "ssl-manager/internal/docker"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDocker runs execs in the running container nginx with the exit code
+// and output configured per command.
+type fakeDocker struct {
+	results map[string]fakeExec // by command line
+
+	mu      sync.Mutex
+	ran     []string
+	current string
+	signals []string
+}
+
+type fakeExec struct {
+	exitCode int
+	output   string
+}
+
+func (d *fakeDocker) start(t *testing.T) *docker.Client {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1.41/containers/nginx/json", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"Id":    "abc123",
+			"State": map[string]interface{}{"Status": "running", "Running": true},
+		})
+	})
+	mux.HandleFunc("POST /v1.41/containers/abc123/exec", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Cmd []string `json:"Cmd"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		d.mu.Lock()
+		d.current = strings.Join(req.Cmd, " ")
+		d.ran = append(d.ran, d.current)
+		d.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]string{"Id": "exec1"})
+	})
+	mux.HandleFunc("POST /v1.41/exec/exec1/start", func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		output := d.results[d.current].output
+		d.mu.Unlock()
+		header := make([]byte, 8)
+		header[0] = 2
+		binary.BigEndian.PutUint32(header[4:], uint32(len(output)))
+		_, _ = w.Write(append(header, output...))
+	})
+	mux.HandleFunc("GET /v1.41/exec/exec1/json", func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		exitCode := d.results[d.current].exitCode
+		d.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"Running": false, "ExitCode": exitCode})
+	})
+	mux.HandleFunc("POST /v1.41/containers/abc123/kill", func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		d.signals = append(d.signals, r.URL.Query().Get("signal"))
+		d.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return docker.NewClient(srv.URL)
+}
+
+func TestDockerExecConfigTestFails(t *testing.T) {
+	fake := &fakeDocker{results: map[string]fakeExec{
+		"nginx -t": {exitCode: 1, output: `nginx: [emerg] unknown directive "ssl_certificat"`},
+	}}
+	deployer := NewDockerExec(fake.start(t), "nginx", nil, "", nil)
+
+	output, err := deployer.Deploy(t.Context(), &Certificate{Domain: "example.com"})
+	if err == nil || !strings.Contains(err.Error(), "config test failed") {
+		t.Fatalf("got %v, want a failed config test", err)
+	}
+	if !strings.Contains(output, "unknown directive") {
+		t.Errorf("output %q lacks the nginx -t output", output)
+	}
+	if strings.Join(fake.ran, ", ") != "nginx -t" {
+		t.Errorf("ran %v, want only nginx -t", fake.ran)
+	}
+}
+
+func TestDockerExecReload(t *testing.T) {
+	tests := []struct {
+		name    string
+		command []string
+		signal  string
+		test    []string
+		ran     []string
+		signals []string
+	}{
+		{name: "default", ran: []string{"nginx -t", "nginx -s reload"}},
+		{name: "command without test", command: []string{"caddy", "reload"}, ran: []string{"caddy reload"}},
+		{name: "signal", signal: "SIGHUP", signals: []string{"SIGHUP"}},
+		{name: "signal with test", signal: "SIGHUP", test: []string{"haproxy", "-c"}, ran: []string{"haproxy -c"}, signals: []string{"SIGHUP"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeDocker{results: map[string]fakeExec{
+				"nginx -t":        {output: "nginx: configuration file /etc/nginx/nginx.conf test is successful"},
+				"nginx -s reload": {output: "signal process started"},
+			}}
+			deployer := NewDockerExec(fake.start(t), "nginx", tt.command, tt.signal, tt.test)
+
+			if _, err := deployer.Deploy(t.Context(), &Certificate{Domain: "example.com"}); err != nil {
+				t.Fatalf("Deploy: %v", err)
+			}
+			if strings.Join(fake.ran, ", ") != strings.Join(tt.ran, ", ") {
+				t.Errorf("ran %v, want %v", fake.ran, tt.ran)
+			}
+			if strings.Join(fake.signals, ", ") != strings.Join(tt.signals, ", ") {
+				t.Errorf("sent %v, want %v", fake.signals, tt.signals)
+			}
+		})
+	}
+}
+
+func TestDockerExecReloadFails(t *testing.T) {
+	fake := &fakeDocker{results: map[string]fakeExec{
+		"nginx -s reload": {exitCode: 1, output: "nginx: [error] invalid PID number"},
+	}}
+	deployer := NewDockerExec(fake.start(t), "nginx", nil, "", nil)
+
+	output, err := deployer.Deploy(t.Context(), &Certificate{Domain: "example.com"})
+	if err == nil || !strings.Contains(err.Error(), "exited with code 1") {
+		t.Fatalf("got %v, want the reload's exit code", err)
+	}
+	if !strings.Contains(output, "invalid PID number") {
+		t.Errorf("output %q lacks the reload output", output)
+	}
+}
@@ -0,0 +1,53 @@
+package deployers
+
+import (
+	"context"
+	"fmt"
+	sds "ssl-manager/internal/sds"
+)
+
+// EnvoySDS publishes the certificate as a secret of the built-in SDS
+// server. Envoy clusters or listeners referring to the secret by name pick
+// the new one up on the stream they hold open, without a restart.
+type EnvoySDS struct {
+	server *sds.Server
+	secret string
+}
+
+func NewEnvoySDS(server *sds.Server, secret string) *EnvoySDS {
+	return &EnvoySDS{server: server, secret: secret}
+}
+
+func (d *EnvoySDS) Name() string {
+	if d.secret == "" {
+		return TypeEnvoy
+	}
+	return TypeEnvoy + ":" + d.secret
+}
+
+func (d *EnvoySDS) Deploy(_ context.Context, cert *Certificate) (string, error) {
+	if d.server == nil {
+		return "", fmt.Errorf("envoy sds is not configured")
+	}
+	name, secret, err := d.Secret(cert)
+	if err != nil {
+		return "", err
+	}
+	if err := d.server.SetSecret(name, secret.Chain, secret.Key); err != nil {
+		return "", fmt.Errorf("failed to publish sds secret: %w", err)
+	}
+	return "published sds secret " + name, nil
+}
+
+// Secret returns the secret Deploy publishes for cert, and its name.
+func (d *EnvoySDS) Secret(cert *Certificate) (string, sds.Secret, error) {
+	key, ok := cert.Files["key.pem"]
+	if !ok {
+		return "", sds.Secret{}, fmt.Errorf("certificate has no key, envoy needs one")
+	}
+	name := d.secret
+	if name == "" {
+		name = cert.Domain
+	}
+	return name, sds.Secret{Chain: cert.Fullchain(), Key: key}, nil
+}
@@ -0,0 +1,111 @@
+package deployers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SystemdReload reloads a systemd unit, after test succeeded when set.
+type SystemdReload struct {
+	unit string
+	test []string
+}
+
+func NewSystemdReload(unit string, test []string) *SystemdReload {
+	return &SystemdReload{unit: unit, test: test}
+}
+
+func (d *SystemdReload) Name() string {
+	return TypeSystemd + ":" + d.unit
+}
+
+func (d *SystemdReload) Deploy(ctx context.Context, cert *Certificate) (string, error) {
+	var output []string
+	if len(d.test) > 0 {
+		out, err := run(exec.CommandContext(ctx, d.test[0], d.test[1:]...))
+		output = append(output, out)
+		if err != nil {
+			return joinOutput(output), fmt.Errorf("config test failed, not reloading: %w", err)
+		}
+	}
+	out, err := run(exec.CommandContext(ctx, "systemctl", "reload", d.unit))
+	return joinOutput(append(output, out)), err
+}
+
+// Command runs an arbitrary command, after test succeeded when set. The
+// certificate files are written to a temporary directory for both, named by
+// SSL_MANAGER_CERT_DIR, and removed once they exit.
+type Command struct {
+	command []string
+	test    []string
+}
+
+func NewCommand(command, test []string) *Command {
+	return &Command{command: command, test: test}
+}
+
+func (d *Command) Name() string {
+	return TypeCommand + ":" + filepath.Base(d.command[0])
+}
+
+func (d *Command) Deploy(ctx context.Context, cert *Certificate) (string, error) {
+	dir, err := os.MkdirTemp("", "ssl-manager-deploy-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	for name, data := range cert.Files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+
+	env := append(os.Environ(),
+		"SSL_MANAGER_DOMAIN="+cert.Domain,
+		"SSL_MANAGER_CERT_DIR="+dir,
+		"SSL_MANAGER_SERIAL="+cert.Serial,
+		"SSL_MANAGER_NOT_AFTER="+cert.NotAfter.UTC().Format("2006-01-02T15:04:05Z"),
+	)
+
+	var output []string
+	if len(d.test) > 0 {
+		test := exec.CommandContext(ctx, d.test[0], d.test[1:]...)
+		test.Env = env
+		out, err := run(test)
+		output = append(output, out)
+		if err != nil {
+			return joinOutput(output), fmt.Errorf("test failed, not running %s: %w", d.command[0], err)
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, d.command[0], d.command[1:]...)
+	cmd.Env = env
+	out, err := run(cmd)
+	return joinOutput(append(output, out)), err
+}
+
+func run(cmd *exec.Cmd) (string, error) {
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if err != nil {
+		return output, fmt.Errorf("%s failed: %w", strings.Join(cmd.Args, " "), err)
+	}
+	return output, nil
+}
+
+// joinOutput puts the output of the steps of a deploy together, skipping
+// the silent ones.
+func joinOutput(outputs []string) string {
+	var parts []string
+	for _, out := range outputs {
+		if out != "" {
+			parts = append(parts, out)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
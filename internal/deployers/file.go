@@ -0,0 +1,72 @@
+package deployers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileCopy writes the certificate files to a directory, each replaced
+// atomically. files limits the copy to some of them.
+type FileCopy struct {
+	dir   string
+	files []string
+}
+
+func NewFileCopy(dir string, files []string) *FileCopy {
+	return &FileCopy{dir: dir, files: files}
+}
+
+func (d *FileCopy) Name() string {
+	return TypeFile + ":" + d.dir
+}
+
+func (d *FileCopy) Deploy(ctx context.Context, cert *Certificate) (string, error) {
+	names := d.files
+	if len(names) == 0 {
+		for name := range cert.Files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	if err := os.MkdirAll(d.dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", d.dir, err)
+	}
+	for _, name := range names {
+		data, ok := cert.Files[name]
+		if !ok {
+			return "", fmt.Errorf("certificate has no %s", name)
+		}
+		if err := writeFileAtomic(filepath.Join(d.dir, name), data); err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return "copied " + strings.Join(names, ", "), nil
+}
+
+// writeFileAtomic replaces path with data through a temporary file in the
+// same directory, so readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
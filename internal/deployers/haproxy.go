@@ -0,0 +1,101 @@
+package deployers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// HAProxyRuntime replaces a loaded certificate through the HAProxy Runtime
+// API: set ssl cert opens a transaction with the new PEM, commit ssl cert
+// swaps it in for new connections. Nothing is reloaded. The certificate
+// must be one haproxy loaded at startup, and the file on disk is not
+// touched, so pair it with a file deployer writing the same path for the
+// certificate to survive a restart.
+type HAProxyRuntime struct {
+	socket string
+	path   string
+}
+
+// NewHAProxyRuntime talks to the admin socket at socket, a unix socket path
+// or host:port of a stats socket with level admin. path is the certificate
+// as haproxy knows it, e.g. /etc/haproxy/certs/example.com.pem.
+func NewHAProxyRuntime(socket, path string) *HAProxyRuntime {
+	return &HAProxyRuntime{socket: socket, path: path}
+}
+
+func (d *HAProxyRuntime) Name() string {
+	return TypeHAProxy + ":" + d.path
+}
+
+func (d *HAProxyRuntime) Deploy(ctx context.Context, cert *Certificate) (string, error) {
+	key, ok := cert.Files["key.pem"]
+	if !ok {
+		return "", fmt.Errorf("certificate has no key, haproxy needs one")
+	}
+
+	// the payload ends at the first empty line, so the pem must not have any
+	var payload bytes.Buffer
+	for _, line := range strings.Split(string(cert.Fullchain())+"\n"+string(key), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			payload.WriteString(line + "\n")
+		}
+	}
+
+	output, err := d.command(ctx, "set ssl cert "+d.path+" <<\n"+payload.String()+"\n")
+	if err != nil {
+		return output, err
+	}
+	if !strings.Contains(output, "Transaction created") && !strings.Contains(output, "Transaction updated") {
+		d.abort(ctx)
+		return output, fmt.Errorf("haproxy refused the certificate")
+	}
+
+	committed, err := d.command(ctx, "commit ssl cert "+d.path+"\n")
+	output = joinOutput([]string{output, committed})
+	if err != nil {
+		d.abort(ctx)
+		return output, err
+	}
+	if !strings.Contains(committed, "Success!") {
+		d.abort(ctx)
+		return output, fmt.Errorf("haproxy failed to commit the certificate")
+	}
+	return output, nil
+}
+
+// abort drops a pending transaction so the next deploy starts clean.
+func (d *HAProxyRuntime) abort(ctx context.Context) {
+	_, _ = d.command(ctx, "abort ssl cert "+d.path+"\n")
+}
+
+// command runs one command on its own connection, haproxy answers and
+// closes it when the socket is not in interactive mode.
+func (d *HAProxyRuntime) command(ctx context.Context, cmd string) (string, error) {
+	network := "unix"
+	if !strings.HasPrefix(d.socket, "/") {
+		network = "tcp"
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, network, d.socket)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to haproxy: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if _, err := io.WriteString(conn, cmd); err != nil {
+		return "", fmt.Errorf("failed to send command to haproxy: %w", err)
+	}
+	out, err := io.ReadAll(conn)
+	if err != nil {
+		return string(out), fmt.Errorf("failed to read haproxy response: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,93 @@
+package deployers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	annotationDomain   = "ssl-manager/domain"
+	annotationSerial   = "ssl-manager/serial"
+	annotationNotAfter = "ssl-manager/not-after"
+)
+
+// KubernetesSecret writes the certificate to a kubernetes.io/tls Secret,
+// creating it when missing. Other keys and annotations of an existing
+// Secret are kept.
+type KubernetesSecret struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+func NewKubernetesSecret(client kubernetes.Interface, namespace, name string) *KubernetesSecret {
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	return &KubernetesSecret{client: client, namespace: namespace, name: name}
+}
+
+func (d *KubernetesSecret) Name() string {
+	return TypeKubernetes + ":" + d.namespace + "/" + d.name
+}
+
+func (d *KubernetesSecret) Deploy(ctx context.Context, cert *Certificate) (string, error) {
+	if d.client == nil {
+		return "", fmt.Errorf("kubernetes is not configured")
+	}
+	key, ok := cert.Files["key.pem"]
+	if !ok {
+		return "", fmt.Errorf("certificate has no key, a tls secret needs one")
+	}
+
+	secrets := d.client.CoreV1().Secrets(d.namespace)
+	secret, err := secrets.Get(ctx, d.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      d.name,
+				Namespace: d.namespace,
+				Labels:    map[string]string{"app.kubernetes.io/managed-by": "ssl-manager"},
+			},
+			Type: corev1.SecretTypeTLS,
+		}
+		d.fill(secret, cert, key)
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return "", fmt.Errorf("failed to create secret: %w", err)
+		}
+		return "created secret " + d.namespace + "/" + d.name, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret: %w", err)
+	}
+	if secret.Type != corev1.SecretTypeTLS {
+		return "", fmt.Errorf("secret %s/%s is of type %s, not %s", d.namespace, d.name, secret.Type, corev1.SecretTypeTLS)
+	}
+
+	d.fill(secret, cert, key)
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return "", fmt.Errorf("failed to update secret: %w", err)
+	}
+	return "updated secret " + d.namespace + "/" + d.name, nil
+}
+
+func (d *KubernetesSecret) fill(secret *corev1.Secret, cert *Certificate, key []byte) {
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[corev1.TLSCertKey] = cert.Fullchain()
+	secret.Data[corev1.TLSPrivateKeyKey] = key
+
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[annotationDomain] = cert.Domain
+	secret.Annotations[annotationSerial] = cert.Serial
+	secret.Annotations[annotationNotAfter] = cert.NotAfter.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,173 @@
+package deployers
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testCertificate() *Certificate {
+	return &Certificate{
+		Domain: "example.com",
+		Files: map[string][]byte{
+			"cert.pem":      []byte("leaf\n"),
+			"chain.pem":     []byte("intermediate\n"),
+			"fullchain.pem": []byte("leaf\nintermediate\n"),
+			"key.pem":       []byte("key\n"),
+		},
+		Serial:   "1f",
+		NotAfter: time.Date(2027, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+func TestKubernetesSecretCreate(t *testing.T) {
+	client := fake.NewClientset()
+	deployer := NewKubernetesSecret(client, "web", "example-tls")
+
+	output, err := deployer.Deploy(t.Context(), testCertificate())
+	if err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	if output != "created secret web/example-tls" {
+		t.Errorf("output %q", output)
+	}
+
+	secret, err := client.CoreV1().Secrets("web").Get(t.Context(), "example-tls", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Type != corev1.SecretTypeTLS {
+		t.Errorf("type %s", secret.Type)
+	}
+	if !bytes.Equal(secret.Data[corev1.TLSCertKey], []byte("leaf\nintermediate\n")) || !bytes.Equal(secret.Data[corev1.TLSPrivateKeyKey], []byte("key\n")) {
+		t.Errorf("data %q", secret.Data)
+	}
+	if secret.Labels["app.kubernetes.io/managed-by"] != "ssl-manager" {
+		t.Errorf("labels %v", secret.Labels)
+	}
+	if secret.Annotations[annotationDomain] != "example.com" || secret.Annotations[annotationSerial] != "1f" ||
+		secret.Annotations[annotationNotAfter] != "2027-01-02T03:04:05Z" {
+		t.Errorf("annotations %v", secret.Annotations)
+	}
+}
+
+func TestKubernetesSecretUpdate(t *testing.T) {
+	existing := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "example-tls",
+			Namespace:   "default",
+			Labels:      map[string]string{"team": "web"},
+			Annotations: map[string]string{"owner": "platform", annotationSerial: "0a"},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       []byte("old leaf\n"),
+			corev1.TLSPrivateKeyKey: []byte("old key\n"),
+			"ca.crt":                []byte("ca\n"),
+		},
+	}
+	client := fake.NewClientset(existing)
+	deployer := NewKubernetesSecret(client, "", "example-tls")
+
+	output, err := deployer.Deploy(t.Context(), testCertificate())
+	if err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	if output != "updated secret default/example-tls" {
+		t.Errorf("output %q", output)
+	}
+
+	secret, err := client.CoreV1().Secrets("default").Get(t.Context(), "example-tls", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Type != corev1.SecretTypeTLS {
+		t.Errorf("type %s", secret.Type)
+	}
+	if secret.Labels["team"] != "web" || secret.Annotations["owner"] != "platform" {
+		t.Errorf("existing labels %v or annotations %v were dropped", secret.Labels, secret.Annotations)
+	}
+	if secret.Annotations[annotationSerial] != "1f" {
+		t.Errorf("serial annotation %q", secret.Annotations[annotationSerial])
+	}
+	if !bytes.Equal(secret.Data[corev1.TLSCertKey], []byte("leaf\nintermediate\n")) || !bytes.Equal(secret.Data["ca.crt"], []byte("ca\n")) {
+		t.Errorf("data %q", secret.Data)
+	}
+}
+
+func TestKubernetesSecretFailures(t *testing.T) {
+	secretsResource := schema.GroupResource{Resource: "secrets"}
+	existing := func(secretType corev1.SecretType) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "example-tls", Namespace: "default"},
+			Type:       secretType,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		objects  []runtime.Object
+		verb     string
+		apiError error
+		cert     func(*Certificate)
+		check    func(error) bool
+	}{
+		{
+			name:     "update conflict",
+			objects:  []runtime.Object{existing(corev1.SecretTypeTLS)},
+			verb:     "update",
+			apiError: apierrors.NewConflict(secretsResource, "example-tls", nil),
+			check:    apierrors.IsConflict,
+		},
+		{
+			name:     "create forbidden",
+			verb:     "create",
+			apiError: apierrors.NewForbidden(secretsResource, "example-tls", nil),
+			check:    apierrors.IsForbidden,
+		},
+		{
+			name:     "get forbidden",
+			verb:     "get",
+			apiError: apierrors.NewForbidden(secretsResource, "example-tls", nil),
+			check:    apierrors.IsForbidden,
+		},
+		{
+			name:    "not a tls secret",
+			objects: []runtime.Object{existing(corev1.SecretTypeOpaque)},
+			check:   func(err error) bool { return strings.Contains(err.Error(), "not kubernetes.io/tls") },
+		},
+		{
+			name:  "no key",
+			cert:  func(cert *Certificate) { delete(cert.Files, "key.pem") },
+			check: func(err error) bool { return strings.Contains(err.Error(), "no key") },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientset(tt.objects...)
+			if tt.apiError != nil {
+				client.PrependReactor(tt.verb, "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, tt.apiError
+				})
+			}
+			cert := testCertificate()
+			if tt.cert != nil {
+				tt.cert(cert)
+			}
+
+			_, err := NewKubernetesSecret(client, "default", "example-tls").Deploy(t.Context(), cert)
+			if err == nil || !tt.check(err) {
+				t.Fatalf("got %v", err)
+			}
+		})
+	}
+}
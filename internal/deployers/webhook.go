@@ -0,0 +1,68 @@
+package deployers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Webhook posts the new certificate, without its key, as JSON.
+type Webhook struct {
+	url        string
+	headers    map[string]string
+	httpClient *http.Client
+}
+
+type webhookPayload struct {
+	Domain      string    `json:"domain"`
+	Serial      string    `json:"serial"`
+	Fingerprint string    `json:"fingerprint_sha256"`
+	NotAfter    time.Time `json:"not_after"`
+	Fullchain   string    `json:"fullchain"`
+}
+
+func NewWebhook(url string, headers map[string]string) *Webhook {
+	return &Webhook{url: url, headers: headers, httpClient: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (d *Webhook) Name() string {
+	return TypeWebhook + ":" + d.url
+}
+
+func (d *Webhook) Deploy(ctx context.Context, cert *Certificate) (string, error) {
+	body, err := json.Marshal(webhookPayload{
+		Domain:      cert.Domain,
+		Serial:      cert.Serial,
+		Fingerprint: cert.Fingerprint,
+		NotAfter:    cert.NotAfter,
+		Fullchain:   string(cert.Fullchain()),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range d.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	out, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return string(out), fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return string(out), nil
+}
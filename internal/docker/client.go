@@ -0,0 +1,297 @@
+// Package docker is a minimal Docker Engine API client over the daemon's
+// unix socket, covering what deploys and discovery need: inspecting and
+// listing containers, running execs, sending signals and following events.
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// apiVersion is the oldest Engine API with everything used here, served by
+// Docker 20.10 and later.
+const apiVersion = "v1.41"
+
+var ErrNoSuchContainer = errors.New("no such container")
+
+// APIError is an error response of the Engine API.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("docker api: %s (%d)", e.Message, e.StatusCode)
+}
+
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+// NewClient talks to the daemon listening on socket, e.g.
+// /var/run/docker.sock. A socket starting with http:// or https:// is used
+// as a plain URL instead.
+func NewClient(socket string) *Client {
+	if strings.HasPrefix(socket, "http://") || strings.HasPrefix(socket, "https://") {
+		return &Client{httpClient: &http.Client{}, baseURL: strings.TrimSuffix(socket, "/")}
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &Client{httpClient: &http.Client{Transport: transport}, baseURL: "http://docker"}
+}
+
+type Container struct {
+	ID    string `json:"Id"`
+	Name  string `json:"Name"`
+	State struct {
+		Status  string `json:"Status"`
+		Running bool   `json:"Running"`
+	} `json:"State"`
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+}
+
+// ContainerSummary is a container as listed by ListContainers.
+type ContainerSummary struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	State  string            `json:"State"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// Name is the container name without the leading slash.
+func (c ContainerSummary) Name() string {
+	if len(c.Names) == 0 {
+		return c.ID
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// Event is a container event. Actor.Attributes holds the container name
+// and labels.
+type Event struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	Time int64 `json:"time"`
+}
+
+// ExecResult is the outcome of a finished exec. Output holds stdout and
+// stderr interleaved.
+type ExecResult struct {
+	ExitCode int
+	Output   string
+}
+
+// InspectContainer returns the container named or identified by name.
+func (c *Client) InspectContainer(ctx context.Context, name string) (*Container, error) {
+	var container Container
+	err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(name)+"/json", nil, &container)
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrNoSuchContainer, name)
+		}
+		return nil, err
+	}
+	return &container, nil
+}
+
+// RunningContainer returns the container when it exists and is running.
+func (c *Client) RunningContainer(ctx context.Context, name string) (*Container, error) {
+	container, err := c.InspectContainer(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !container.State.Running {
+		return nil, fmt.Errorf("container %s is %s", name, container.State.Status)
+	}
+	return container, nil
+}
+
+// Exec runs cmd in the container and waits for it to exit. A non-zero exit
+// code is not an error, callers decide from ExitCode.
+func (c *Client) Exec(ctx context.Context, container string, cmd []string) (*ExecResult, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err := c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(container)+"/exec", map[string]interface{}{
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Cmd":          cmd,
+	}, &created)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	resp, err := c.request(ctx, http.MethodPost, "/exec/"+created.ID+"/start", map[string]interface{}{
+		"Detach": false,
+		"Tty":    false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start exec: %w", err)
+	}
+	output, err := demultiplex(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exec output: %w", err)
+	}
+
+	var inspect struct {
+		Running  bool `json:"Running"`
+		ExitCode int  `json:"ExitCode"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/exec/"+created.ID+"/json", nil, &inspect); err != nil {
+		return nil, fmt.Errorf("failed to inspect exec: %w", err)
+	}
+	if inspect.Running {
+		return nil, fmt.Errorf("exec %s still running after its output closed", created.ID)
+	}
+	return &ExecResult{ExitCode: inspect.ExitCode, Output: strings.TrimSpace(output)}, nil
+}
+
+// ListContainers returns the running containers carrying label.
+func (c *Client) ListContainers(ctx context.Context, label string) ([]ContainerSummary, error) {
+	filters, err := json.Marshal(map[string][]string{"label": {label}})
+	if err != nil {
+		return nil, err
+	}
+	var containers []ContainerSummary
+	err = c.do(ctx, http.MethodGet, "/containers/json?filters="+url.QueryEscape(string(filters)), nil, &containers)
+	return containers, err
+}
+
+// Events streams the events of containers carrying label that happened
+// since then, calling handle for each, until ctx is done or the daemon
+// closes the stream.
+func (c *Client) Events(ctx context.Context, label string, since time.Time, handle func(Event)) error {
+	filters, err := json.Marshal(map[string][]string{"type": {"container"}, "label": {label}})
+	if err != nil {
+		return err
+	}
+	query := url.Values{
+		"filters": {string(filters)},
+		"since":   {fmt.Sprint(since.Unix())},
+	}
+	resp, err := c.request(ctx, http.MethodGet, "/events?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event Event
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("docker closed the event stream")
+			}
+			return err
+		}
+		handle(event)
+	}
+}
+
+// Signal sends signal, e.g. SIGHUP, to the main process of the container.
+func (c *Client) Signal(ctx context.Context, container, signal string) error {
+	path := "/containers/" + url.PathEscape(container) + "/kill?signal=" + url.QueryEscape(signal)
+	return c.do(ctx, http.MethodPost, path, nil, nil)
+}
+
+// do sends a request and decodes the JSON response into out, if given.
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	resp, err := c.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// request sends a request and turns error statuses into an *APIError. The
+// caller closes the body of a successful response.
+func (c *Client) request(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/"+apiVersion+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		var msg struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &msg) == nil && msg.Message != "" {
+			apiErr.Message = msg.Message
+		} else {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// demultiplex reads an attached stream without tty, where every frame is
+// an 8 byte header (stream type, three zero bytes, big endian length)
+// followed by the payload.
+func demultiplex(r io.Reader) (string, error) {
+	var (
+		out    strings.Builder
+		header [8]byte
+	)
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return out.String(), nil
+			}
+			return out.String(), err
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(&out, r, size); err != nil {
+			return out.String(), err
+		}
+	}
+}
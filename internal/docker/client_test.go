@@ -0,0 +1,234 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+)
+
+// frame encodes payload as one frame of an attached stream, stream being 1
+// for stdout and 2 for stderr.
+func frame(stream byte, payload string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+func frames(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// fakeDaemon serves the part of the Engine API the client uses for a single
+// container named nginx.
+type fakeDaemon struct {
+	output   []byte // exec stream, written in chunks of chunk bytes
+	chunk    int
+	exitCode int
+	running  bool // exec still running when inspected
+
+	mu     sync.Mutex
+	cmds   [][]string
+	signal string
+}
+
+func (d *fakeDaemon) start(t *testing.T) *Client {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1.41/containers/{name}/json", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("name") != "nginx" {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "No such container: " + r.PathValue("name")})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"Id":    "abc123",
+			"Name":  "/nginx",
+			"State": map[string]interface{}{"Status": "running", "Running": true},
+		})
+	})
+	mux.HandleFunc("POST /v1.41/containers/{name}/exec", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Cmd []string `json:"Cmd"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		d.mu.Lock()
+		d.cmds = append(d.cmds, req.Cmd)
+		d.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"Id": "exec1"})
+	})
+	mux.HandleFunc("POST /v1.41/exec/exec1/start", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.docker.raw-stream")
+		chunk := d.chunk
+		if chunk == 0 {
+			chunk = len(d.output)
+		}
+		for rest := d.output; len(rest) > 0; {
+			n := min(chunk, len(rest))
+			_, _ = w.Write(rest[:n])
+			w.(http.Flusher).Flush()
+			rest = rest[n:]
+		}
+	})
+	mux.HandleFunc("GET /v1.41/exec/exec1/json", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"Running": d.running, "ExitCode": d.exitCode})
+	})
+	mux.HandleFunc("POST /v1.41/containers/{name}/kill", func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		d.signal = r.URL.Query().Get("signal")
+		d.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return NewClient(srv.URL)
+}
+
+func TestDemultiplex(t *testing.T) {
+	stream := frames(frame(1, "nginx: the configuration file syntax is ok\n"), frame(2, "warn\n"), frame(1, "done"))
+
+	tests := []struct {
+		name    string
+		reader  io.Reader
+		want    string
+		wantErr bool
+	}{
+		{name: "empty", reader: bytes.NewReader(nil)},
+		{name: "one frame", reader: bytes.NewReader(frame(1, "ok")), want: "ok"},
+		{name: "stdout and stderr", reader: bytes.NewReader(stream), want: "nginx: the configuration file syntax is ok\nwarn\ndone"},
+		{name: "split reads", reader: iotest.OneByteReader(bytes.NewReader(stream)), want: "nginx: the configuration file syntax is ok\nwarn\ndone"},
+		{name: "empty frame", reader: bytes.NewReader(frames(frame(1, ""), frame(2, "err"))), want: "err"},
+		{name: "truncated payload", reader: bytes.NewReader(frame(1, "cut")[:10]), want: "cu", wantErr: true},
+		{name: "truncated header", reader: bytes.NewReader(frames(frame(1, "ok"), []byte{1, 0, 0})), want: "ok", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := demultiplex(tt.reader)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExec(t *testing.T) {
+	output := frames(frame(1, "line one\n"), frame(2, "line two\n"), frame(1, "line three\n"))
+
+	tests := []struct {
+		name     string
+		daemon   *fakeDaemon
+		exitCode int
+		wantErr  bool
+	}{
+		{name: "success", daemon: &fakeDaemon{output: output}},
+		// a frame header and payload arriving in several reads
+		{name: "split stream", daemon: &fakeDaemon{output: output, chunk: 3}},
+		{name: "non-zero exit code", daemon: &fakeDaemon{output: output, exitCode: 1}, exitCode: 1},
+		{name: "still running", daemon: &fakeDaemon{output: output, running: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := tt.daemon.start(t)
+			result, err := client.Exec(t.Context(), "abc123", []string{"nginx", "-t"})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exec: %v", err)
+			}
+			if result.ExitCode != tt.exitCode {
+				t.Errorf("exit code %d, want %d", result.ExitCode, tt.exitCode)
+			}
+			if result.Output != "line one\nline two\nline three" {
+				t.Errorf("output %q", result.Output)
+			}
+			if len(tt.daemon.cmds) != 1 || strings.Join(tt.daemon.cmds[0], " ") != "nginx -t" {
+				t.Errorf("ran %v", tt.daemon.cmds)
+			}
+		})
+	}
+}
+
+func TestInspectContainer(t *testing.T) {
+	client := (&fakeDaemon{}).start(t)
+
+	container, err := client.InspectContainer(t.Context(), "nginx")
+	if err != nil {
+		t.Fatalf("InspectContainer: %v", err)
+	}
+	if container.ID != "abc123" || !container.State.Running {
+		t.Errorf("got %+v", container)
+	}
+
+	_, err = client.InspectContainer(t.Context(), "gone")
+	if !errors.Is(err, ErrNoSuchContainer) {
+		t.Fatalf("got %v, want %v", err, ErrNoSuchContainer)
+	}
+	if !strings.Contains(err.Error(), "gone") {
+		t.Errorf("error %q does not name the container", err)
+	}
+	if _, err := client.RunningContainer(t.Context(), "gone"); !errors.Is(err, ErrNoSuchContainer) {
+		t.Errorf("RunningContainer: got %v, want %v", err, ErrNoSuchContainer)
+	}
+}
+
+func TestSignal(t *testing.T) {
+	for _, signal := range []string{"SIGHUP", "SIGRTMIN+3", "10"} {
+		daemon := &fakeDaemon{}
+		client := daemon.start(t)
+		if err := client.Signal(t.Context(), "nginx", signal); err != nil {
+			t.Fatalf("Signal(%q): %v", signal, err)
+		}
+		if daemon.signal != signal {
+			t.Errorf("daemon got signal %q, want %q", daemon.signal, signal)
+		}
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+	}{
+		{"json message", http.StatusConflict, `{"message":"container abc123 is not running"}`, "container abc123 is not running"},
+		{"plain text", http.StatusInternalServerError, "page not found\n", "page not found"},
+		{"json without message", http.StatusBadRequest, `{"error":"x"}`, `{"error":"x"}`},
+		{"empty body", http.StatusServiceUnavailable, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			_, err := NewClient(srv.URL).ListContainers(t.Context(), "ssl-manager.domain")
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("got %v, want an APIError", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Message != tt.message {
+				t.Errorf("got %d %q, want %d %q", apiErr.StatusCode, apiErr.Message, tt.status, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// Package envelope encrypts private keys at rest. Every key is sealed with
+// its own random data key (DEK) under AES-256-GCM, and the DEK is stored
+// next to the ciphertext wrapped by a key-encryption key (KEK) that only the
+// KMS holds. Rotating the KEK re-wraps the DEKs and leaves the ciphertexts
+// alone.
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	utils "ssl-manager/internal/utils"
+)
+
+const (
+	pemType          = "SSL-MANAGER ENCRYPTED DATA"
+	headerKEK        = "Kek-Id"
+	headerWrappedKey = "Wrapped-Key"
+)
+
+var ErrNoKEK = errors.New("data is encrypted but no kek is configured")
+
+type Sealer struct {
+	kms KMS
+}
+
+func NewSealer(kms KMS) *Sealer {
+	return &Sealer{kms: kms}
+}
+
+// New creates the sealer configured under certs.encryption. It returns nil
+// when encryption is not configured.
+func New(cfg *utils.Config) (*Sealer, error) {
+	enc := cfg.Certs.Encryption
+	if enc.KMS == "" && enc.KEK == "" && enc.KEKFile == "" {
+		return nil, nil
+	}
+
+	switch enc.KMS {
+	case "", "local":
+		var keks [][]byte
+		if enc.KEK != "" {
+			kek, err := ParseKEK(enc.KEK)
+			if err != nil {
+				return nil, err
+			}
+			keks = append(keks, kek)
+		}
+		if enc.KEKFile != "" {
+			fromFile, err := ReadKEKFile(enc.KEKFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read kek file: %w", err)
+			}
+			keks = append(keks, fromFile...)
+		}
+		kms, err := NewLocalKMS(keks)
+		if err != nil {
+			return nil, err
+		}
+		return NewSealer(kms), nil
+	}
+	return nil, fmt.Errorf("unknown kms %q", enc.KMS)
+}
+
+// IsSealed reports whether data was written by Seal.
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN "+pemType+"-----"))
+}
+
+func (s *Sealer) Seal(ctx context.Context, plaintext []byte) ([]byte, error) {
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := s.kms.Wrap(ctx, dek)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type: pemType,
+		Headers: map[string]string{
+			headerKEK:        s.kms.KeyID(),
+			headerWrappedKey: base64.StdEncoding.EncodeToString(wrapped),
+		},
+		Bytes: gcm.Seal(nonce, nonce, plaintext, nil),
+	}), nil
+}
+
+func (s *Sealer) Open(ctx context.Context, sealed []byte) ([]byte, error) {
+	block, dek, err := s.unwrap(ctx, sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	if len(block.Bytes) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := block.Bytes[:gcm.NonceSize()], block.Bytes[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// Rewrap wraps the data key of sealed with the current KEK. rewrapped is
+// false when it already was.
+func (s *Sealer) Rewrap(ctx context.Context, sealed []byte) (data []byte, rewrapped bool, err error) {
+	block, dek, err := s.unwrap(ctx, sealed)
+	if err != nil {
+		return nil, false, err
+	}
+	if block.Headers[headerKEK] == s.kms.KeyID() {
+		return sealed, false, nil
+	}
+
+	wrapped, err := s.kms.Wrap(ctx, dek)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	block.Headers[headerKEK] = s.kms.KeyID()
+	block.Headers[headerWrappedKey] = base64.StdEncoding.EncodeToString(wrapped)
+	return pem.EncodeToMemory(block), true, nil
+}
+
+func (s *Sealer) unwrap(ctx context.Context, sealed []byte) (*pem.Block, []byte, error) {
+	block, _ := pem.Decode(sealed)
+	if block == nil || block.Type != pemType {
+		return nil, nil, errors.New("data is not sealed")
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(block.Headers[headerWrappedKey])
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed wrapped key: %w", err)
+	}
+	dek, err := s.kms.Unwrap(ctx, block.Headers[headerKEK], wrapped)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return block, dek, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,127 @@
+package envelope
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// KMS holds the key-encryption keys. Implementations backed by a cloud KMS
+// or an HSM only need to wrap and unwrap data keys; the KEK never has to
+// leave them.
+type KMS interface {
+	// KeyID names the KEK Wrap uses. It is stored with every wrapped key so
+	// older KEKs can still unwrap after a rotation.
+	KeyID() string
+	Wrap(ctx context.Context, dek []byte) ([]byte, error)
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+var ErrUnknownKEK = errors.New("data key is wrapped with an unknown kek")
+
+// LocalKMS wraps data keys with AES-256-GCM under KEKs from the config or a
+// key file. The first KEK wraps, all of them unwrap.
+type LocalKMS struct {
+	current string
+	keks    map[string]cipher.AEAD
+}
+
+func NewLocalKMS(keks [][]byte) (*LocalKMS, error) {
+	if len(keks) == 0 {
+		return nil, errors.New("no kek configured")
+	}
+
+	kms := &LocalKMS{keks: make(map[string]cipher.AEAD, len(keks))}
+	for i, kek := range keks {
+		if len(kek) != 32 {
+			return nil, fmt.Errorf("kek %d is %d bytes, want 32", i+1, len(kek))
+		}
+		block, err := aes.NewCipher(kek)
+		if err != nil {
+			return nil, err
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(kek)
+		id := hex.EncodeToString(sum[:4])
+		if i == 0 {
+			kms.current = id
+		}
+		kms.keks[id] = gcm
+	}
+	return kms, nil
+}
+
+func (k *LocalKMS) KeyID() string {
+	return k.current
+}
+
+func (k *LocalKMS) Wrap(ctx context.Context, dek []byte) ([]byte, error) {
+	gcm := k.keks[k.current]
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, dek, []byte(k.current)), nil
+}
+
+func (k *LocalKMS) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	gcm, ok := k.keks[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownKEK, keyID)
+	}
+	if len(wrapped) < gcm.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	nonce, ciphertext := wrapped[:gcm.NonceSize()], wrapped[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, []byte(keyID))
+}
+
+// ParseKEK decodes a base64 encoded 32 byte KEK, as made by
+// `openssl rand -base64 32`.
+func ParseKEK(encoded string) ([]byte, error) {
+	kek, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("kek is not base64: %w", err)
+	}
+	return kek, nil
+}
+
+// ReadKEKFile reads one base64 KEK per line. Blank lines and lines starting
+// with # are skipped. To rotate, put the new KEK on the first line and keep
+// the old ones below it until every key is re-wrapped.
+func ReadKEKFile(path string) ([][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keks [][]byte
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kek, err := ParseKEK(line)
+		if err != nil {
+			return nil, err
+		}
+		keks = append(keks, kek)
+	}
+	return keks, scanner.Err()
+}
@@ -0,0 +1,30 @@
+// Package kube connects to the Kubernetes API server for the secret
+// deployer and ingress discovery.
+package kube
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// NewClientset connects with the kubeconfig at path, or with the service
+// account of the pod when path is empty.
+func NewClientset(path string) (kubernetes.Interface, error) {
+	var (
+		cfg *rest.Config
+		err error
+	)
+	if path == "" {
+		cfg, err = rest.InClusterConfig()
+	} else {
+		cfg, err = clientcmd.BuildConfigFromFlags("", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubernetes config: %w", err)
+	}
+	cfg.UserAgent = "ssl-manager"
+	return kubernetes.NewForConfig(cfg)
+}
@@ -10,13 +10,97 @@ type GetDomainsReq struct {
 
 type CreateDomainReq struct {
 	CreatedBy          string
-	Domain             string `json:"domain"`
-	VerificationMethod string `json:"verification_method"`
-	AutoRenew          bool   `json:"auto_renew"`
+	NginxContainerName string           `json:"-"` // set by docker discovery
+	Pipeline           []DeployerConfig `json:"-"` // set by discovery, the api only names deployers
+	Domain             string           `json:"domain"`
+	SANs               []string         `json:"sans,omitempty"`
+	VerificationMethod string           `json:"verification_method"`
+	CA                 string           `json:"ca,omitempty"`
+	KeyType            string           `json:"key_type,omitempty"`
+	KeyReuse           bool             `json:"key_reuse"`
+	CSR                string           `json:"csr,omitempty"` // PEM, the key stays with the caller
+	ExportFormats      []string         `json:"export_formats,omitempty"`
+	ExportPassword     string           `json:"export_password,omitempty"` // protects pkcs12 exports
+	Deployers          []string         `json:"deployers,omitempty"`       // names of deployers defined in the config
+	VerifyAddress      string           `json:"verify_address,omitempty"`  // host[:port] checked for the new certificate after every deploy
+	AutoRenew          bool             `json:"auto_renew"`
+}
+
+type ImportCertificateReq struct {
+	CreatedBy          string
+	Domain             string   `json:"domain,omitempty"` // primary name, defaults to the first name in the certificate
+	Cert               string   `json:"cert"`
+	Key                string   `json:"key"`
+	Chain              string   `json:"chain,omitempty"`
+	CA                 string   `json:"ca,omitempty"` // used for renewals
+	VerificationMethod string   `json:"verification_method,omitempty"`
+	ExportFormats      []string `json:"export_formats,omitempty"`
+	ExportPassword     string   `json:"export_password,omitempty"`
+	Deployers          []string `json:"deployers,omitempty"`      // names of deployers defined in the config
+	VerifyAddress      string   `json:"verify_address,omitempty"` // host[:port] checked for the new certificate after every deploy
+	AutoRenew          bool     `json:"auto_renew"`
+}
+
+// DeployerConfig is one step of a domain's deploy pipeline, run in order
+// after every issuance. Which fields apply depends on Type. The operator
+// defines deployers under deployers in the config and domains created
+// through the api refer to them by Target only; discovery sets the fields
+// itself.
+type DeployerConfig struct {
+	Target    string            `json:"target,omitempty" yaml:"-"`            // name of a deployer in the config, the other fields are unset
+	Type      string            `json:"type,omitempty" yaml:"type"`           // docker, systemd, command, webhook, file, kubernetes, haproxy or envoy
+	Container string            `json:"container,omitempty" yaml:"container"` // docker
+	Command   []string          `json:"command,omitempty" yaml:"command"`     // docker (defaults to nginx -s reload), command
+	Signal    string            `json:"signal,omitempty" yaml:"signal"`       // docker: sent instead of running command, e.g. SIGHUP
+	Test      []string          `json:"test,omitempty" yaml:"test"`           // docker, systemd, command: must succeed before the reload, defaults to nginx -t for the default docker reload
+	Unit      string            `json:"unit,omitempty" yaml:"unit"`           // systemd
+	URL       string            `json:"url,omitempty" yaml:"url"`             // webhook
+	Headers   map[string]string `json:"headers,omitempty" yaml:"headers"`     // webhook
+	Path      string            `json:"path,omitempty" yaml:"path"`           // file: target directory; haproxy: certificate file as haproxy loaded it
+	Files     []string          `json:"files,omitempty" yaml:"files"`         // file: defaults to every file
+	Namespace string            `json:"namespace,omitempty" yaml:"namespace"` // kubernetes, defaults to default
+	Secret    string            `json:"secret,omitempty" yaml:"secret"`       // kubernetes: kubernetes.io/tls secret name; envoy: sds secret name, defaults to the domain
+	Socket    string            `json:"socket,omitempty" yaml:"socket"`       // haproxy: admin socket path or host:port
+}
+
+type ExportCertificateReq struct {
+	DomainID string
+	Format   string
+	Password string
+	UserID   string
 }
 
 type DeleteDomainReq struct {
-	DomainID   string `json:"domain_id"`
-	DomainName string `json:"domain_name"`
+	DomainID         string `json:"domain_id"`
+	DomainName       string `json:"domain_name"`
+	Revoke           bool   `json:"revoke"`
+	RevocationReason int    `json:"reason"`
+	UserID           string
+}
+
+type RevokeCertificateReq struct {
+	DomainID          string
+	CertificateID     string
+	Reason            int  `json:"reason"`
+	UseCertificateKey bool `json:"use_certificate_key"` // sign with the certificate key instead of the account key
+	UserID            string
+}
+
+type RegisterACMEAccountReq struct {
+	CA         string   `json:"ca"`
+	Emails     []string `json:"emails"`
+	EABKeyID   string   `json:"eab_key_id,omitempty"`
+	EABHMACKey string   `json:"eab_hmac_key,omitempty"`
 	UserID     string
 }
+
+type UpdateACMEAccountReq struct {
+	AccountID string
+	Emails    []string `json:"emails"`
+	UserID    string
+}
+
+type ACMEAccountActionReq struct {
+	AccountID string
+	UserID    string
+}
@@ -21,14 +21,42 @@ type Domains struct {
 }
 
 type Details struct {
-	Status              string    `json:"status"`
-	AutoRenew           bool      `json:"auto_renew"`
-	VerificationMethod  string    `json:"verification_method"`
-	CreatedAt           time.Time `json:"created_at"`
-	CreatedBy           string    `json:"created_by"`
-	DomainLastUpdate    time.Time `json:"domain_last_update"`
-	NginxContainerName  string    `json:"nginx_container_name"`
-	CertValidTo         time.Time `json:"certificate_valid_to"`
-	CertLastRenewal     time.Time `json:"certificate_last_renewal"`
-	CertRenewalAttempts int       `json:"certificate_renewal_attempts"`
+	Status              string           `json:"status"`
+	AutoRenew           bool             `json:"auto_renew"`
+	SANs                []string         `json:"sans,omitempty"`
+	VerificationMethod  string           `json:"verification_method"`
+	CA                  string           `json:"ca,omitempty"`
+	KeyType             string           `json:"key_type"`
+	KeyReuse            bool             `json:"key_reuse"`
+	CSRSupplied         bool             `json:"csr_supplied"`
+	ExportFormats       []string         `json:"export_formats,omitempty"`
+	Deployers           []DeployerConfig `json:"deployers,omitempty"`
+	VerifyAddress       string           `json:"verify_address,omitempty"`
+	CreatedAt           time.Time        `json:"created_at"`
+	CreatedBy           string           `json:"created_by"`
+	DomainLastUpdate    time.Time        `json:"domain_last_update"`
+	NginxContainerName  string           `json:"nginx_container_name"`
+	CertKeyType         string           `json:"certificate_key_type,omitempty"`
+	CertValidTo         time.Time        `json:"certificate_valid_to"`
+	CertLastRenewal     time.Time        `json:"certificate_last_renewal"`
+	CertRenewAt         time.Time        `json:"certificate_renew_at"`
+	CertRenewalAttempts int              `json:"certificate_renewal_attempts"`
+	CertTLSVerification string           `json:"certificate_tls_verification,omitempty"`
+	CertTLSVerifiedAt   time.Time        `json:"certificate_tls_verified_at"`
+}
+
+type GetACMEAccountsResp struct {
+	Accounts []ACMEAccount `json:"accounts"`
+}
+
+type ACMEAccount struct {
+	ID           string    `json:"id"`
+	Emails       []string  `json:"emails"`
+	AccountURL   string    `json:"account_url"`
+	DirectoryURL string    `json:"directory_url"`
+	EABKeyID     string    `json:"eab_key_id,omitempty"`
+	Status       string    `json:"status"`
+	CreatedAt    time.Time `json:"created_at"`
+	CreatedBy    string    `json:"created_by"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
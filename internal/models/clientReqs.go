@@ -0,0 +1,16 @@
+package models
+
+type CertificateOrder struct {
+	CA                 string
+	Domain             string
+	SANs               []string
+	VerificationMethod string // http-01 | dns-01, empty lets the client choose
+	KeyType            string // see utils.KeyType*, empty means ecdsa-p256
+	ReuseKeyPath       string // key of the previous certificate, reused when it has KeyType
+	CSR                []byte // DER, finalizes the order instead of a generated key
+}
+
+type EABCredentials struct {
+	KeyID   string
+	HMACKey string // base64url
+}
@@ -2,16 +2,74 @@ package models
 
 import "time"
 
+// ExternalIssuerPrefix starts certificates.issuer of imported certificates
+// that no configured CA verifies, followed by the issuer's common name.
+const ExternalIssuerPrefix = "external:"
+
 type CertificateData struct {
+	Issuer    string // name of the CA that issued the certificate, see ExternalIssuerPrefix
+	KeyType   string
 	Cert      []byte
-	Key       []byte
-	Chain     []byte
+	Key       []byte // empty when the certificate was issued for a supplied CSR
+	Chain     []byte // intermediates
+	Fullchain []byte // leaf and intermediates
 	ValidFrom time.Time
 	ValidTo   time.Time
 }
 
 type CertificatePaths struct {
-	Cert  string
-	Key   string
-	Chain string
+	Cert      string
+	Key       string
+	Chain     string
+	Fullchain string
+}
+
+type CertificateExport struct {
+	Data        []byte
+	ContentType string
+	FileName    string
+}
+
+type ACMEAccountData struct {
+	URL          string
+	Emails       []string
+	Status       string
+	Key          []byte // PEM
+	Registration []byte // JSON
+	EABKeyID     string
+	EABRequired  bool // the CA's directory requires EAB, so it must have checked the binding
+}
+
+// RenewalInfo is the renewal window a CA suggests through ARI.
+type RenewalInfo struct {
+	WindowStart    time.Time
+	WindowEnd      time.Time
+	ExplanationURL string
+	RetryAfter     time.Duration // when to ask again
+}
+
+// KeyRotationResp counts the stored private keys a KEK rotation touched.
+type KeyRotationResp struct {
+	Rewrapped int `json:"rewrapped"` // data key wrapped again with the current kek
+	Encrypted int `json:"encrypted"` // stored in plaintext before, encrypted now
+	Unchanged int `json:"unchanged"`
+}
+
+// TLS verification results, see TLSVerification.Status.
+const (
+	TLSVerificationOK              = "ok"
+	TLSVerificationMismatch        = "mismatch"
+	TLSVerificationIncompleteChain = "incomplete_chain"
+	TLSVerificationUnreachable     = "unreachable"
+	// the check is running in the background
+	TLSVerificationPending = "pending"
+)
+
+// TLSVerification compares the certificate an endpoint serves with the one
+// that was deployed.
+type TLSVerification struct {
+	Status      string `json:"status"`
+	Serial      string `json:"served_serial,omitempty"`
+	Fingerprint string `json:"served_fingerprint_sha256,omitempty"`
+	Error       string `json:"error,omitempty"`
 }
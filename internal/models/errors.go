@@ -5,4 +5,12 @@ import "errors"
 var (
 	ErrDomainExists   = errors.New("domain already exists")
 	ErrDomainNotFound = errors.New("domain not found")
+
+	ErrChallengeNotFound = errors.New("challenge token not found")
+	ErrAccountNotFound   = errors.New("acme account not found")
+
+	ErrCertificateNotFound = errors.New("certificate not found")
+	ErrCertificateRevoked  = errors.New("certificate already revoked")
+	ErrRenewalLocked       = errors.New("renewal already running on another instance")
+	ErrExternalIssuer      = errors.New("certificate was not issued by a configured ca")
 )
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 func safeString(s *string) string {
 	if s == nil {
@@ -43,14 +46,70 @@ func ConvertDomainsDTOToDomains(req DomainsDTO) Domains {
 		Details: Details{
 			Status:              req.Details.Status,
 			AutoRenew:           req.Details.AutoRenew,
+			SANs:                req.Details.SANs,
 			VerificationMethod:  req.Details.VerificationMethod,
+			CA:                  req.Details.CA,
+			KeyType:             req.Details.KeyType,
+			KeyReuse:            req.Details.KeyReuse,
+			CSRSupplied:         req.Details.CSRSupplied,
+			ExportFormats:       req.Details.ExportFormats,
+			Deployers:           redactDeployers(req.Details.Deployers),
+			VerifyAddress:       req.Details.VerifyAddress,
 			CreatedAt:           req.Details.CreatedAt,
 			CreatedBy:           req.Details.CreatedBy,
 			DomainLastUpdate:    safeTime(req.Details.DomainLastUpdate),
 			NginxContainerName:  req.Details.NginxContainerName,
+			CertKeyType:         req.Details.CertKeyType,
 			CertValidTo:         safeTime(req.Details.CertValidTo),
 			CertLastRenewal:     safeTime(req.Details.CertLastRenewal),
+			CertRenewAt:         safeTime(req.Details.CertRenewAt),
 			CertRenewalAttempts: safeInt(req.Details.CertRenewalAttempts),
+			CertTLSVerification: req.Details.CertTLSVerification,
+			CertTLSVerifiedAt:   safeTime(req.Details.CertTLSVerifiedAt),
 		},
 	}
 }
+
+// redactedValue replaces secrets in responses.
+const redactedValue = "[redacted]"
+
+// redactDeployers copies cfgs with the webhook header values, often tokens,
+// redacted. The names stay so the pipeline can still be told apart.
+func redactDeployers(cfgs []DeployerConfig) []DeployerConfig {
+	if len(cfgs) == 0 {
+		return cfgs
+	}
+	redacted := make([]DeployerConfig, len(cfgs))
+	for i, cfg := range cfgs {
+		if len(cfg.Headers) > 0 {
+			headers := make(map[string]string, len(cfg.Headers))
+			for name := range cfg.Headers {
+				headers[name] = redactedValue
+			}
+			cfg.Headers = headers
+		}
+		redacted[i] = cfg
+	}
+	return redacted
+}
+
+func ConvertACMEAccountDTOToACMEAccount(req ACMEAccountDTO) ACMEAccount {
+	return ACMEAccount{
+		ID:           req.ID,
+		Emails:       splitEmails(req.Email),
+		AccountURL:   safeString(req.AccountURL),
+		DirectoryURL: safeString(req.DirectoryURL),
+		EABKeyID:     safeString(req.EABKeyID),
+		Status:       req.Status,
+		CreatedAt:    req.CreatedAt,
+		CreatedBy:    req.CreatedBy,
+		UpdatedAt:    safeTime(req.UpdatedAt),
+	}
+}
+
+func splitEmails(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,26 @@
+package models
+
+import "testing"
+
+func TestConvertDomainsDTORedactsHeaders(t *testing.T) {
+	dto := DomainsDTO{}
+	dto.Details.Deployers = []DeployerConfig{
+		{Type: "webhook", URL: "https://hooks.example.com", Headers: map[string]string{"Authorization": "Bearer secret"}},
+		{Type: "docker", Container: "nginx"},
+	}
+
+	got := ConvertDomainsDTOToDomains(dto).Details.Deployers
+	if len(got) != 2 {
+		t.Fatalf("got %d deployers", len(got))
+	}
+	if value := got[0].Headers["Authorization"]; value != redactedValue {
+		t.Errorf("Authorization header is %q", value)
+	}
+	if got[0].URL != "https://hooks.example.com" || got[1].Container != "nginx" {
+		t.Errorf("other fields changed: %+v", got)
+	}
+	// the stored pipeline keeps the token for the deployer
+	if dto.Details.Deployers[0].Headers["Authorization"] != "Bearer secret" {
+		t.Error("redacting changed the domain's deployers")
+	}
+}
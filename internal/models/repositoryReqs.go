@@ -3,7 +3,9 @@ package models
 type DomainsFilters struct {
 	Limit      *int
 	Offset     *int
+	ID         string
 	DomainName string
+	ExactName  string
 	Status     string
 	UserID     string
 }
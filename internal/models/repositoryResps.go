@@ -17,13 +17,20 @@ type GetDomainsDTO struct {
 type CertsDTO struct {
 	ID              string
 	Issuer          *string
+	KeyType         *string
 	CertPath        string
-	KeyPath         string
-	ChainPath       *string
+	KeyPath         *string // NULL for certificates issued for a supplied CSR
+	ChainPath       *string // intermediates only
+	FullchainPath   *string // NULL for certificates issued before fullchain.pem was written
 	ValidFrom       *time.Time
 	ValidTo         *time.Time
 	LastRenewal     *time.Time
 	RenewalAttempts int
+	RevokedAt       *time.Time
+	WindowStart     *time.Time // ARI suggested renewal window
+	WindowEnd       *time.Time
+	RenewAt         *time.Time
+	ARINextCheck    *time.Time
 	CreatedAt       time.Time
 	CreatedBy       string
 }
@@ -37,12 +44,40 @@ type DomainsDTO struct {
 type DetailsDTO struct {
 	Status              string
 	AutoRenew           bool
+	SANs                []string
 	VerificationMethod  string
+	CA                  string
+	KeyType             string
+	KeyReuse            bool
+	CSRSupplied         bool
+	ExportFormats       []string
+	ExportPassword      *string // encrypted
+	Deployers           []DeployerConfig
+	VerifyAddress       string
+	IssueAttempts       int        // failed first issuances
+	NextIssueAt         *time.Time // retry of a failed first issuance
 	CreatedAt           time.Time
 	CreatedBy           string
 	DomainLastUpdate    *time.Time
 	NginxContainerName  string
+	CertKeyType         string
 	CertValidTo         *time.Time
 	CertLastRenewal     *time.Time
+	CertRenewAt         *time.Time
 	CertRenewalAttempts *int
+	CertTLSVerification string
+	CertTLSVerifiedAt   *time.Time
+}
+
+type ACMEAccountDTO struct {
+	ID           string
+	Email        string
+	AccountURL   *string
+	DirectoryURL *string
+	EncryptedKey *string
+	EABKeyID     *string
+	Status       string
+	CreatedAt    time.Time
+	CreatedBy    string
+	UpdatedAt    *time.Time
 }
@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	models "ssl-manager/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const acmeAccountColumns = `
+	id, email, account_url, directory_url, encrypted_key,
+	eab_key_id, status, created_at, created_by, updated_at
+`
+
+func (r *Repository) GetACMEAccounts(ctx context.Context) ([]models.ACMEAccountDTO, error) {
+	query := `SELECT ` + acmeAccountColumns + ` FROM acme_accounts WHERE deleted_at IS NULL ORDER BY created_at DESC`
+
+	r.log.Debug("Query execution: ", query)
+	rows, err := r.DB.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	r.log.Debug("Query executed.")
+
+	var accounts []models.ACMEAccountDTO
+	for rows.Next() {
+		account, err := scanACMEAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, rows.Err()
+}
+
+func (r *Repository) GetACMEAccountByID(ctx context.Context, id string) (models.ACMEAccountDTO, error) {
+	query := `SELECT ` + acmeAccountColumns + ` FROM acme_accounts WHERE deleted_at IS NULL AND id = $1`
+
+	r.log.Debug("Query execution: ", query)
+	account, err := scanACMEAccount(r.DB.QueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return account, models.ErrAccountNotFound
+	}
+	return account, err
+}
+
+// GetActiveACMEAccount returns the newest valid account registered with the
+// given directory.
+func (r *Repository) GetActiveACMEAccount(ctx context.Context, directoryURL string) (models.ACMEAccountDTO, error) {
+	query := `SELECT ` + acmeAccountColumns + ` FROM acme_accounts
+		WHERE deleted_at IS NULL AND status = 'valid' AND directory_url = $1
+		ORDER BY created_at DESC
+		LIMIT 1`
+
+	r.log.Debug("Query execution: ", query)
+	account, err := scanACMEAccount(r.DB.QueryRow(ctx, query, directoryURL))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return account, models.ErrAccountNotFound
+	}
+	return account, err
+}
+
+func scanACMEAccount(row pgx.Row) (models.ACMEAccountDTO, error) {
+	var account models.ACMEAccountDTO
+	err := row.Scan(
+		&account.ID, &account.Email, &account.AccountURL, &account.DirectoryURL, &account.EncryptedKey,
+		&account.EABKeyID, &account.Status, &account.CreatedAt, &account.CreatedBy, &account.UpdatedAt,
+	)
+	return account, err
+}
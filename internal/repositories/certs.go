@@ -2,51 +2,62 @@ package repositories
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	models "ssl-manager/internal/models"
+
+	"github.com/jackc/pgx/v5"
 )
 
+const certificateColumns = `
+	id, issuer, key_type, cert_path, key_path, chain_path, fullchain_path, valid_from,
+	valid_to, last_renewal, renewal_attempts, revoked_at, renewal_window_start,
+	renewal_window_end, renew_at, ari_next_check, created_at, created_by
+`
+
+// GetCertificatesByDomain returns the current (newest, not deleted)
+// certificate of a domain.
 func (r *Repository) GetCertificatesByDomain(ctx context.Context, domainID string) (models.CertsDTO, error) {
 	r.log.Debug("id in repo layer: ", domainID)
 	query := `
-        SELECT 
-            id, issuer, cert_path, key_path, chain_path, valid_from,
-			valid_to, last_renewal, renewal_attempts, created_at, created_by
-        FROM certificates 
-        WHERE deleted_at IS NULL
+        SELECT ` + certificateColumns + `
+        FROM certificates
+        WHERE deleted_at IS NULL AND domain_id = $1
+        ORDER BY created_at DESC
+        LIMIT 1
     `
 
-	args := []interface{}{}
-	argID := 1
-
-	query += fmt.Sprintf(" AND domain_id = $%d", argID)
-	args = append(args, "%"+domainID+"%")
-	argID++
-
 	r.log.Debug("Query execution: ", query)
-	rows, err := r.DB.Query(ctx, query, args...)
+	certs, err := scanCertificate(r.DB.QueryRow(ctx, query, domainID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return certs, models.ErrCertificateNotFound
+	}
 	if err != nil {
-		return models.CertsDTO{}, err
+		return certs, err
 	}
 	r.log.Debug("Query executed.")
-	defer rows.Close()
-
-	var certs models.CertsDTO
-	r.log.Debug("Starting to scan rows")
 
-	err = rows.Scan(
-		&certs.ID, &certs.Issuer, &certs.CertPath, &certs.KeyPath, &certs.ChainPath, &certs.ValidFrom,
-		&certs.ValidTo, &certs.LastRenewal, &certs.RenewalAttempts, &certs.CreatedAt, &certs.CreatedBy,
-	)
-	if err != nil {
-		return certs, err
+	return certs, nil
+}
 
-	}
-	r.log.Debug("Rows scanned.")
+// GetCertificateByID returns a not deleted certificate of the given domain.
+func (r *Repository) GetCertificateByID(ctx context.Context, domainID, certID string) (models.CertsDTO, error) {
+	query := `SELECT ` + certificateColumns + ` FROM certificates
+		WHERE deleted_at IS NULL AND domain_id = $1 AND id = $2`
 
-	if err = rows.Err(); err != nil {
-		return certs, err
+	r.log.Debug("Query execution: ", query)
+	certs, err := scanCertificate(r.DB.QueryRow(ctx, query, domainID, certID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return certs, models.ErrCertificateNotFound
 	}
+	return certs, err
+}
 
-	return certs, nil
+func scanCertificate(row pgx.Row) (models.CertsDTO, error) {
+	var certs models.CertsDTO
+	err := row.Scan(
+		&certs.ID, &certs.Issuer, &certs.KeyType, &certs.CertPath, &certs.KeyPath, &certs.ChainPath, &certs.FullchainPath, &certs.ValidFrom,
+		&certs.ValidTo, &certs.LastRenewal, &certs.RenewalAttempts, &certs.RevokedAt, &certs.WindowStart,
+		&certs.WindowEnd, &certs.RenewAt, &certs.ARINextCheck, &certs.CreatedAt, &certs.CreatedBy,
+	)
+	return certs, err
 }
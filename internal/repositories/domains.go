@@ -18,6 +18,45 @@ func (r *Repository) IsDomainExists(ctx context.Context, domain string) (bool, e
 	return exists, nil
 }
 
+// GetDomainCSR returns the supplied PEM CSR of a domain, or "" when its key is
+// generated here.
+func (r *Repository) GetDomainCSR(ctx context.Context, domainID string) (string, error) {
+	const query = `SELECT COALESCE(csr_pem, '') FROM domains WHERE id = $1`
+
+	var csr string
+	err := r.DB.QueryRow(ctx, query, domainID).Scan(&csr)
+	if err != nil {
+		return "", err
+	}
+
+	return csr, nil
+}
+
+// GetDomainByName returns the not deleted domain with exactly this name.
+func (r *Repository) GetDomainByName(ctx context.Context, name string) (models.DomainsDTO, error) {
+	domains, err := r.GetDomainsList(ctx, models.DomainsFilters{ExactName: name})
+	if err != nil {
+		return models.DomainsDTO{}, err
+	}
+	if len(domains) == 0 {
+		return models.DomainsDTO{}, models.ErrDomainNotFound
+	}
+	return domains[0], nil
+}
+
+// GetUserDomain returns the not deleted domain with this id if userID
+// created it, scoped like the domain list.
+func (r *Repository) GetUserDomain(ctx context.Context, domainID, userID string) (models.DomainsDTO, error) {
+	domains, err := r.GetDomainsList(ctx, models.DomainsFilters{ID: domainID, UserID: userID})
+	if err != nil {
+		return models.DomainsDTO{}, err
+	}
+	if len(domains) == 0 {
+		return models.DomainsDTO{}, models.ErrDomainNotFound
+	}
+	return domains[0], nil
+}
+
 func (r *Repository) GetDomainsCount(ctx context.Context, filters models.DomainsFilters) (int, error) {
 	r.log.Debug("Filters in repo layer: ", filters)
 
@@ -34,6 +73,16 @@ func (r *Repository) GetDomainsCount(ctx context.Context, filters models.Domains
 		args = append(args, "%"+filters.DomainName+"%")
 		argID++
 	}
+	if filters.ID != "" {
+		query += fmt.Sprintf(" AND id = $%d", argID)
+		args = append(args, filters.ID)
+		argID++
+	}
+	if filters.ExactName != "" {
+		query += fmt.Sprintf(" AND domain_name = $%d", argID)
+		args = append(args, filters.ExactName)
+		argID++
+	}
 	if filters.Status != "" {
 		query += fmt.Sprintf(" AND status ILIKE $%d", argID)
 		args = append(args, "%"+filters.Status+"%")
@@ -73,6 +122,16 @@ func (r *Repository) GetDomainsList(ctx context.Context, filters models.DomainsF
 		args = append(args, "%"+filters.DomainName+"%")
 		argID++
 	}
+	if filters.ID != "" {
+		subQuery += fmt.Sprintf(" AND d.id = $%d", argID)
+		args = append(args, filters.ID)
+		argID++
+	}
+	if filters.ExactName != "" {
+		subQuery += fmt.Sprintf(" AND d.domain_name = $%d", argID)
+		args = append(args, filters.ExactName)
+		argID++
+	}
 	if filters.Status != "" {
 		subQuery += fmt.Sprintf(" AND d.status ILIKE $%d", argID)
 		args = append(args, "%"+filters.Status+"%")
@@ -92,9 +151,18 @@ func (r *Repository) GetDomainsList(ctx context.Context, filters models.DomainsF
 
 	query := fmt.Sprintf(`
 		SELECT 
-			d.id, d.domain_name, d.status, d.auto_renew, d.nginx_container_name,
-			d.verification_method, d.created_at, d.created_by, d.updated_at
-			c.valid_to, c.last_renewal, c.renewal_attempts
+			d.id, d.domain_name, d.status, d.auto_renew, COALESCE(d.nginx_container_name, ''),
+			d.verification_method, COALESCE(d.ca, ''), COALESCE(d.key_type, ''), d.key_reuse,
+			d.csr_pem IS NOT NULL, string_to_array(COALESCE(d.export_formats, ''), ','), d.export_password,
+			COALESCE(d.deployers, '[]'::jsonb), COALESCE(d.verify_address, ''), d.issue_attempts, d.next_issue_at,
+			d.created_at, d.created_by, d.updated_at,
+			COALESCE(c.key_type, ''), c.valid_to, c.last_renewal, c.renew_at, c.renewal_attempts,
+			COALESCE(c.tls_verification, ''), c.tls_verified_at,
+			ARRAY(
+				SELECT s.san FROM domain_sans s
+				WHERE s.domain_id = d.id AND s.deleted_at IS NULL
+				ORDER BY s.san
+			) AS sans
 		FROM (%s) AS domains_list
 		JOIN domains d ON d.id = domains_list.id
 		LEFT JOIN certificates c ON c.domain_id = d.id AND c.deleted_at IS NULL
@@ -114,8 +182,13 @@ func (r *Repository) GetDomainsList(ctx context.Context, filters models.DomainsF
 		var domain models.DomainsDTO
 		err := rows.Scan(
 			&domain.ID, &domain.DomainName, &domain.Details.Status, &domain.Details.AutoRenew, &domain.Details.NginxContainerName,
-			&domain.Details.VerificationMethod, &domain.Details.CreatedAt, &domain.Details.CreatedBy, &domain.Details.DomainLastUpdate,
-			&domain.Details.CertValidTo, &domain.Details.CertLastRenewal, &domain.Details.CertRenewalAttempts,
+			&domain.Details.VerificationMethod, &domain.Details.CA, &domain.Details.KeyType, &domain.Details.KeyReuse,
+			&domain.Details.CSRSupplied, &domain.Details.ExportFormats, &domain.Details.ExportPassword,
+			&domain.Details.Deployers, &domain.Details.VerifyAddress, &domain.Details.IssueAttempts, &domain.Details.NextIssueAt,
+			&domain.Details.CreatedAt, &domain.Details.CreatedBy, &domain.Details.DomainLastUpdate,
+			&domain.Details.CertKeyType, &domain.Details.CertValidTo, &domain.Details.CertLastRenewal, &domain.Details.CertRenewAt, &domain.Details.CertRenewalAttempts,
+			&domain.Details.CertTLSVerification, &domain.Details.CertTLSVerifiedAt,
+			&domain.Details.SANs,
 		)
 		if err != nil {
 			return nil, err
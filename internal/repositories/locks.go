@@ -0,0 +1,51 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockNamespace is the first key of every advisory lock taken here, keeping
+// them apart from locks of other applications on the same database. Lock
+// names are hashed into the second key.
+const lockNamespace int32 = 0x53534c4d
+
+// Lock is a session advisory lock held on a connection of its own. It lasts
+// until it is released or the connection dies.
+type Lock struct {
+	conn *pgxpool.Conn
+	name string
+}
+
+// TryLock takes the lock name without waiting. ok is false when another
+// session holds it.
+func (r *Repository) TryLock(ctx context.Context, name string) (*Lock, bool, error) {
+	conn, err := r.DB.Acquire(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var ok bool
+	err = conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1, hashtext($2))", lockNamespace, name).Scan(&ok)
+	if err != nil || !ok {
+		conn.Release()
+		return nil, false, err
+	}
+	return &Lock{conn: conn, name: name}, true, nil
+}
+
+// Held reports whether the lock's connection is still alive, and with it
+// the lock.
+func (l *Lock) Held(ctx context.Context) bool {
+	return l.conn.Ping(ctx) == nil
+}
+
+// Release unlocks and hands the connection back to the pool. A connection
+// that fails to unlock is closed instead, which drops the lock as well.
+func (l *Lock) Release(ctx context.Context) {
+	if _, err := l.conn.Exec(ctx, "SELECT pg_advisory_unlock($1, hashtext($2))", lockNamespace, l.name); err != nil {
+		_ = l.conn.Conn().Close(ctx)
+	}
+	l.conn.Release()
+}
@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testRepository connects to SSL_MANAGER_TEST_DATABASE_URL. Every call has
+// a pool of its own, standing in for an instance.
+func testRepository(t *testing.T) *Repository {
+	t.Helper()
+	url := os.Getenv("SSL_MANAGER_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("SSL_MANAGER_TEST_DATABASE_URL is not set")
+	}
+	db, err := pgxpool.New(t.Context(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	return &Repository{DB: db}
+}
+
+func TestTryLock(t *testing.T) {
+	first, second := testRepository(t), testRepository(t)
+	ctx := t.Context()
+	name := "locks-test:" + t.Name()
+
+	lock, ok, err := first.TryLock(ctx, name)
+	if err != nil || !ok {
+		t.Fatalf("TryLock = %v, %v", ok, err)
+	}
+	if !lock.Held(ctx) {
+		t.Error("taken lock is not held")
+	}
+
+	// failing without releasing would hang the pool's Close
+	if stolen, ok, err := second.TryLock(ctx, name); err != nil || ok {
+		t.Errorf("TryLock of a held lock = %v, %v", ok, err)
+		if ok {
+			stolen.Release(ctx)
+		}
+	}
+	if other, ok, err := first.TryLock(ctx, name+"-other"); err != nil || !ok {
+		t.Errorf("TryLock of another name = %v, %v", ok, err)
+	} else {
+		other.Release(ctx)
+	}
+
+	lock.Release(ctx)
+	taken, ok, err := second.TryLock(ctx, name)
+	if err != nil || !ok {
+		t.Fatalf("TryLock after Release = %v, %v", ok, err)
+	}
+	taken.Release(ctx)
+}
+
+func TestTryLockConnectionLost(t *testing.T) {
+	first, second := testRepository(t), testRepository(t)
+	ctx := t.Context()
+	name := "locks-test:" + t.Name()
+
+	lock, ok, err := first.TryLock(ctx, name)
+	if err != nil || !ok {
+		t.Fatalf("TryLock = %v, %v", ok, err)
+	}
+	// the holder going away, e.g. a crashed instance
+	if err := lock.conn.Conn().Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if lock.Held(ctx) {
+		t.Error("lock of a closed connection is held")
+	}
+	// hands the dead connection back, the pool drops it
+	lock.Release(ctx)
+
+	taken, ok, err := second.TryLock(ctx, name)
+	if err != nil || !ok {
+		t.Fatalf("TryLock after the holder died = %v, %v", ok, err)
+	}
+	taken.Release(ctx)
+}
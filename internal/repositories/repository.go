@@ -115,6 +115,12 @@ func buildInsertQuery(entity models.Entity) (columns string, values []interface{
 		vals = append(vals, val)
 		i++
 	}
+	for key, val := range entity.BoolParameters {
+		cols = append(cols, key)
+		ph = append(ph, fmt.Sprintf("$%d", i))
+		vals = append(vals, val)
+		i++
+	}
 
 	return strings.Join(cols, ", "), vals, strings.Join(ph, ", ")
 }
@@ -144,6 +150,11 @@ func buildUpdateQuery(entity models.Entity) (setClause string, values []interfac
 		values = append(values, val)
 		i++
 	}
+	for key, val := range entity.BoolParameters {
+		setParts = append(setParts, fmt.Sprintf("%s = $%d", key, i))
+		values = append(values, val)
+		i++
+	}
 	if len(setParts) == 0 {
 		return "", nil
 	}
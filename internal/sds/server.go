@@ -0,0 +1,198 @@
+// Package sds serves certificates to Envoy over the Secret Discovery
+// Service, so a renewal reaches Envoy without touching its config or files.
+package sds
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	utils "ssl-manager/internal/utils"
+	"strings"
+	"sync"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	tlsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	secretv3 "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	cachev3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	resourcev3 "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	serverv3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Server holds the secrets handed to Envoy. Every Envoy connecting gets
+// the secrets it asks for by name, whatever its node id, and is pushed a
+// new version whenever one changes.
+type Server struct {
+	cache *cachev3.LinearCache
+	log   *utils.Logger
+
+	mu         sync.Mutex
+	secrets    map[string]published
+	generation uint64 // counts the calls of SetSecret
+}
+
+// published is a secret handed to the cache.
+type published struct {
+	digest     [32]byte // of the chain and key
+	generation uint64   // of the SetSecret that set it, 0 for SetSecrets
+}
+
+// Secret is the chain, leaf followed by intermediates, and key of a tls
+// certificate secret.
+type Secret struct {
+	Chain, Key []byte
+}
+
+func NewServer(log *utils.Logger) *Server {
+	return &Server{
+		cache:   cachev3.NewLinearCache(resourcev3.SecretType),
+		log:     log,
+		secrets: map[string]published{},
+	}
+}
+
+// SetSecret publishes a tls certificate secret named name, chain being the
+// leaf followed by the intermediates. Setting the secret it already holds
+// changes nothing, Envoy is only pushed new certificates.
+func (s *Server) SetSecret(name string, chain, key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+
+	secret := Secret{Chain: chain, Key: key}
+	digest := secret.digest()
+	if s.secrets[name].digest != digest {
+		if err := s.cache.UpdateResource(name, secret.resource(name)); err != nil {
+			return err
+		}
+		s.log.Info("Published sds secret ", name)
+	}
+	// unchanged it counts as set as well, SetSecrets must not remove it
+	s.secrets[name] = published{digest: digest, generation: s.generation}
+	return nil
+}
+
+// Generation marks the start of building a set for SetSecrets.
+func (s *Server) Generation() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.generation
+}
+
+// SetSecrets publishes secrets as the whole set: the changed ones are
+// pushed and every other secret is removed. Secrets SetSecret published
+// after generation, e.g. by a deploy while the set was read, are newer
+// than the set and left as they are.
+func (s *Server) SetSecrets(secrets map[string]Secret, generation uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	update := map[string]types.Resource{}
+	var remove []string
+	for name, secret := range secrets {
+		if current, ok := s.secrets[name]; ok && (current.generation > generation || current.digest == secret.digest()) {
+			continue
+		}
+		update[name] = secret.resource(name)
+	}
+	for name, current := range s.secrets {
+		if _, ok := secrets[name]; !ok && current.generation <= generation {
+			remove = append(remove, name)
+		}
+	}
+	if len(update) == 0 && len(remove) == 0 {
+		return nil
+	}
+
+	if err := s.cache.UpdateResources(update, remove); err != nil {
+		return err
+	}
+	for name := range update {
+		s.secrets[name] = published{digest: secrets[name].digest()}
+		s.log.Info("Published sds secret ", name)
+	}
+	for _, name := range remove {
+		delete(s.secrets, name)
+		s.log.Info("Removed sds secret ", name)
+	}
+	return nil
+}
+
+func (secret Secret) digest() [32]byte {
+	return sha256.Sum256(append(append(append([]byte{}, secret.Chain...), 0), secret.Key...))
+}
+
+func (secret Secret) resource(name string) *tlsv3.Secret {
+	return &tlsv3.Secret{
+		Name: name,
+		Type: &tlsv3.Secret_TlsCertificate{
+			TlsCertificate: &tlsv3.TlsCertificate{
+				CertificateChain: &corev3.DataSource{Specifier: &corev3.DataSource_InlineBytes{InlineBytes: secret.Chain}},
+				PrivateKey:       &corev3.DataSource{Specifier: &corev3.DataSource_InlineBytes{InlineBytes: secret.Key}},
+			},
+		},
+	}
+}
+
+// ListenAndServe serves SDS on cfg.Listen until ctx is done. A unix://
+// address is served in plain text, anything else needs mutual tls as the
+// secrets include private keys.
+func (s *Server) ListenAndServe(ctx context.Context, cfg utils.SDSConfig) error {
+	var (
+		listener net.Listener
+		options  []grpc.ServerOption
+		err      error
+	)
+	if path, ok := strings.CutPrefix(cfg.Listen, "unix://"); ok {
+		// a socket left over from an unclean exit
+		_ = os.Remove(path)
+		listener, err = net.Listen("unix", path)
+	} else {
+		var tlsConfig *tls.Config
+		if tlsConfig, err = serverTLS(cfg); err != nil {
+			return err
+		}
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		listener, err = net.Listen("tcp", cfg.Listen)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", cfg.Listen, err)
+	}
+
+	grpcServer := grpc.NewServer(options...)
+	secretv3.RegisterSecretDiscoveryServiceServer(grpcServer, serverv3.NewServer(ctx, s.cache, nil))
+	go func() {
+		<-ctx.Done()
+		grpcServer.GracefulStop()
+	}()
+
+	s.log.Info("Serving envoy sds on ", cfg.Listen)
+	return grpcServer.Serve(listener)
+}
+
+func serverTLS(cfg utils.SDSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sds certificate: %w", err)
+	}
+	caPEM, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sds client ca: %w", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", cfg.ClientCAFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
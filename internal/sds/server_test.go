@@ -0,0 +1,112 @@
+package sds
+
+import (
+	utils "ssl-manager/internal/utils"
+	"testing"
+
+	tlsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+)
+
+func TestSetSecret(t *testing.T) {
+	server := NewServer(utils.NewLogger("error"))
+
+	if err := server.SetSecret("example.com", []byte("chain"), []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	first := server.cache.GetResources()["example.com"]
+	if first == nil {
+		t.Fatal("secret was not published")
+	}
+	if got := first.(*tlsv3.Secret).GetTlsCertificate().GetCertificateChain().GetInlineBytes(); string(got) != "chain" {
+		t.Errorf("chain = %q, want %q", got, "chain")
+	}
+
+	// a refresh with the same certificate must not push a new version
+	if err := server.SetSecret("example.com", []byte("chain"), []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if server.cache.GetResources()["example.com"] != first {
+		t.Error("unchanged secret was published again")
+	}
+
+	for _, tt := range []struct {
+		name       string
+		chain, key string
+	}{
+		{"renewed chain", "chain2", "key"},
+		{"new key", "chain2", "key2"},
+		// the digest separates chain and key
+		{"shifted boundary", "chain2k", "ey2"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := server.cache.GetResources()["example.com"]
+			if err := server.SetSecret("example.com", []byte(tt.chain), []byte(tt.key)); err != nil {
+				t.Fatal(err)
+			}
+			if server.cache.GetResources()["example.com"] == previous {
+				t.Error("changed secret was not published")
+			}
+		})
+	}
+}
+
+func TestSetSecrets(t *testing.T) {
+	server := NewServer(utils.NewLogger("error"))
+	chainOf := func(name string) string {
+		secret, ok := server.cache.GetResources()[name]
+		if !ok {
+			return ""
+		}
+		return string(secret.(*tlsv3.Secret).GetTlsCertificate().GetCertificateChain().GetInlineBytes())
+	}
+
+	for _, name := range []string{"shop.example.com", "api.example.com"} {
+		if err := server.SetSecret(name, []byte(name+" chain"), []byte("key")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unchanged := server.cache.GetResources()["shop.example.com"]
+
+	// api.example.com was deleted, www.example.com added since
+	generation := server.Generation()
+	err := server.SetSecrets(map[string]Secret{
+		"shop.example.com": {Chain: []byte("shop.example.com chain"), Key: []byte("key")},
+		"www.example.com":  {Chain: []byte("www.example.com chain"), Key: []byte("key")},
+	}, generation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.cache.GetResources()["shop.example.com"] != unchanged {
+		t.Error("unchanged secret was published again")
+	}
+	if chainOf("www.example.com") != "www.example.com chain" {
+		t.Error("new secret was not published")
+	}
+	if chainOf("api.example.com") != "" {
+		t.Error("secret missing from the set was kept")
+	}
+
+	// a deploy publishing while the set is read wins over the set
+	generation = server.Generation()
+	if err := server.SetSecret("shop.example.com", []byte("renewed chain"), []byte("key2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetSecret("new.example.com", []byte("new.example.com chain"), []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	err = server.SetSecrets(map[string]Secret{
+		"shop.example.com": {Chain: []byte("shop.example.com chain"), Key: []byte("key")},
+	}, generation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chainOf("shop.example.com"); got != "renewed chain" {
+		t.Errorf("deployed secret replaced by %q", got)
+	}
+	if chainOf("new.example.com") == "" {
+		t.Error("secret deployed meanwhile was removed")
+	}
+	if chainOf("www.example.com") != "" {
+		t.Error("secret missing from the set was kept")
+	}
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	models "ssl-manager/internal/models"
+	"strings"
+	"time"
+)
+
+// ensureACMEAccount loads the stored account for the CA's directory into the
+// client, registering and storing a new one when none exists.
+func (s *Service) ensureACMEAccount(ca string) error {
+	s.accountMu.Lock()
+	defer s.accountMu.Unlock()
+
+	if s.client.HasAccount(ca) {
+		return nil
+	}
+
+	directoryURL := s.client.CADirectoryURL(ca)
+	account, err := s.repository.GetActiveACMEAccount(s.ctx, directoryURL)
+	if err == nil {
+		keyPEM, err := s.decryptAccountKey(account)
+		if err != nil {
+			return err
+		}
+		return s.client.LoadAccount(ca, keyPEM, valueOrEmpty(account.AccountURL))
+	}
+	if !errors.Is(err, models.ErrAccountNotFound) {
+		return fmt.Errorf("failed to fetch acme account: %w", err)
+	}
+
+	s.log.Info("No ACME account stored for ", directoryURL, ", registering one")
+	var emails []string
+	if s.cfg.Certs.Email != "" {
+		emails = []string{s.cfg.Certs.Email}
+	}
+
+	data, err := s.client.RegisterAccount(s.ctx, ca, emails, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.storeACMEAccount(directoryURL, data, "system"); err != nil {
+		return err
+	}
+
+	return s.client.LoadAccount(ca, data.Key, data.URL)
+}
+
+// RegisterACMEAccount registers a new account, optionally with explicit EAB
+// credentials, and makes it the one used for issuance with its CA.
+func (s *Service) RegisterACMEAccount(req models.RegisterACMEAccountReq) (string, error) {
+	s.log.Debug("Registering acme account............")
+	if req.CA == "" {
+		req.CA = s.cfg.Certs.DefaultCA
+	}
+	if !s.client.HasCA(req.CA) {
+		return "", fmt.Errorf("unknown ca: %s", req.CA)
+	}
+	if err := validateEmails(req.Emails); err != nil {
+		return "", err
+	}
+
+	var eab *models.EABCredentials
+	if req.EABKeyID != "" || req.EABHMACKey != "" {
+		if req.EABKeyID == "" || req.EABHMACKey == "" {
+			return "", errors.New("eab_key_id and eab_hmac_key must be set together")
+		}
+		eab = &models.EABCredentials{KeyID: req.EABKeyID, HMACKey: req.EABHMACKey}
+	}
+
+	s.accountMu.Lock()
+	defer s.accountMu.Unlock()
+
+	data, err := s.client.RegisterAccount(s.ctx, req.CA, req.Emails, eab)
+	if err != nil {
+		return "", err
+	}
+
+	accountID, err := s.storeACMEAccount(s.client.CADirectoryURL(req.CA), data, req.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	return accountID, s.client.LoadAccount(req.CA, data.Key, data.URL)
+}
+
+func (s *Service) storeACMEAccount(directoryURL string, data *models.ACMEAccountData, userID string) (string, error) {
+	encryptedKey, err := s.client.SealAccountKey(s.ctx, data.Key)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt account key: %w", err)
+	}
+
+	tx, err := s.repository.BeginTx(s.ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			s.log.Warn("Rollback started")
+			if rollbackErr := tx.Rollback(s.ctx); rollbackErr != nil {
+				s.log.Error("Rollback error: ", rollbackErr)
+			}
+		}
+	}()
+
+	accountEntity := models.Entity{
+		EntityName: "acme_accounts",
+		StringParameters: map[string]string{
+			"email":             strings.Join(data.Emails, ","),
+			"account_url":       data.URL,
+			"directory_url":     directoryURL,
+			"encrypted_key":     encryptedKey,
+			"registration_json": string(data.Registration),
+			"status":            data.Status,
+			"created_by":        userID,
+		},
+		IntegerParameters: make(map[string]int),
+		TimeParameters:    make(map[string]time.Time),
+		BoolParameters:    make(map[string]bool),
+	}
+	if data.EABKeyID != "" {
+		accountEntity.StringParameters["eab_key_id"] = data.EABKeyID
+	}
+
+	accountID, err := s.repository.InsertTx(s.ctx, tx, accountEntity)
+	if err != nil {
+		s.log.Error("Error while saving acme account: ", err)
+		return "", err
+	}
+
+	eventEntity := models.Entity{
+		EntityName: "events",
+		StringParameters: map[string]string{
+			"event_type": "manual_action",
+			"message":    fmt.Sprintf("ACME account %s registered with %s", accountID, directoryURL),
+			"metadata":   accountEventMetadata(data),
+			"created_by": userID,
+		},
+		IntegerParameters: make(map[string]int),
+		TimeParameters:    make(map[string]time.Time),
+		BoolParameters:    make(map[string]bool),
+	}
+	_, err = s.repository.InsertTx(s.ctx, tx, eventEntity)
+	if err != nil {
+		s.log.Error("Error while writing new event: ", err)
+		return "", err
+	}
+
+	err = tx.Commit(s.ctx)
+	if err != nil {
+		s.log.Error("Error while commit transaction: ", err)
+		return "", err
+	}
+
+	return accountID, nil
+}
+
+func (s *Service) GetACMEAccounts() (models.GetACMEAccountsResp, error) {
+	s.log.Debug("Fetching acme accounts............")
+	accounts, err := s.repository.GetACMEAccounts(s.ctx)
+	if err != nil {
+		s.log.Error("Error while getting acme accounts: ", err)
+		return models.GetACMEAccountsResp{}, err
+	}
+
+	resp := models.GetACMEAccountsResp{Accounts: []models.ACMEAccount{}}
+	for _, account := range accounts {
+		resp.Accounts = append(resp.Accounts, models.ConvertACMEAccountDTOToACMEAccount(account))
+	}
+	return resp, nil
+}
+
+func (s *Service) UpdateACMEAccount(req models.UpdateACMEAccountReq) error {
+	s.log.Debug("Updating acme account contacts............")
+	if err := validateEmails(req.Emails); err != nil {
+		return err
+	}
+
+	account, ca, keyPEM, err := s.getACMEAccountWithKey(req.AccountID)
+	if err != nil {
+		return err
+	}
+
+	data, err := s.client.UpdateAccount(s.ctx, ca, keyPEM, valueOrEmpty(account.AccountURL), req.Emails)
+	if err != nil {
+		return err
+	}
+
+	return s.saveACMEAccountChange(account.ID, req.UserID, map[string]string{
+		"email":             strings.Join(data.Emails, ","),
+		"registration_json": string(data.Registration),
+	}, "Contacts updated")
+}
+
+func (s *Service) RolloverACMEAccountKey(req models.ACMEAccountActionReq) error {
+	s.log.Debug("Rolling over acme account key............")
+	account, ca, keyPEM, err := s.getACMEAccountWithKey(req.AccountID)
+	if err != nil {
+		return err
+	}
+
+	data, err := s.client.RolloverAccountKey(s.ctx, ca, keyPEM, valueOrEmpty(account.AccountURL))
+	if err != nil {
+		return err
+	}
+
+	encryptedKey, err := s.client.SealAccountKey(s.ctx, data.Key)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt account key: %w", err)
+	}
+
+	return s.saveACMEAccountChange(account.ID, req.UserID, map[string]string{
+		"encrypted_key":     encryptedKey,
+		"registration_json": string(data.Registration),
+	}, "Account key rotated")
+}
+
+func (s *Service) DeactivateACMEAccount(req models.ACMEAccountActionReq) error {
+	s.log.Debug("Deactivating acme account............")
+	account, ca, keyPEM, err := s.getACMEAccountWithKey(req.AccountID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.client.DeactivateAccount(s.ctx, ca, keyPEM, valueOrEmpty(account.AccountURL)); err != nil {
+		return err
+	}
+
+	return s.saveACMEAccountChange(account.ID, req.UserID, map[string]string{
+		"status": "deactivated",
+	}, "Account deactivated")
+}
+
+// getACMEAccountWithKey loads an account together with its decrypted key and
+// the name of the configured CA it belongs to.
+func (s *Service) getACMEAccountWithKey(id string) (models.ACMEAccountDTO, string, []byte, error) {
+	account, err := s.repository.GetACMEAccountByID(s.ctx, id)
+	if err != nil {
+		s.log.Error("Error while getting acme account: ", err)
+		return account, "", nil, err
+	}
+	if account.Status != "valid" {
+		return account, "", nil, fmt.Errorf("acme account is %s", account.Status)
+	}
+
+	ca, ok := s.client.CAForDirectory(valueOrEmpty(account.DirectoryURL))
+	if !ok {
+		return account, "", nil, fmt.Errorf("acme account directory %s is not a configured ca", valueOrEmpty(account.DirectoryURL))
+	}
+
+	keyPEM, err := s.decryptAccountKey(account)
+	return account, ca, keyPEM, err
+}
+
+func (s *Service) decryptAccountKey(account models.ACMEAccountDTO) ([]byte, error) {
+	keyPEM, err := s.client.OpenAccountKey(s.ctx, valueOrEmpty(account.EncryptedKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key of acme account %s: %w", account.ID, err)
+	}
+	return keyPEM, nil
+}
+
+// saveACMEAccountChange updates the account row and records an audit event.
+func (s *Service) saveACMEAccountChange(accountID, userID string, params map[string]string, message string) error {
+	tx, err := s.repository.BeginTx(s.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			s.log.Warn("Rollback started")
+			if rollbackErr := tx.Rollback(s.ctx); rollbackErr != nil {
+				s.log.Error("Rollback error: ", rollbackErr)
+			}
+		}
+	}()
+
+	params["updated_by"] = userID
+	accountEntity := models.Entity{
+		EntityName:        "acme_accounts",
+		StringParameters:  params,
+		IntegerParameters: make(map[string]int),
+		TimeParameters:    make(map[string]time.Time),
+		BoolParameters:    make(map[string]bool),
+	}
+	err = s.repository.UpdateTx(s.ctx, tx, accountEntity, accountID)
+	if err != nil {
+		s.log.Error("Error while updating acme account: ", err)
+		return err
+	}
+
+	eventEntity := models.Entity{
+		EntityName: "events",
+		StringParameters: map[string]string{
+			"event_type": "manual_action",
+			"message":    fmt.Sprintf("ACME account %s: %s", accountID, message),
+			"created_by": userID,
+		},
+		IntegerParameters: make(map[string]int),
+		TimeParameters:    make(map[string]time.Time),
+		BoolParameters:    make(map[string]bool),
+	}
+	_, err = s.repository.InsertTx(s.ctx, tx, eventEntity)
+	if err != nil {
+		s.log.Error("Error while writing new event: ", err)
+		return err
+	}
+
+	err = tx.Commit(s.ctx)
+	if err != nil {
+		s.log.Error("Error while commit transaction: ", err)
+		return err
+	}
+
+	return nil
+}
+
+func validateEmails(emails []string) error {
+	for _, email := range emails {
+		if !strings.Contains(email, "@") {
+			return fmt.Errorf("invalid email: %s", email)
+		}
+	}
+	return nil
+}
+
+func accountEventMetadata(data *models.ACMEAccountData) string {
+	meta := map[string]interface{}{
+		"account_url": data.URL,
+		"status":      data.Status,
+	}
+	if data.EABKeyID != "" {
+		meta["eab_key_id"] = data.EABKeyID
+		meta["eab_required"] = data.EABRequired
+	}
+
+	encoded, err := json.Marshal(meta)
+	if err != nil {
+		return "{}"
+	}
+	return string(encoded)
+}
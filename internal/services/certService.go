@@ -1,23 +1,62 @@
 package services
 
 import (
+	"errors"
 	"fmt"
-	"os/exec"
+	"math/rand/v2"
+	clients "ssl-manager/internal/clients"
 	models "ssl-manager/internal/models"
+	storage "ssl-manager/internal/storage"
 	"time"
 )
 
+// renewalLeaderLock is held by the one instance running the renewal cycle.
+const renewalLeaderLock = "renewal-cycle"
+
+// StartCertificateRenewalScheduler runs the renewal cycle on every tick of
+// the instance holding the renewal lock. Instances sharing the database
+// take over from each other when the holder goes away.
 func (s *Service) StartCertificateRenewalScheduler() {
 	ticker := time.NewTicker(s.cfg.Certs.RenewalDuration * time.Hour)
 
 	go func() {
 		for range ticker.C {
+			if !s.leading() {
+				s.log.Debug("Renewal cycle runs on another instance")
+				continue
+			}
 			s.log.Info("Running certificate renewal cycle...")
 			s.RenewExpiringCertificates()
 		}
 	}()
 }
 
+// leading reports whether this instance holds the renewal lock, trying to
+// take it when no instance does. The lock is held as long as its database
+// connection lives.
+func (s *Service) leading() bool {
+	if s.leader != nil {
+		if s.leader.Held(s.ctx) {
+			return true
+		}
+		s.log.Warn("Lost the renewal lock")
+		s.leader.Release(s.ctx)
+		s.leader = nil
+	}
+
+	lock, ok, err := s.repository.TryLock(s.ctx, renewalLeaderLock)
+	if err != nil {
+		s.log.Error("Error taking the renewal lock: ", err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	s.log.Info("Took the renewal lock, this instance runs the renewal cycle")
+	s.leader = lock
+	return true
+}
+
 func (s *Service) RenewExpiringCertificates() {
 	domains, err := s.repository.GetDomainsList(s.ctx, models.DomainsFilters{})
 	if err != nil {
@@ -29,73 +68,262 @@ func (s *Service) RenewExpiringCertificates() {
 
 	for _, d := range domains {
 
-		if d.Details.Status == "deleted" || !d.Details.AutoRenew {
+		// the first certificate of the domain failed to issue, retried
+		// whatever auto_renew says as it was asked for explicitly
+		firstIssue := d.Details.Status == "renewal_failed" && d.Details.CertValidTo == nil
+		if d.Details.Status == "deleted" || (!d.Details.AutoRenew && !firstIssue) {
+			continue
+		}
+		// another instance may be running the cycle by now
+		if !s.leading() {
+			s.log.Warn("Renewal lock lost, stopping the renewal cycle")
+			return
+		}
+
+		if firstIssue {
+			if d.Details.NextIssueAt == nil || !now.Before(*d.Details.NextIssueAt) {
+				s.retryFirstIssuance(d)
+			}
 			continue
 		}
 
-		// renew threshold: 30 days before expiration
-		renewDate := d.Details.CertValidTo.Add(-30 * 24 * time.Hour)
+		certs, err := s.repository.GetCertificatesByDomain(s.ctx, d.ID)
+		if errors.Is(err, models.ErrCertificateNotFound) {
+			continue
+		}
+		if err != nil {
+			s.log.Error("Failed to fetch certificate for ", d.DomainName, ": ", err)
+			continue
+		}
 
-		if now.Before(renewDate) {
+		renewAt := s.scheduleRenewal(certs)
+		if now.Before(renewAt) {
 			continue
 		}
 
-		s.log.Info("Domain %s is approaching expiration (%s). Renewal triggered.",
-			d.DomainName, d.Details.CertValidTo.Format(time.RFC3339))
+		s.log.Info("Certificate for ", d.DomainName, " is due for renewal (", renewAt.Format(time.RFC3339), "). Renewal triggered.")
 
-		if err := s.RenewDomainCertificate(d); err != nil {
+		err = s.RenewDomainCertificate(d)
+		if errors.Is(err, models.ErrRenewalLocked) {
+			s.log.Info("Renewal of ", d.DomainName, " is running on another instance, skipping")
+			continue
+		}
+		if err != nil {
 			s.log.Error("Failed to renew certificate for", d.DomainName, ":", err)
 			s.createFailureEvent(d.ID, err)
 		}
 	}
 }
 
-func (s *Service) RenewDomainCertificate(domain models.DomainsDTO) error {
-	s.log.Info("Renewing certificate for domain: ", domain.DomainName)
+// scheduleRenewal returns when certs is due for renewal. The CA's ARI window
+// is refreshed whenever its Retry-After has passed and a random point inside
+// it is kept; without ARI a share of the lifetime is used.
+func (s *Service) scheduleRenewal(certs models.CertsDTO) time.Time {
+	now := time.Now()
+	if certs.RenewAt != nil && certs.ARINextCheck != nil && now.Before(*certs.ARINextCheck) {
+		return *certs.RenewAt
+	}
 
-	tx, err := s.repository.BeginTx(s.ctx)
+	var info *models.RenewalInfo
+	ca, err := s.caForIssuer(valueOrEmpty(certs.Issuer))
+	if err == nil {
+		info, err = s.client.RenewalInfo(s.ctx, ca, certs.CertPath)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to begin tx: %w", err)
+		if !errors.Is(err, clients.ErrARIUnsupported) && !errors.Is(err, models.ErrExternalIssuer) {
+			s.log.Warn("Failed to fetch renewal info for certificate ", certs.ID, ": ", err)
+		}
+		if certs.RenewAt != nil {
+			return *certs.RenewAt
+		}
+
+		renewAt := s.lifetimeRenewAt(certs.ValidFrom, certs.ValidTo)
+		s.updateRenewalSchedule(certs.ID, map[string]time.Time{"renew_at": renewAt})
+		return renewAt
+	}
+
+	// keep the chosen point while it stays inside the window
+	var renewAt time.Time
+	if certs.RenewAt != nil {
+		renewAt = *certs.RenewAt
+	}
+	if renewAt.IsZero() || renewAt.Before(info.WindowStart) || renewAt.After(info.WindowEnd) {
+		renewAt = info.WindowStart.Add(rand.N(info.WindowEnd.Sub(info.WindowStart)))
+		s.log.Info("Certificate ", certs.ID, " scheduled for renewal at ", renewAt.Format(time.RFC3339), " by ca ", ca)
+		if info.ExplanationURL != "" {
+			s.log.Info("Renewal window explanation: ", info.ExplanationURL)
+		}
+	}
+
+	s.updateRenewalSchedule(certs.ID, map[string]time.Time{
+		"renewal_window_start": info.WindowStart,
+		"renewal_window_end":   info.WindowEnd,
+		"renew_at":             renewAt,
+		"ari_next_check":       now.Add(info.RetryAfter),
+	})
+	return renewAt
+}
+
+// lifetimeRenewAt is the fallback renewal time for CAs without ARI.
+func (s *Service) lifetimeRenewAt(validFrom, validTo *time.Time) time.Time {
+	switch {
+	case validFrom != nil && validTo != nil:
+		lifetime := validTo.Sub(*validFrom)
+		return validFrom.Add(lifetime * time.Duration(s.cfg.Certs.RenewalLifetimePercent) / 100)
+	case validTo != nil:
+		return validTo.Add(-30 * 24 * time.Hour)
 	}
+	return time.Now()
+}
 
+// retryBackoff is the wait after attempts failed attempts, doubling from an
+// hour up to a day.
+func retryBackoff(attempts int) time.Duration {
+	return min(time.Hour<<min(max(attempts, 1)-1, 5), 24*time.Hour)
+}
+
+func (s *Service) updateRenewalSchedule(certID string, params map[string]time.Time) {
+	tx, err := s.repository.BeginTx(s.ctx)
+	if err != nil {
+		s.log.Error("Error start transaction while scheduling renewal: ", err)
+		return
+	}
 	defer func() {
 		if err != nil {
-			s.log.Warn("Rollback renewal tx")
-			_ = tx.Rollback(s.ctx)
+			s.log.Warn("Rollback started")
+			if rollbackErr := tx.Rollback(s.ctx); rollbackErr != nil {
+				s.log.Error("Rollback error: ", rollbackErr)
+			}
 		}
 	}()
 
+	certEntity := models.Entity{
+		EntityName:        "certificates",
+		StringParameters:  map[string]string{"updated_by": "system-renewal"},
+		IntegerParameters: make(map[string]int),
+		TimeParameters:    params,
+		BoolParameters:    make(map[string]bool),
+	}
+	err = s.repository.UpdateTx(s.ctx, tx, certEntity, certID)
+	if err != nil {
+		s.log.Error("Error while saving renewal schedule: ", err)
+		return
+	}
+
+	err = tx.Commit(s.ctx)
+	if err != nil {
+		s.log.Error("Error while commit transaction: ", err)
+	}
+}
+
+// RenewDomainCertificate renews the certificate of domain unless another
+// instance is renewing it, or renewed it since the cycle looked at it. The
+// renewal lock is held on a connection of its own for the whole renewal;
+// the order runs outside of any transaction, the one recording the new
+// certificate is only opened once it is saved.
+func (s *Service) RenewDomainCertificate(domain models.DomainsDTO) (err error) {
+	s.log.Info("Renewing certificate for domain: ", domain.DomainName)
+
+	lock, locked, err := s.repository.TryLock(s.ctx, renewalLock(domain.ID))
+	if err != nil {
+		return fmt.Errorf("failed to lock domain: %w", err)
+	}
+	if !locked {
+		return models.ErrRenewalLocked
+	}
+	defer lock.Release(s.ctx)
+
+	certs, err := s.repository.GetCertificatesByDomain(s.ctx, domain.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch certificate: %w", err)
+	}
+	// renewed by another instance since the cycle looked at it
+	if certs.RenewAt != nil && time.Now().Before(*certs.RenewAt) {
+		s.log.Info("Certificate for ", domain.DomainName, " was renewed meanwhile")
+		return nil
+	}
+
 	// request acme
-	certData, err := s.client.CreateCertificate(domain.DomainName)
+	order, err := s.domainOrder(domain)
+	if err != nil {
+		return err
+	}
+	if domain.Details.KeyReuse {
+		order.ReuseKeyPath = valueOrEmpty(certs.KeyPath)
+	}
+	certData, err := s.issueCertificate(order)
 	if err != nil {
 		return fmt.Errorf("failed to create new certificate: %w", err)
 	}
 
+	// the lock goes with its connection. Without it another instance may be
+	// renewing too, leave the live certificate to it
+	if !lock.Held(s.ctx) {
+		return errors.New("lost renewal lock")
+	}
+
 	// saving files
-	certPaths, err := s.client.SaveCertificateFiles(domain.DomainName, certData)
+	certPaths, err := s.client.SaveCertificateFiles(s.ctx, domain.DomainName, certData)
 	if err != nil {
 		return fmt.Errorf("failed to save cert files: %w", err)
 	}
+	// the new version is archived but not recorded, serve the old one
+	// unless a renewal that took over since made its own current
+	defer func() {
+		if err == nil {
+			return
+		}
+		linkErr := s.client.ActivateCertificateVersion(s.ctx, certs.CertPath, certPaths.Cert)
+		if errors.Is(linkErr, storage.ErrVersionReplaced) {
+			s.log.Warn("Certificate of ", domain.DomainName, " was replaced meanwhile, not restoring the previous one")
+		} else if linkErr != nil {
+			s.log.Error("Error restoring previous certificate: ", linkErr)
+		}
+	}()
+	if exportErr := s.writeExportFiles(*certPaths, domain.Details.ExportFormats, domain.Details.ExportPassword); exportErr != nil {
+		s.log.Error("Error while writing certificate exports: ", exportErr)
+	}
+
+	tx, err := s.repository.BeginTx(s.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			s.log.Warn("Rollback renewal tx")
+			_ = tx.Rollback(s.ctx)
+		}
+	}()
 
 	// updatind db certs
 	certEntity := models.Entity{
 		EntityName: "certificates",
 		StringParameters: map[string]string{
-			"cert_path":  certPaths.Cert,
-			"key_path":   certPaths.Key,
-			"chain_path": certPaths.Chain,
-			"updated_by": "system-renewal",
+			"issuer":         certData.Issuer,
+			"key_type":       certData.KeyType,
+			"cert_path":      certPaths.Cert,
+			"key_path":       certPaths.Key,
+			"chain_path":     certPaths.Chain,
+			"fullchain_path": certPaths.Fullchain,
+			"updated_by":     "system-renewal",
 		},
 		TimeParameters: map[string]time.Time{
 			"valid_from": certData.ValidFrom,
 			"valid_to":   certData.ValidTo,
 			"updated_at": time.Now(),
+			// the old window is stale, ask the CA again on the next cycle
+			"renew_at":       s.lifetimeRenewAt(&certData.ValidFrom, &certData.ValidTo),
+			"ari_next_check": time.Now(),
 		},
-		IntegerParameters: make(map[string]int),
-		BoolParameters:    make(map[string]bool),
+		// the new certificate has no failed renewals yet. A failed deploy
+		// restores the previous row and counts from its attempts
+		IntegerParameters: map[string]int{
+			"renewal_attempts": 0,
+		},
+		BoolParameters: make(map[string]bool),
 	}
 
-	err = s.repository.UpdateTx(s.ctx, tx, certEntity, domain.ID)
+	err = s.repository.UpdateTx(s.ctx, tx, certEntity, certs.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update certificate: %w", err)
 	}
@@ -126,28 +354,184 @@ func (s *Service) RenewDomainCertificate(domain models.DomainsDTO) error {
 		return fmt.Errorf("failed commit: %w", err)
 	}
 
-	s.log.Info("Domain %s successfully renewed!", domain.DomainName)
+	s.log.Info("Domain ", domain.DomainName, " successfully renewed!")
 
-	if err := s.reloadNginxInContainer(domain); err != nil {
-		return fmt.Errorf("certificate renewed but nginx reload failed: %w", err)
-	}
+	// a failed deploy puts the previous certificate back in service
+	s.deployCertificate(domain, certs.ID, *certPaths, &certs, "system-renewal")
 
 	return nil
 }
 
-func (s *Service) reloadNginxInContainer(domain models.DomainsDTO) error {
-	if domain.Details.NginxContainerName == "" {
+// renewalLock is the lock held while a certificate of the domain is issued,
+// by the renewal cycle or a retry of its first issuance.
+func renewalLock(domainID string) string {
+	return "renewal:" + domainID
+}
+
+// domainOrder is the order for a new certificate of domain.
+func (s *Service) domainOrder(domain models.DomainsDTO) (models.CertificateOrder, error) {
+	order := models.CertificateOrder{
+		CA:                 domain.Details.CA,
+		Domain:             domain.DomainName,
+		SANs:               domain.Details.SANs,
+		VerificationMethod: domain.Details.VerificationMethod,
+		KeyType:            domain.Details.KeyType,
+	}
+	if domain.Details.CSRSupplied {
+		csrPEM, err := s.repository.GetDomainCSR(s.ctx, domain.ID)
+		if err != nil {
+			return order, fmt.Errorf("failed to fetch csr: %w", err)
+		}
+		order.CSR, _, err = clients.ValidateCSR([]byte(csrPEM), append([]string{domain.DomainName}, domain.Details.SANs...))
+		if err != nil {
+			return order, fmt.Errorf("stored csr is no longer valid: %w", err)
+		}
+	}
+	return order, nil
+}
+
+func (s *Service) retryFirstIssuance(domain models.DomainsDTO) {
+	s.log.Info("Retrying the first issuance for ", domain.DomainName, " after ", domain.Details.IssueAttempts, " failed attempts")
+	err := s.issueFirstCertificate(domain)
+	if errors.Is(err, models.ErrRenewalLocked) {
+		s.log.Info("Issuance for ", domain.DomainName, " is running on another instance, skipping")
+		return
+	}
+	if err != nil {
+		s.log.Error("Failed to issue certificate for ", domain.DomainName, ": ", err)
+	}
+}
+
+// issueFirstCertificate issues the certificate of a domain whose issuance
+// failed when it was created. Another failure is recorded on the domain and
+// pushes the next attempt further out. It holds the renewal lock of the
+// domain like RenewDomainCertificate.
+func (s *Service) issueFirstCertificate(domain models.DomainsDTO) (err error) {
+	lock, locked, err := s.repository.TryLock(s.ctx, renewalLock(domain.ID))
+	if err != nil {
+		return fmt.Errorf("failed to lock domain: %w", err)
+	}
+	if !locked {
+		return models.ErrRenewalLocked
+	}
+	defer lock.Release(s.ctx)
+
+	// issued by another instance since the cycle looked at it
+	_, err = s.repository.GetCertificatesByDomain(s.ctx, domain.ID)
+	if err == nil {
 		return nil
 	}
+	if !errors.Is(err, models.ErrCertificateNotFound) {
+		return fmt.Errorf("failed to fetch certificate: %w", err)
+	}
 
-	cmd := exec.Command("docker", "exec", domain.Details.NginxContainerName, "nginx", "-s", "reload")
-	out, err := cmd.CombinedOutput()
+	order, err := s.domainOrder(domain)
+	if err != nil {
+		return err
+	}
+	certData, issueErr := s.issueCertificate(order)
 
+	tx, err := s.repository.BeginTx(s.ctx)
 	if err != nil {
-		s.log.Error("Docker nginx reload error:", string(out))
-		return fmt.Errorf("failed to reload nginx inside container: %w", err)
+		return fmt.Errorf("failed to begin tx: %w", err)
 	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(s.ctx)
+		}
+	}()
 
-	s.log.Info("Nginx inside container reloaded for domain:", domain.DomainName)
+	if issueErr != nil {
+		if err = s.recordIssueFailure(tx, domain.ID, domain.Details.IssueAttempts+1, issueErr, "system-renewal"); err != nil {
+			return err
+		}
+		if err = tx.Commit(s.ctx); err != nil {
+			return err
+		}
+		return fmt.Errorf("failed to create certificate: %w", issueErr)
+	}
+
+	if !lock.Held(s.ctx) {
+		err = errors.New("lost renewal lock")
+		return err
+	}
+	certPaths, err := s.client.SaveCertificateFiles(s.ctx, domain.DomainName, certData)
+	if err != nil {
+		return fmt.Errorf("failed to save cert files: %w", err)
+	}
+	if exportErr := s.writeExportFiles(*certPaths, domain.Details.ExportFormats, domain.Details.ExportPassword); exportErr != nil {
+		s.log.Error("Error while writing certificate exports: ", exportErr)
+	}
+
+	certID, err := s.insertFirstCertificate(tx, domain.ID, certData, certPaths, "system-renewal")
+	if err != nil {
+		return err
+	}
+	event := models.Entity{
+		EntityName: "events",
+		StringParameters: map[string]string{
+			"domain_id":  domain.ID,
+			"event_type": "created",
+			"message":    fmt.Sprintf("Certificate for '%s' issued after %d failed attempts", domain.DomainName, domain.Details.IssueAttempts),
+			"created_by": "system-renewal",
+		},
+		IntegerParameters: make(map[string]int),
+		TimeParameters: map[string]time.Time{
+			"created_at": time.Now(),
+		},
+		BoolParameters: make(map[string]bool),
+	}
+	if _, err = s.repository.InsertTx(s.ctx, tx, event); err != nil {
+		return fmt.Errorf("failed to insert event: %w", err)
+	}
+	if err = tx.Commit(s.ctx); err != nil {
+		return fmt.Errorf("failed commit: %w", err)
+	}
+
+	s.log.Info("Certificate for ", domain.DomainName, " issued")
+	s.deployCertificate(domain, certID, *certPaths, nil, "system-renewal")
 	return nil
 }
+
+// issueCertificate runs the order against the domain's CA and fails over to
+// the other configured CAs, in config order, when it does not succeed.
+func (s *Service) issueCertificate(order models.CertificateOrder) (*models.CertificateData, error) {
+	if order.CA == "" {
+		order.CA = s.cfg.Certs.DefaultCA
+	}
+
+	cas := []string{order.CA}
+	for _, ca := range s.client.CANames() {
+		if ca != order.CA {
+			cas = append(cas, ca)
+		}
+	}
+
+	var errs []error
+	for _, ca := range cas {
+		order.CA = ca
+		if order.KeyType != "" && !s.client.CASupportsKeyType(ca, order.KeyType) {
+			errs = append(errs, fmt.Errorf("ca %s does not issue %s certificates", ca, order.KeyType))
+			continue
+		}
+		if err := s.ensureACMEAccount(ca); err != nil {
+			s.log.Warn("No ACME account for ca ", ca, ": ", err)
+			errs = append(errs, err)
+			continue
+		}
+
+		certData, err := s.client.CreateCertificate(order)
+		if err != nil {
+			s.log.Warn("Issuance for ", order.Domain, " with ca ", ca, " failed: ", err)
+			errs = append(errs, err)
+			continue
+		}
+
+		if len(errs) > 0 {
+			s.log.Warn("Certificate for ", order.Domain, " issued by failover ca ", ca)
+		}
+		return certData, nil
+	}
+
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"os"
+	repositories "ssl-manager/internal/repositories"
+	utils "ssl-manager/internal/utils"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Hour},
+		{1, time.Hour},
+		{2, 2 * time.Hour},
+		{5, 16 * time.Hour},
+		{6, 24 * time.Hour},
+		{40, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := retryBackoff(tt.attempts); got != tt.want {
+			t.Errorf("retryBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// testInstance is a Service on a pool of its own to
+// SSL_MANAGER_TEST_DATABASE_URL, standing in for an instance.
+func testInstance(t *testing.T) *Service {
+	t.Helper()
+	url := os.Getenv("SSL_MANAGER_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("SSL_MANAGER_TEST_DATABASE_URL is not set")
+	}
+	db, err := pgxpool.New(t.Context(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	s := &Service{repository: &repositories.Repository{DB: db}, log: utils.NewLogger("error"), ctx: t.Context()}
+	// before db.Close, which waits for the lock's connection
+	t.Cleanup(func() {
+		if s.leader != nil {
+			s.leader.Release(context.Background())
+		}
+	})
+	return s
+}
+
+func TestLeaderHandoff(t *testing.T) {
+	a, b := testInstance(t), testInstance(t)
+
+	if !a.leading() {
+		t.Fatal("first instance did not take the renewal lock")
+	}
+	if b.leading() {
+		t.Fatal("two instances lead")
+	}
+	if !a.leading() {
+		t.Fatal("leader gave up the renewal lock")
+	}
+
+	// the leader's connection dies, e.g. with its instance
+	var terminated bool
+	err := b.repository.DB.QueryRow(t.Context(),
+		`SELECT COALESCE(bool_and(pg_terminate_backend(pid, 5000)), false) FROM pg_locks
+		WHERE locktype = 'advisory' AND objid = hashtext($1)::oid AND objsubid = 2`,
+		renewalLeaderLock,
+	).Scan(&terminated)
+	if err != nil || !terminated {
+		t.Fatalf("failed to terminate the leader: %v, %v", terminated, err)
+	}
+
+	if !b.leading() {
+		t.Fatal("second instance did not take over")
+	}
+	if a.leading() {
+		t.Error("old leader still leads")
+	}
+	if a.leader != nil {
+		t.Error("old leader kept its lock")
+	}
+}
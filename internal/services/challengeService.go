@@ -0,0 +1,12 @@
+package services
+
+import models "ssl-manager/internal/models"
+
+func (s *Service) GetHTTP01Response(token string) (string, error) {
+	s.log.Debug("Looking up http-01 token: ", token)
+	keyAuth, ok := s.client.HTTP01Response(token)
+	if !ok {
+		return "", models.ErrChallengeNotFound
+	}
+	return keyAuth, nil
+}
@@ -0,0 +1,432 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	deployers "ssl-manager/internal/deployers"
+	models "ssl-manager/internal/models"
+	sds "ssl-manager/internal/sds"
+	storage "ssl-manager/internal/storage"
+	"time"
+)
+
+// domainDeployers returns the deploy pipeline of domain. Domains without one
+// keep the behaviour of older releases: a docker reload of
+// nginx_container_name and reload_cmd when reload_nginx is set. With
+// certs.encryption.deploy_dir the decrypted files are copied to
+// <deploy_dir>/<domain>/ before anything else.
+func (s *Service) domainDeployers(domain models.DomainsDTO) ([]deployers.Deployer, error) {
+	var pipeline []deployers.Deployer
+	if dir := s.cfg.Certs.Encryption.DeployDir; dir != "" {
+		pipeline = append(pipeline, deployers.NewFileCopy(filepath.Join(dir, domain.DomainName), nil))
+	}
+
+	cfgs := domain.Details.Deployers
+	if len(cfgs) == 0 {
+		if domain.Details.NginxContainerName != "" {
+			cfgs = append(cfgs, models.DeployerConfig{Type: deployers.TypeDocker, Container: domain.Details.NginxContainerName})
+		}
+		if s.cfg.ReloadNginx && s.cfg.ReloadCmd != "" {
+			cfgs = append(cfgs, models.DeployerConfig{Type: deployers.TypeCommand, Command: []string{"sh", "-c", s.cfg.ReloadCmd}})
+		}
+	}
+
+	for i, cfg := range cfgs {
+		deployer, err := s.deployers.New(cfg, domain.DomainName)
+		if err != nil {
+			return nil, fmt.Errorf("deployer %d: %w", i+1, err)
+		}
+		pipeline = append(pipeline, deployer)
+	}
+	return pipeline, nil
+}
+
+// deployStep is the outcome of one deployer.
+type deployStep struct {
+	Deployer string `json:"deployer"`
+	Output   string `json:"output"`
+	Error    string `json:"error,omitempty"`
+}
+
+// deployCertificate runs the deploy pipeline of domain for the certificate
+// at paths and records each step as an event. It stops at the first failing
+// deployer. The issuance is committed by then and stands either way, so
+// failures are only logged and recorded. When previous is given, the
+// certificate paths replaced, a failed deploy rolls back to it. A successful
+// one is followed by the TLS check of certID when the domain has a
+// verify_address, run in the background with the row marked pending.
+func (s *Service) deployCertificate(domain models.DomainsDTO, certID string, paths models.CertificatePaths, previous *models.CertsDTO, createdBy string) {
+	pipeline, err := s.domainDeployers(domain)
+	if err != nil {
+		s.log.Error("Error building deployers for ", domain.DomainName, ": ", err)
+		s.createDeployEvent(domain.ID, "deploy_failed", err.Error(), map[string]string{"error": err.Error()}, createdBy)
+		return
+	}
+	if len(pipeline) == 0 {
+		return
+	}
+
+	cert, err := s.deploymentCertificate(domain, paths)
+	if err != nil {
+		s.log.Error("Error loading certificate of ", domain.DomainName, " for deploy: ", err)
+		s.createDeployEvent(domain.ID, "deploy_failed", err.Error(), map[string]string{"error": err.Error()}, createdBy)
+		return
+	}
+
+	steps := s.runDeployers(domain.DomainName, pipeline, cert)
+	for _, step := range steps {
+		if step.Error != "" {
+			message := fmt.Sprintf("Deployer %s failed: %s", step.Deployer, step.Error)
+			s.createDeployEvent(domain.ID, "deploy_failed", message, step, createdBy)
+			if previous != nil {
+				s.rollbackDeploy(domain, pipeline, *previous, paths.Cert, createdBy)
+			}
+			return
+		}
+		s.createDeployEvent(domain.ID, "deployed", "Certificate deployed by "+step.Deployer, step, createdBy)
+	}
+
+	if domain.Details.VerifyAddress != "" {
+		// the check waits for the server to reload, keep the request or
+		// cycle that deployed from waiting for it
+		if err := s.updateTLSVerification(certID, models.TLSVerification{Status: models.TLSVerificationPending}); err != nil {
+			s.log.Error("Error saving tls verification of ", domain.DomainName, ": ", err)
+		}
+		go s.verifyServedCertificate(domain, certID, cert, createdBy)
+	}
+}
+
+// verifyServedCertificate checks that the domain's verify_address serves
+// cert with a complete chain, retrying while the server may still be
+// reloading. The result is stored on the certificate row and a failure
+// raises a tls_verification_failed event.
+func (s *Service) verifyServedCertificate(domain models.DomainsDTO, certID string, cert *deployers.Certificate, createdBy string) {
+	var result models.TLSVerification
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(s.ctx, 30*time.Second)
+		result = s.client.VerifyServedCertificate(ctx, domain.Details.VerifyAddress, domain.DomainName, cert.Serial, cert.Fingerprint)
+		cancel()
+		// an incomplete chain does not change by waiting
+		if result.Status == models.TLSVerificationOK || result.Status == models.TLSVerificationIncompleteChain ||
+			attempt >= s.cfg.Certs.TLSVerify.Attempts {
+			break
+		}
+		time.Sleep(s.cfg.Certs.TLSVerify.Interval)
+	}
+
+	if err := s.updateTLSVerification(certID, result); err != nil {
+		s.log.Error("Error saving tls verification of ", domain.DomainName, ": ", err)
+	}
+	if result.Status == models.TLSVerificationOK {
+		s.log.Info(domain.Details.VerifyAddress, " serves the new certificate of ", domain.DomainName)
+		return
+	}
+
+	s.log.Error("TLS verification of ", domain.DomainName, " failed: ", result.Status, ": ", result.Error)
+	message := fmt.Sprintf("%s failed tls verification (%s): %s", domain.Details.VerifyAddress, result.Status, result.Error)
+	s.createDeployEvent(domain.ID, "tls_verification_failed", message, map[string]interface{}{
+		"address":              domain.Details.VerifyAddress,
+		"expected_serial":      cert.Serial,
+		"expected_fingerprint": cert.Fingerprint,
+		"result":               result,
+	}, createdBy)
+}
+
+func (s *Service) updateTLSVerification(certID string, result models.TLSVerification) error {
+	tx, err := s.repository.BeginTx(s.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(s.ctx)
+		}
+	}()
+
+	certEntity := models.Entity{
+		EntityName: "certificates",
+		StringParameters: map[string]string{
+			"tls_verification":       result.Status,
+			"tls_verification_error": result.Error,
+		},
+		TimeParameters:    make(map[string]time.Time),
+		IntegerParameters: make(map[string]int),
+		BoolParameters:    make(map[string]bool),
+	}
+	if result.Status != models.TLSVerificationPending {
+		certEntity.TimeParameters["tls_verified_at"] = time.Now()
+	}
+	if err = s.repository.UpdateTx(s.ctx, tx, certEntity, certID); err != nil {
+		return err
+	}
+	return tx.Commit(s.ctx)
+}
+
+// rollbackDeploy serves the previous certificate again after its successor
+// failed to deploy. The previous version is activated in the store, the
+// certificate row points at it again with the renewal retried after a
+// backoff, and the pipeline runs once more to reload the targets with it.
+// Nothing is rolled back once a version other than failed, the reference of
+// the certificate that failed, became current.
+func (s *Service) rollbackDeploy(domain models.DomainsDTO, pipeline []deployers.Deployer, previous models.CertsDTO, failed, createdBy string) {
+	s.log.Warn("Rolling back ", domain.DomainName, " to its previous certificate")
+	fail := func(err error) {
+		s.log.Error("Error rolling back ", domain.DomainName, ": ", err)
+		s.createDeployEvent(domain.ID, "deploy_rollback_failed", "Rollback to the previous certificate failed: "+err.Error(), map[string]string{"error": err.Error()}, createdBy)
+	}
+
+	err := s.client.ActivateCertificateVersion(s.ctx, previous.CertPath, failed)
+	if errors.Is(err, storage.ErrVersionReplaced) {
+		s.log.Warn("Certificate of ", domain.DomainName, " was replaced meanwhile, not rolling back")
+		return
+	}
+	if err != nil {
+		fail(fmt.Errorf("failed to activate previous version: %w", err))
+		return
+	}
+	if err := s.restoreCertificate(previous, createdBy); err != nil {
+		fail(fmt.Errorf("failed to restore certificate row: %w", err))
+		return
+	}
+
+	paths := models.CertificatePaths{
+		Cert:      previous.CertPath,
+		Key:       valueOrEmpty(previous.KeyPath),
+		Chain:     valueOrEmpty(previous.ChainPath),
+		Fullchain: valueOrEmpty(previous.FullchainPath),
+	}
+	cert, err := s.deploymentCertificate(domain, paths)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	steps := s.runDeployers(domain.DomainName, pipeline, cert)
+	if last := steps[len(steps)-1]; last.Error != "" {
+		s.log.Error("Error redeploying previous certificate of ", domain.DomainName, ": ", last.Error)
+		s.createDeployEvent(domain.ID, "deploy_rollback_failed", fmt.Sprintf("Previous certificate restored but deployer %s failed: %s", last.Deployer, last.Error), steps, createdBy)
+		return
+	}
+	s.createDeployEvent(domain.ID, "deploy_rolled_back", "Previous certificate restored and deployed", steps, createdBy)
+}
+
+// restoreCertificate points the certificate row back at previous after its
+// successor failed to deploy. The failure is counted in renewal_attempts
+// and the renewal pushed back by retryBackoff, as the renew_at of previous
+// has passed and would renew and fail again on every cycle.
+func (s *Service) restoreCertificate(previous models.CertsDTO, updatedBy string) error {
+	tx, err := s.repository.BeginTx(s.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(s.ctx)
+		}
+	}()
+
+	attempts := previous.RenewalAttempts + 1
+	retryAt := time.Now().Add(retryBackoff(attempts))
+	certEntity := models.Entity{
+		EntityName: "certificates",
+		StringParameters: map[string]string{
+			"issuer":         valueOrEmpty(previous.Issuer),
+			"key_type":       valueOrEmpty(previous.KeyType),
+			"cert_path":      previous.CertPath,
+			"key_path":       valueOrEmpty(previous.KeyPath),
+			"chain_path":     valueOrEmpty(previous.ChainPath),
+			"fullchain_path": valueOrEmpty(previous.FullchainPath),
+			"updated_by":     updatedBy,
+		},
+		TimeParameters: map[string]time.Time{
+			"updated_at": time.Now(),
+			"renew_at":   retryAt,
+			// keeps the ari window from moving renew_at before the retry
+			"ari_next_check": retryAt,
+		},
+		IntegerParameters: map[string]int{
+			"renewal_attempts": attempts,
+		},
+		BoolParameters: make(map[string]bool),
+	}
+	for column, value := range map[string]*time.Time{
+		"valid_from": previous.ValidFrom,
+		"valid_to":   previous.ValidTo,
+	} {
+		if value != nil {
+			certEntity.TimeParameters[column] = *value
+		}
+	}
+
+	if err = s.repository.UpdateTx(s.ctx, tx, certEntity, previous.ID); err != nil {
+		return err
+	}
+	return tx.Commit(s.ctx)
+}
+
+func (s *Service) deploymentCertificate(domain models.DomainsDTO, paths models.CertificatePaths) (*deployers.Certificate, error) {
+	password, err := s.exportPassword(domain.Details.ExportPassword)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.DeploymentCertificate(s.ctx, domain.DomainName, paths, domain.Details.ExportFormats, password)
+}
+
+// runDeployers runs pipeline in order up to the first failure, which is the
+// last step returned.
+func (s *Service) runDeployers(domainName string, pipeline []deployers.Deployer, cert *deployers.Certificate) []deployStep {
+	steps := make([]deployStep, 0, len(pipeline))
+	for _, deployer := range pipeline {
+		ctx, cancel := context.WithTimeout(s.ctx, s.cfg.Certs.DeployTimeout)
+		output, err := deployer.Deploy(ctx, cert)
+		cancel()
+
+		step := deployStep{Deployer: deployer.Name(), Output: output}
+		if err != nil {
+			s.log.Error("Deployer ", deployer.Name(), " failed for ", domainName, ": ", err, " ", output)
+			step.Error = err.Error()
+			return append(steps, step)
+		}
+		s.log.Info("Deployer ", deployer.Name(), " done for ", domainName)
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// StartSDSRefresh publishes the current certificates to the sds server now,
+// before it starts serving so Envoy never sees the secrets missing, and
+// again every interval. Only the instance running the renewal cycle deploys
+// renewals, the others pick them up from the database and store this way.
+func (s *Service) StartSDSRefresh(interval time.Duration) {
+	s.PublishSDSSecrets()
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			s.PublishSDSSecrets()
+		}
+	}()
+}
+
+// PublishSDSSecrets hands the current certificates of domains with envoy
+// deployers to the sds server, which keeps them in memory only. The
+// secrets are published as a whole, so the ones of deleted domains and
+// removed deployers go away; secrets it already holds are left as they are.
+func (s *Service) PublishSDSSecrets() {
+	server := s.deployers.SDS()
+	if server == nil {
+		return
+	}
+	generation := server.Generation()
+
+	domains, err := s.repository.GetDomainsList(s.ctx, models.DomainsFilters{})
+	if err != nil {
+		s.log.Error("Error fetching domains for sds: ", err)
+		return
+	}
+
+	secrets := map[string]sds.Secret{}
+	complete := true
+	for _, domain := range domains {
+		if domain.Details.Status == "deleted" {
+			continue
+		}
+		var pipeline []*deployers.EnvoySDS
+		for _, cfg := range domain.Details.Deployers {
+			cfg, err := s.deployers.Resolve(cfg, domain.DomainName)
+			if err != nil || cfg.Type != deployers.TypeEnvoy {
+				continue
+			}
+			deployer, err := s.deployers.New(cfg, domain.DomainName)
+			if err != nil {
+				s.log.Error("Error building envoy deployer for ", domain.DomainName, ": ", err)
+				continue
+			}
+			if envoy, ok := deployer.(*deployers.EnvoySDS); ok {
+				pipeline = append(pipeline, envoy)
+			}
+		}
+		if len(pipeline) == 0 {
+			continue
+		}
+
+		certs, err := s.repository.GetCertificatesByDomain(s.ctx, domain.ID)
+		if err != nil {
+			if !errors.Is(err, models.ErrCertificateNotFound) {
+				s.log.Error("Error fetching certificate of ", domain.DomainName, " for sds: ", err)
+				complete = false
+			}
+			continue
+		}
+		cert, err := s.deploymentCertificate(domain, certificatePaths(certs))
+		if err != nil {
+			s.log.Error("Error loading certificate of ", domain.DomainName, " for sds: ", err)
+			complete = false
+			continue
+		}
+		// not runDeployers, a refresh is no deploy worth logging
+		for _, envoy := range pipeline {
+			name, secret, err := envoy.Secret(cert)
+			if err != nil {
+				s.log.Error("Deployer ", envoy.Name(), " failed for ", domain.DomainName, ": ", err)
+				continue
+			}
+			secrets[name] = secret
+		}
+	}
+	// without every certificate the set is not whole, nothing is removed
+	// until a refresh reads them all
+	if !complete {
+		for name, secret := range secrets {
+			if err := server.SetSecret(name, secret.Chain, secret.Key); err != nil {
+				s.log.Error("Error publishing sds secret ", name, ": ", err)
+			}
+		}
+		return
+	}
+	if err := server.SetSecrets(secrets, generation); err != nil {
+		s.log.Error("Error publishing sds secrets: ", err)
+	}
+}
+
+// createDeployEvent records a deploy outcome with metadata as JSON: the
+// failing step, the steps of a rollback or the error. Discovery records
+// its events with it too.
+func (s *Service) createDeployEvent(domainID, eventType, message string, metadata interface{}, createdBy string) {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		data = []byte("{}")
+	}
+
+	event := models.Entity{
+		EntityName: "events",
+		StringParameters: map[string]string{
+			"domain_id":  domainID,
+			"event_type": eventType,
+			"message":    message,
+			"metadata":   string(data),
+			"created_by": createdBy,
+		},
+		IntegerParameters: make(map[string]int),
+		TimeParameters: map[string]time.Time{
+			"created_at": time.Now(),
+		},
+		BoolParameters: make(map[string]bool),
+	}
+	tx, err := s.repository.BeginTx(s.ctx)
+	if err != nil {
+		s.log.Error("Error start transaction while logging deploy: ", err)
+		return
+	}
+	if _, err = s.repository.InsertTx(s.ctx, tx, event); err != nil {
+		s.log.Error("Failed to log deploy event: ", err)
+		_ = tx.Rollback(s.ctx)
+		return
+	}
+	if err = tx.Commit(s.ctx); err != nil {
+		s.log.Error("Error while commit transaction: ", err)
+	}
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"errors"
+	deployers "ssl-manager/internal/deployers"
+	utils "ssl-manager/internal/utils"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRunDeployersStopsAtFailure(t *testing.T) {
+	cfg := &utils.Config{}
+	cfg.Certs.DeployTimeout = time.Second
+	s := &Service{log: utils.NewLogger("error"), cfg: cfg, ctx: t.Context()}
+
+	client := fake.NewClientset()
+	client.PrependReactor("create", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errForbidden
+	})
+	next := &countingDeployer{}
+	pipeline := []deployers.Deployer{deployers.NewKubernetesSecret(client, "web", "shop-tls"), next}
+	cert := &deployers.Certificate{Domain: "shop.example.com", Files: map[string][]byte{"key.pem": []byte("key")}}
+
+	steps := s.runDeployers(cert.Domain, pipeline, cert)
+	if len(steps) != 1 || steps[0].Deployer != "kubernetes:web/shop-tls" || steps[0].Error == "" {
+		t.Fatalf("steps %+v", steps)
+	}
+	if next.calls != 0 {
+		t.Error("deployer after the failed one ran")
+	}
+}
+
+var errForbidden = apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "shop-tls", errors.New("rbac"))
+
+type countingDeployer struct{ calls int }
+
+func (d *countingDeployer) Name() string { return "counting" }
+
+func (d *countingDeployer) Deploy(ctx context.Context, cert *deployers.Certificate) (string, error) {
+	d.calls++
+	return "", nil
+}
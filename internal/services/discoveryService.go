@@ -0,0 +1,343 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	deployers "ssl-manager/internal/deployers"
+	docker "ssl-manager/internal/docker"
+	models "ssl-manager/internal/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Container labels read by docker discovery.
+const (
+	labelDomains      = "ssl-manager.domains"      // a.com,b.com: one certificate, the first name is the domain
+	labelReload       = "ssl-manager.reload"       // nginx (default), none or a signal such as SIGHUP
+	labelVerification = "ssl-manager.verification" // http-01 (default) or dns-01
+	labelCA           = "ssl-manager.ca"
+
+	discoveryUser = "docker-discovery"
+)
+
+// StartDockerDiscovery registers the domains of running containers labelled
+// with ssl-manager.domains and follows the Docker events to pick up the ones
+// started later. The event stream is reopened when it drops, with a full
+// resync as events may have been missed in between. New domains are issued
+// by a worker of their own, so the event stream does not wait on the CA.
+func (s *Service) StartDockerDiscovery(client *docker.Client) {
+	s.discovery = newDiscoveryQueue()
+	go s.discovery.run(s.ctx, s.createDiscoveredDomain)
+
+	go func() {
+		for {
+			err := s.watchDocker(client)
+			s.log.Warn("Docker discovery interrupted, reconnecting: ", err)
+			time.Sleep(10 * time.Second)
+		}
+	}()
+}
+
+func (s *Service) watchDocker(client *docker.Client) error {
+	since := time.Now()
+	containers, err := client.ListContainers(s.ctx, labelDomains)
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+	for _, container := range containers {
+		s.registerContainer(container.Name(), container.Labels)
+	}
+
+	return client.Events(s.ctx, labelDomains, since, func(event docker.Event) {
+		name := event.Actor.Attributes["name"]
+		switch event.Action {
+		case "start":
+			s.registerContainer(name, event.Actor.Attributes)
+		case "destroy":
+			if s.cfg.Discovery.Docker.DisableAutoRenew {
+				s.releaseContainer(name, event.Actor.Attributes)
+			}
+		}
+	})
+}
+
+// containerDomain is the domain the labels of a container ask for.
+type containerDomain struct {
+	container      string
+	names          []string // lower case, the first one is the domain
+	nginxContainer string   // reloaded through nginx_container_name
+	pipeline       []models.DeployerConfig
+	labels         map[string]string
+}
+
+// containerDomainOf returns the domain of a labelled container, nil for
+// any other.
+func containerDomainOf(container string, labels map[string]string) (*containerDomain, error) {
+	names := splitLabel(labels[labelDomains])
+	if len(names) == 0 {
+		return nil, nil
+	}
+	nginxContainer, pipeline, err := reloadFromLabel(container, labels[labelReload])
+	if err != nil {
+		return nil, err
+	}
+	return &containerDomain{
+		container:      container,
+		names:          names,
+		nginxContainer: nginxContainer,
+		pipeline:       pipeline,
+		labels:         labels,
+	}, nil
+}
+
+// containerDomainChanges returns what to update on domain to follow the
+// container now holding it. Pipelines set through the api are left alone,
+// as is auto renew of domains registered otherwise. Auto renew turned off
+// when the container was removed is turned on again when reenable is set.
+func containerDomainChanges(domain models.DomainsDTO, d *containerDomain, reenable bool) (map[string]string, map[string]bool) {
+	params := map[string]string{}
+	if domain.Details.NginxContainerName != d.nginxContainer {
+		params["nginx_container_name"] = d.nginxContainer
+	}
+	discovered := domain.Details.CreatedBy == discoveryUser
+	if discovered && !sameDeployers(domain.Details.Deployers, d.pipeline) {
+		data, _ := json.Marshal(append([]models.DeployerConfig{}, d.pipeline...))
+		params["deployers"] = string(data)
+	}
+	bools := map[string]bool{}
+	if reenable && discovered && !domain.Details.AutoRenew {
+		bools["auto_renew"] = true
+	}
+	return params, bools
+}
+
+// containerReleases reports whether removing container turns off auto renew
+// of domain: it was registered by discovery and no other container took it
+// over since.
+func containerReleases(domain models.DomainsDTO, container string) bool {
+	return domain.Details.CreatedBy == discoveryUser && domain.Details.AutoRenew &&
+		(domain.Details.NginxContainerName == "" || domain.Details.NginxContainerName == container)
+}
+
+// registerContainer queues the domain a container's labels describe for
+// registration, or points an existing one at the container. The names are
+// only read when the domain is created.
+func (s *Service) registerContainer(container string, labels map[string]string) {
+	d, err := containerDomainOf(container, labels)
+	if err != nil {
+		s.log.Error("Ignoring container ", container, ": ", err)
+		return
+	}
+	if d == nil {
+		return
+	}
+
+	domain, err := s.repository.GetDomainByName(s.ctx, d.names[0])
+	if errors.Is(err, models.ErrDomainNotFound) {
+		if !s.discovery.push(d) {
+			s.log.Debug("Registration of ", d.names[0], " is already queued")
+		}
+		return
+	}
+	if err != nil {
+		s.log.Error("Error fetching domain ", d.names[0], ": ", err)
+		return
+	}
+
+	params, bools := containerDomainChanges(domain, d, s.cfg.Discovery.Docker.DisableAutoRenew)
+	if len(params) == 0 && len(bools) == 0 {
+		return
+	}
+	s.log.Info("Updating ", d.names[0], " from container ", container)
+	if err := s.updateDiscoveredDomain(domain.ID, discoveryUser, params, bools); err != nil {
+		s.log.Error("Error updating ", d.names[0], " from container ", container, ": ", err)
+	}
+}
+
+// createDiscoveredDomain registers a queued domain and issues its
+// certificate. Instances sharing the database and watching the same
+// containers take turns through the lock of the domain; the one that finds
+// it registered by another leaves it to the next event.
+func (s *Service) createDiscoveredDomain(d *containerDomain) {
+	lock, ok, err := s.repository.TryLock(s.ctx, "discovery:"+d.names[0])
+	if err != nil {
+		s.log.Error("Error locking ", d.names[0], " for registration: ", err)
+		return
+	}
+	if !ok {
+		s.log.Info("Registration of ", d.names[0], " is running on another instance, skipping")
+		return
+	}
+	defer lock.Release(s.ctx)
+
+	_, err = s.repository.GetDomainByName(s.ctx, d.names[0])
+	if err == nil {
+		s.log.Info("Domain ", d.names[0], " was registered meanwhile, skipping")
+		return
+	}
+	if !errors.Is(err, models.ErrDomainNotFound) {
+		s.log.Error("Error fetching domain ", d.names[0], ": ", err)
+		return
+	}
+
+	s.log.Info("Registering ", d.names[0], " from container ", d.container)
+	_, err = s.CreateDomain(models.CreateDomainReq{
+		CreatedBy:          discoveryUser,
+		Domain:             d.names[0],
+		SANs:               d.names[1:],
+		VerificationMethod: d.labels[labelVerification],
+		CA:                 d.labels[labelCA],
+		NginxContainerName: d.nginxContainer,
+		Pipeline:           d.pipeline,
+		AutoRenew:          true,
+	})
+	if err != nil {
+		s.log.Error("Error registering ", d.names[0], " from container ", d.container, ": ", err)
+	}
+}
+
+// releaseContainer turns off auto renew of a discovered domain whose
+// container was removed, unless another container took it over.
+func (s *Service) releaseContainer(container string, labels map[string]string) {
+	names := splitLabel(labels[labelDomains])
+	if len(names) == 0 {
+		return
+	}
+	domain, err := s.repository.GetDomainByName(s.ctx, names[0])
+	if err != nil {
+		if !errors.Is(err, models.ErrDomainNotFound) {
+			s.log.Error("Error fetching domain ", names[0], ": ", err)
+		}
+		return
+	}
+	if !containerReleases(domain, container) {
+		return
+	}
+
+	s.log.Info("Container ", container, " removed, disabling auto renew of ", names[0])
+	if err := s.updateDiscoveredDomain(domain.ID, discoveryUser, map[string]string{}, map[string]bool{"auto_renew": false}); err != nil {
+		s.log.Error("Error disabling auto renew of ", names[0], ": ", err)
+		return
+	}
+	s.createDeployEvent(domain.ID, "auto_renew_disabled",
+		fmt.Sprintf("Container %s was removed, auto renew disabled", container),
+		map[string]string{"container": container}, discoveryUser)
+}
+
+// discoveryQueue holds the domains waiting for registration, in order. A
+// domain already waiting or being registered is not queued again; once it
+// is registered, later events update it instead.
+type discoveryQueue struct {
+	mu      sync.Mutex
+	pending map[string]bool
+	queued  []*containerDomain
+	wake    chan struct{}
+}
+
+func newDiscoveryQueue() *discoveryQueue {
+	return &discoveryQueue{pending: map[string]bool{}, wake: make(chan struct{}, 1)}
+}
+
+// push queues d, false when its domain is already pending.
+func (q *discoveryQueue) push(d *containerDomain) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending[d.names[0]] {
+		return false
+	}
+	q.pending[d.names[0]] = true
+	q.queued = append(q.queued, d)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// run hands the queued domains to register one at a time until ctx is done.
+func (q *discoveryQueue) run(ctx context.Context, register func(*containerDomain)) {
+	for {
+		q.mu.Lock()
+		if len(q.queued) == 0 {
+			q.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.wake:
+			}
+			continue
+		}
+		d := q.queued[0]
+		q.queued = q.queued[1:]
+		q.mu.Unlock()
+
+		register(d)
+
+		q.mu.Lock()
+		delete(q.pending, d.names[0])
+		q.mu.Unlock()
+	}
+}
+
+func (s *Service) updateDiscoveredDomain(domainID, updatedBy string, params map[string]string, bools map[string]bool) error {
+	tx, err := s.repository.BeginTx(s.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(s.ctx)
+		}
+	}()
+
+	params["updated_by"] = updatedBy
+	domainEntity := models.Entity{
+		EntityName:       "domains",
+		StringParameters: params,
+		TimeParameters: map[string]time.Time{
+			"updated_at": time.Now(),
+		},
+		IntegerParameters: make(map[string]int),
+		BoolParameters:    bools,
+	}
+	if err = s.repository.UpdateTx(s.ctx, tx, domainEntity, domainID); err != nil {
+		return err
+	}
+	return tx.Commit(s.ctx)
+}
+
+// reloadFromLabel turns ssl-manager.reload into the container reloaded the
+// legacy way, through nginx_container_name, or a docker signal deployer.
+func reloadFromLabel(container, reload string) (string, []models.DeployerConfig, error) {
+	switch {
+	case reload == "" || reload == "nginx":
+		return container, nil, nil
+	case reload == "none":
+		return "", nil, nil
+	case strings.HasPrefix(reload, "SIG"):
+		return container, []models.DeployerConfig{{Type: deployers.TypeDocker, Container: container, Signal: reload}}, nil
+	}
+	return "", nil, fmt.Errorf("unknown %s %q", labelReload, reload)
+}
+
+func splitLabel(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func sameDeployers(a, b []models.DeployerConfig) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	left, _ := json.Marshal(a)
+	right, _ := json.Marshal(b)
+	return string(left) == string(right)
+}
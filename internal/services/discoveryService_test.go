@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"slices"
+	deployers "ssl-manager/internal/deployers"
+	models "ssl-manager/internal/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSplitLabel(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{"example.com", []string{"example.com"}},
+		{" Example.com, www.example.com ,,API.example.com", []string{"example.com", "www.example.com", "api.example.com"}},
+		{" , ", nil},
+	}
+	for _, tt := range tests {
+		if got := splitLabel(tt.value); !slices.Equal(got, tt.want) {
+			t.Errorf("splitLabel(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestReloadFromLabel(t *testing.T) {
+	tests := []struct {
+		reload         string
+		nginxContainer string
+		pipeline       []models.DeployerConfig
+		wantErr        bool
+	}{
+		{reload: "", nginxContainer: "web"},
+		{reload: "nginx", nginxContainer: "web"},
+		{reload: "none"},
+		{
+			reload:         "SIGHUP",
+			nginxContainer: "web",
+			pipeline:       []models.DeployerConfig{{Type: deployers.TypeDocker, Container: "web", Signal: "SIGHUP"}},
+		},
+		{reload: "restart", wantErr: true},
+		{reload: "sighup", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reload, func(t *testing.T) {
+			nginxContainer, pipeline, err := reloadFromLabel("web", tt.reload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if nginxContainer != tt.nginxContainer || !sameDeployers(pipeline, tt.pipeline) {
+				t.Errorf("got %q, %+v, want %q, %+v", nginxContainer, pipeline, tt.nginxContainer, tt.pipeline)
+			}
+		})
+	}
+}
+
+func TestContainerDomainOf(t *testing.T) {
+	d, err := containerDomainOf("web", map[string]string{labelDomains: "Shop.example.com,www.shop.example.com", labelReload: "SIGUSR1"})
+	if err != nil || d == nil {
+		t.Fatalf("containerDomainOf = %+v, %v", d, err)
+	}
+	if !slices.Equal(d.names, []string{"shop.example.com", "www.shop.example.com"}) || d.nginxContainer != "web" || len(d.pipeline) != 1 {
+		t.Errorf("got %+v", d)
+	}
+
+	if d, err := containerDomainOf("db", map[string]string{"other": "label"}); d != nil || err != nil {
+		t.Errorf("container without domains: %+v, %v", d, err)
+	}
+	if _, err := containerDomainOf("web", map[string]string{labelDomains: "example.com", labelReload: "restart"}); err == nil {
+		t.Error("unknown reload accepted")
+	}
+}
+
+func TestContainerDomainChanges(t *testing.T) {
+	signal := []models.DeployerConfig{{Type: deployers.TypeDocker, Container: "web", Signal: "SIGHUP"}}
+	domain := func(createdBy, nginxContainer string, autoRenew bool, pipeline []models.DeployerConfig) models.DomainsDTO {
+		d := models.DomainsDTO{}
+		d.Details.CreatedBy = createdBy
+		d.Details.NginxContainerName = nginxContainer
+		d.Details.AutoRenew = autoRenew
+		d.Details.Deployers = pipeline
+		return d
+	}
+	container := &containerDomain{container: "web", names: []string{"example.com"}, nginxContainer: "web", pipeline: signal}
+
+	tests := []struct {
+		name           string
+		domain         models.DomainsDTO
+		reenable       bool
+		nginxContainer bool
+		deployers      bool
+		autoRenew      bool
+	}{
+		{name: "unchanged", domain: domain(discoveryUser, "web", true, signal), reenable: true},
+		{name: "new container", domain: domain(discoveryUser, "old", true, signal), nginxContainer: true},
+		{name: "reload label changed", domain: domain(discoveryUser, "web", true, nil), deployers: true},
+		// the container is back after its removal turned auto renew off
+		{name: "restarted", domain: domain(discoveryUser, "web", false, signal), reenable: true, autoRenew: true},
+		{name: "turned off by hand", domain: domain(discoveryUser, "web", false, signal)},
+		{name: "api pipeline", domain: domain("admin", "web", false, nil), reenable: true},
+		{name: "api domain moved", domain: domain("admin", "old", true, nil), nginxContainer: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, bools := containerDomainChanges(tt.domain, container, tt.reenable)
+			if got, ok := params["nginx_container_name"]; ok != tt.nginxContainer || (ok && got != "web") {
+				t.Errorf("nginx_container_name change %v, want %v", params, tt.nginxContainer)
+			}
+			if _, ok := params["deployers"]; ok != tt.deployers {
+				t.Errorf("deployers updated: %v, want %v", ok, tt.deployers)
+			}
+			if on, ok := bools["auto_renew"]; ok != tt.autoRenew || (ok && !on) {
+				t.Errorf("auto_renew change %v, want %v", bools, tt.autoRenew)
+			}
+		})
+	}
+}
+
+func TestContainerReleases(t *testing.T) {
+	domain := func(createdBy, nginxContainer string, autoRenew bool) models.DomainsDTO {
+		d := models.DomainsDTO{}
+		d.Details.CreatedBy = createdBy
+		d.Details.NginxContainerName = nginxContainer
+		d.Details.AutoRenew = autoRenew
+		return d
+	}
+
+	tests := []struct {
+		name   string
+		domain models.DomainsDTO
+		want   bool
+	}{
+		{"its container", domain(discoveryUser, "web", true), true},
+		{"reloaded by signal only", domain(discoveryUser, "", true), true},
+		{"taken over", domain(discoveryUser, "web-2", true), false},
+		{"already off", domain(discoveryUser, "web", false), false},
+		{"created through the api", domain("admin", "web", true), false},
+	}
+	for _, tt := range tests {
+		if got := containerReleases(tt.domain, "web"); got != tt.want {
+			t.Errorf("%s: containerReleases = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDiscoveryQueue(t *testing.T) {
+	q := newDiscoveryQueue()
+	domain := func(name string) *containerDomain {
+		return &containerDomain{container: "web", names: []string{name}}
+	}
+
+	if !q.push(domain("a.example.com")) || !q.push(domain("b.example.com")) {
+		t.Fatal("push of a new domain refused")
+	}
+	if q.push(domain("a.example.com")) {
+		t.Error("domain queued twice")
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	var (
+		mu         sync.Mutex
+		registered []string
+	)
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.run(ctx, func(d *containerDomain) {
+			// registering a.example.com waits for the test
+			if d.names[0] == "a.example.com" {
+				<-release
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			registered = append(registered, d.names[0])
+		})
+	}()
+
+	// still pending while it is being registered
+	if q.push(domain("a.example.com")) {
+		t.Error("domain queued while being registered")
+	}
+	close(release)
+
+	waitRegistered := func(want ...string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			mu.Lock()
+			got := slices.Clone(registered)
+			mu.Unlock()
+			if slices.Equal(got, want) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("registered %v, want %v", registered, want)
+	}
+	waitRegistered("a.example.com", "b.example.com")
+
+	// registered domains may be queued again, e.g. after a failed issuance
+	if !q.push(domain("a.example.com")) {
+		t.Error("registered domain cannot be queued again")
+	}
+	waitRegistered("a.example.com", "b.example.com", "a.example.com")
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not stop with its context")
+	}
+}
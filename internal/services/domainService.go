@@ -1,9 +1,17 @@
 package services
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	clients "ssl-manager/internal/clients"
+	deployers "ssl-manager/internal/deployers"
 	models "ssl-manager/internal/models"
+	utils "ssl-manager/internal/utils"
+	"strings"
 	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 func (s *Service) GetDomains(filters models.GetDomainsReq) (models.GetDomainsResp, error) {
@@ -80,6 +88,73 @@ func (s *Service) CreateDomain(req models.CreateDomainReq) (string, error) {
 		}
 	}()
 
+	if !utils.IsValidDomain(req.Domain) {
+		err = fmt.Errorf("invalid domain: %s", req.Domain)
+		return "", err
+	}
+	req.SANs, err = normalizeSANs(req.Domain, req.SANs)
+	if err != nil {
+		return "", err
+	}
+
+	if req.VerificationMethod == "" {
+		req.VerificationMethod = "http-01"
+	}
+	if !utils.IsValidVerificationMethod(req.VerificationMethod) {
+		err = fmt.Errorf("unsupported verification method: %s", req.VerificationMethod)
+		return "", err
+	}
+
+	if req.CA == "" {
+		req.CA = s.cfg.Certs.DefaultCA
+	}
+	if !s.client.HasCA(req.CA) {
+		err = fmt.Errorf("unknown ca: %s", req.CA)
+		return "", err
+	}
+
+	// a supplied csr fixes the names and the key
+	var csr []byte
+	if req.CSR != "" {
+		var keyType string
+		csr, keyType, err = clients.ValidateCSR([]byte(req.CSR), append([]string{req.Domain}, req.SANs...))
+		if err != nil {
+			return "", err
+		}
+		if req.KeyType != "" && req.KeyType != keyType {
+			err = fmt.Errorf("key_type %s does not match the %s csr key", req.KeyType, keyType)
+			return "", err
+		}
+		req.KeyType = keyType
+		req.KeyReuse = false
+	}
+
+	exportPassword, err := s.validateExportFormats(req.ExportFormats, req.ExportPassword, req.CSR == "")
+	if err != nil {
+		return "", err
+	}
+	pipeline := req.Pipeline
+	if len(req.Deployers) > 0 {
+		pipeline, err = s.deployers.Pipeline(req.Deployers)
+	} else {
+		err = deployers.Validate(pipeline)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if req.KeyType == "" {
+		req.KeyType = utils.KeyTypeECDSAP256
+	}
+	if !utils.IsValidKeyType(req.KeyType) {
+		err = fmt.Errorf("unsupported key type: %s", req.KeyType)
+		return "", err
+	}
+	if !s.client.CASupportsKeyType(req.CA, req.KeyType) {
+		err = fmt.Errorf("ca %s does not issue %s certificates", req.CA, req.KeyType)
+		return "", err
+	}
+
 	// check for existance
 	exists, err := s.repository.IsDomainExists(s.ctx, req.Domain)
 	if err != nil {
@@ -96,134 +171,234 @@ func (s *Service) CreateDomain(req models.CreateDomainReq) (string, error) {
 			"domain_name":         req.Domain,
 			"status":              "pending",
 			"verification_method": req.VerificationMethod,
+			"ca":                  req.CA,
+			"key_type":            req.KeyType,
 			"created_by":          req.CreatedBy,
 		},
 		IntegerParameters: make(map[string]int),
 		TimeParameters:    make(map[string]time.Time),
 		BoolParameters: map[string]bool{
 			"auto_renew": req.AutoRenew,
+			"key_reuse":  req.KeyReuse,
 		},
 	}
+	if req.CSR != "" {
+		domainEntity.StringParameters["csr_pem"] = req.CSR
+	}
+	if len(req.ExportFormats) > 0 {
+		domainEntity.StringParameters["export_formats"] = strings.Join(req.ExportFormats, ",")
+	}
+	if exportPassword != "" {
+		domainEntity.StringParameters["export_password"] = exportPassword
+	}
+	if req.VerifyAddress != "" {
+		domainEntity.StringParameters["verify_address"] = req.VerifyAddress
+	}
+	if req.NginxContainerName != "" {
+		domainEntity.StringParameters["nginx_container_name"] = req.NginxContainerName
+	}
+	if len(pipeline) > 0 {
+		deployersJSON, _ := json.Marshal(pipeline)
+		domainEntity.StringParameters["deployers"] = string(deployersJSON)
+	}
 	domainID, err := s.repository.InsertTx(s.ctx, tx, domainEntity)
 	if err != nil {
 		s.log.Error("Error while creating domain: ", err)
 		return "", err
 	}
 
-	// calling client to create cert
-	certData, err := s.client.CreateCertificate(req.Domain)
-	if err != nil {
-		statusEntity := models.Entity{
-			EntityName: "domains",
+	// adding sans
+	for _, san := range req.SANs {
+		sanEntity := models.Entity{
+			EntityName: "domain_sans",
 			StringParameters: map[string]string{
-				"status":     "renewal_failed",
-				"updated_by": req.CreatedBy,
+				"domain_id":  domainID,
+				"san":        san,
+				"created_by": req.CreatedBy,
 			},
 			IntegerParameters: make(map[string]int),
 			TimeParameters:    make(map[string]time.Time),
 			BoolParameters:    make(map[string]bool),
 		}
-		err := s.repository.UpdateTx(s.ctx, tx, statusEntity, domainID)
+		_, err = s.repository.InsertTx(s.ctx, tx, sanEntity)
 		if err != nil {
-			s.log.Error("Error while updating domain status: ", err)
+			s.log.Error("Error while adding san: ", err)
 			return "", err
 		}
+	}
 
-		eventEntity := models.Entity{
-			EntityName: "events",
-			StringParameters: map[string]string{
-				"domain_id":  domainID,
-				"event_type": "failed",
-				"message":    fmt.Sprintf("Certificate issuance failed: %v", err),
-				"created_by": req.CreatedBy,
-			},
-			IntegerParameters: make(map[string]int),
-			TimeParameters:    make(map[string]time.Time),
-			BoolParameters:    make(map[string]bool),
+	// calling client to create cert
+	certData, issueErr := s.issueCertificate(models.CertificateOrder{
+		CA:                 req.CA,
+		Domain:             req.Domain,
+		SANs:               req.SANs,
+		VerificationMethod: req.VerificationMethod,
+		KeyType:            req.KeyType,
+		CSR:                csr,
+	})
+	if issueErr != nil {
+		s.log.Error("Error while issuing certificate: ", issueErr)
+		err = s.recordIssueFailure(tx, domainID, 1, issueErr, req.CreatedBy)
+		if err != nil {
+			return "", err
 		}
-		_, err = s.repository.InsertTx(s.ctx, tx, eventEntity)
+
+		// keep the failed domain and its event so the error can be inspected,
+		// the renewal cycle retries the issuance
+		err = tx.Commit(s.ctx)
 		if err != nil {
-			s.log.Error("Error while writing new event: ", err)
+			s.log.Error("Error while commit transaction: ", err)
 			return "", err
 		}
 
-		return "", fmt.Errorf("failed to create certificate: %w", err)
+		return "", fmt.Errorf("failed to create certificate: %w", issueErr)
 	}
 
 	// saving files and paths
-	certPaths, err := s.client.SaveCertificateFiles(req.Domain, certData)
+	certPaths, err := s.client.SaveCertificateFiles(s.ctx, req.Domain, certData)
 	if err != nil {
 		return "", fmt.Errorf("failed to save certificate files: %w", err)
 	}
+	if exportErr := s.writeExportFiles(*certPaths, req.ExportFormats, &exportPassword); exportErr != nil {
+		s.log.Error("Error while writing certificate exports: ", exportErr)
+	}
 
-	// saving certs to db
-	certEntity := models.Entity{
-		EntityName: "certificates",
+	certID, err := s.insertFirstCertificate(tx, domainID, certData, certPaths, req.CreatedBy)
+	if err != nil {
+		return "", err
+	}
+
+	// creating new event
+	eventEntity := models.Entity{
+		EntityName: "events",
 		StringParameters: map[string]string{
 			"domain_id":  domainID,
-			"issuer":     "Let's Encrypt",
-			"cert_path":  certPaths.Cert,
-			"key_path":   certPaths.Key,
-			"chain_path": certPaths.Chain,
+			"event_type": "created",
+			"message":    "Domain and certificate created successfully",
 			"created_by": req.CreatedBy,
 		},
 		IntegerParameters: make(map[string]int),
-		TimeParameters: map[string]time.Time{
-			"valid_from": certData.ValidFrom,
-			"valid_to":   certData.ValidTo,
-		},
-		BoolParameters: make(map[string]bool),
+		TimeParameters:    make(map[string]time.Time),
+		BoolParameters:    make(map[string]bool),
 	}
-	_, err = s.repository.InsertTx(s.ctx, tx, certEntity)
+	_, err = s.repository.InsertTx(s.ctx, tx, eventEntity)
 	if err != nil {
-		s.log.Error("Error while saving certs to db: ", err)
+		s.log.Error("Error while writing new event: ", err)
 		return "", err
 	}
 
-	// changing domain status
+	err = tx.Commit(s.ctx)
+	if err != nil {
+		s.log.Error("Error while commit transaction: ", err)
+		return "", err
+	}
+
+	s.deployCertificate(models.DomainsDTO{
+		ID:         domainID,
+		DomainName: req.Domain,
+		Details: models.DetailsDTO{
+			ExportFormats:      req.ExportFormats,
+			ExportPassword:     &exportPassword,
+			Deployers:          pipeline,
+			VerifyAddress:      req.VerifyAddress,
+			NginxContainerName: req.NginxContainerName,
+		},
+	}, certID, *certPaths, nil, req.CreatedBy)
+
+	s.log.Debug("Domain saved")
+	return domainID, nil
+}
+
+// recordIssueFailure marks a domain whose first certificate could not be
+// issued and schedules the retry after retryBackoff.
+func (s *Service) recordIssueFailure(tx pgx.Tx, domainID string, attempts int, issueErr error, updatedBy string) error {
 	statusEntity := models.Entity{
 		EntityName: "domains",
 		StringParameters: map[string]string{
-			"status":     "active",
-			"updated_by": req.CreatedBy,
+			"status":     "renewal_failed",
+			"updated_by": updatedBy,
 		},
-		IntegerParameters: make(map[string]int),
-		TimeParameters:    make(map[string]time.Time),
-		BoolParameters:    make(map[string]bool),
+		IntegerParameters: map[string]int{
+			"issue_attempts": attempts,
+		},
+		TimeParameters: map[string]time.Time{
+			"next_issue_at": time.Now().Add(retryBackoff(attempts)),
+		},
+		BoolParameters: make(map[string]bool),
 	}
-	err = s.repository.UpdateTx(s.ctx, tx, statusEntity, domainID)
-	if err != nil {
+	if err := s.repository.UpdateTx(s.ctx, tx, statusEntity, domainID); err != nil {
 		s.log.Error("Error while updating domain status: ", err)
-		return "", err
+		return err
 	}
 
-	// creating new event
 	eventEntity := models.Entity{
 		EntityName: "events",
 		StringParameters: map[string]string{
 			"domain_id":  domainID,
-			"event_type": "created",
-			"message":    "Domain and certificate created successfully",
-			"created_by": req.CreatedBy,
+			"event_type": "failed",
+			"message":    fmt.Sprintf("Certificate issuance failed: %v", issueErr),
+			"metadata":   errorMetadata(issueErr),
+			"created_by": updatedBy,
 		},
 		IntegerParameters: make(map[string]int),
 		TimeParameters:    make(map[string]time.Time),
 		BoolParameters:    make(map[string]bool),
 	}
-	_, err = s.repository.InsertTx(s.ctx, tx, eventEntity)
-	if err != nil {
+	if _, err := s.repository.InsertTx(s.ctx, tx, eventEntity); err != nil {
 		s.log.Error("Error while writing new event: ", err)
-		return "", err
+		return err
 	}
+	return nil
+}
 
-	err = tx.Commit(s.ctx)
+// insertFirstCertificate records the first certificate of a domain and
+// makes the domain active.
+func (s *Service) insertFirstCertificate(tx pgx.Tx, domainID string, certData *models.CertificateData, certPaths *models.CertificatePaths, createdBy string) (string, error) {
+	certEntity := models.Entity{
+		EntityName: "certificates",
+		StringParameters: map[string]string{
+			"domain_id":      domainID,
+			"issuer":         certData.Issuer,
+			"key_type":       certData.KeyType,
+			"cert_path":      certPaths.Cert,
+			"chain_path":     certPaths.Chain,
+			"fullchain_path": certPaths.Fullchain,
+			"created_by":     createdBy,
+		},
+		IntegerParameters: make(map[string]int),
+		TimeParameters: map[string]time.Time{
+			"valid_from": certData.ValidFrom,
+			"valid_to":   certData.ValidTo,
+			"renew_at":   s.lifetimeRenewAt(&certData.ValidFrom, &certData.ValidTo),
+		},
+		BoolParameters: make(map[string]bool),
+	}
+	if certPaths.Key != "" {
+		certEntity.StringParameters["key_path"] = certPaths.Key
+	}
+	certID, err := s.repository.InsertTx(s.ctx, tx, certEntity)
 	if err != nil {
-		s.log.Error("Error while commit transaction: ", err)
+		s.log.Error("Error while saving certs to db: ", err)
 		return "", err
 	}
 
-	s.log.Debug("Domain saved")
-	return domainID, nil
+	statusEntity := models.Entity{
+		EntityName: "domains",
+		StringParameters: map[string]string{
+			"status":     "active",
+			"updated_by": createdBy,
+		},
+		IntegerParameters: map[string]int{
+			"issue_attempts": 0,
+		},
+		TimeParameters: make(map[string]time.Time),
+		BoolParameters: make(map[string]bool),
+	}
+	if err := s.repository.UpdateTx(s.ctx, tx, statusEntity, domainID); err != nil {
+		s.log.Error("Error while updating domain status: ", err)
+		return "", err
+	}
+	return certID, nil
 }
 
 func (s *Service) DeleteDomain(filters models.DeleteDomainReq) error {
@@ -246,7 +421,7 @@ func (s *Service) DeleteDomain(filters models.DeleteDomainReq) error {
 	domainID := filters.DomainID
 	// check for existance
 	if filters.DomainName != "" {
-		domainID, err := s.repository.GetIDByNameTx(s.ctx, tx, models.Entity{
+		domainID, err = s.repository.GetIDByNameTx(s.ctx, tx, models.Entity{
 			EntityName:       "domains",
 			StringParameters: map[string]string{"domain_name": filters.DomainName},
 		})
@@ -255,7 +430,8 @@ func (s *Service) DeleteDomain(filters models.DeleteDomainReq) error {
 			return err
 		}
 		if domainID == "" {
-			return fmt.Errorf("domain don't exists")
+			err = fmt.Errorf("domain don't exists")
+			return err
 		}
 	}
 
@@ -279,36 +455,17 @@ func (s *Service) DeleteDomain(filters models.DeleteDomainReq) error {
 		return err
 	}
 
-	// fetchin certificates
+	// fetchin certificates, a domain whose issuance failed has none
 	certs, err := s.repository.GetCertificatesByDomain(s.ctx, domainID)
-	if err != nil {
+	if err != nil && !errors.Is(err, models.ErrCertificateNotFound) {
 		s.log.Error("Error fetching certificates: ", err)
 		return err
 	}
-
-	// deleting files
-	err = s.client.DeleteCertificateFiles(certs.CertPath, certs.KeyPath, *certs.ChainPath)
-	if err != nil {
-		s.log.Warn(fmt.Sprintf("Error deleting certificate files for domain %s: %v", filters.DomainName, err))
-	}
-
-	// mark certs deleted
-	certEntity := models.Entity{
-		EntityName: "certificates",
-		StringParameters: map[string]string{
-			"deleted_by": filters.UserID,
-			"updated_by": filters.UserID,
-		},
-		TimeParameters: map[string]time.Time{
-			"deleted_at": time.Now(),
-		},
-		IntegerParameters: make(map[string]int),
-		BoolParameters:    make(map[string]bool),
-	}
-	err = s.repository.UpdateTx(s.ctx, tx, certEntity, certs.ID)
-	if err != nil {
-		s.log.Error("Error updating certificate record: ", err)
-		return err
+	if err == nil {
+		err = s.deleteCertificateTx(tx, domainID, certs, filters)
+		if err != nil {
+			return err
+		}
 	}
 
 	// creating new event
@@ -340,3 +497,63 @@ func (s *Service) DeleteDomain(filters models.DeleteDomainReq) error {
 	s.log.Debug("Domain deleted")
 	return nil
 }
+
+// deleteCertificateTx optionally revokes the current certificate, removes its
+// files and marks the row deleted.
+func (s *Service) deleteCertificateTx(tx pgx.Tx, domainID string, certs models.CertsDTO, filters models.DeleteDomainReq) error {
+	if filters.Revoke && certs.RevokedAt == nil {
+		// revoking is scoped like RevokeCertificate
+		if _, err := s.repository.GetUserDomain(s.ctx, domainID, filters.UserID); err != nil {
+			return fmt.Errorf("failed to revoke certificate: %w", err)
+		}
+		if err := s.revokeCertificateTx(tx, domainID, certs, filters.RevocationReason, false, filters.UserID); err != nil {
+			return fmt.Errorf("failed to revoke certificate: %w", err)
+		}
+	}
+
+	// deleting files
+	err := s.client.DeleteCertificateFiles(s.ctx, certs.CertPath)
+	if err != nil {
+		s.log.Warn(fmt.Sprintf("Error deleting certificate files for domain %s: %v", domainID, err))
+	}
+
+	// mark certs deleted
+	certEntity := models.Entity{
+		EntityName: "certificates",
+		StringParameters: map[string]string{
+			"deleted_by": filters.UserID,
+			"updated_by": filters.UserID,
+		},
+		TimeParameters: map[string]time.Time{
+			"deleted_at": time.Now(),
+		},
+		IntegerParameters: make(map[string]int),
+		BoolParameters:    make(map[string]bool),
+	}
+	err = s.repository.UpdateTx(s.ctx, tx, certEntity, certs.ID)
+	if err != nil {
+		s.log.Error("Error updating certificate record: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// normalizeSANs validates the extra names of a domain and drops duplicates
+// and the primary name itself.
+func normalizeSANs(domain string, sans []string) ([]string, error) {
+	seen := map[string]bool{strings.ToLower(domain): true}
+	result := make([]string, 0, len(sans))
+	for _, san := range sans {
+		san = strings.ToLower(strings.TrimSpace(san))
+		if !utils.IsValidDomain(san) {
+			return nil, fmt.Errorf("invalid san: %s", san)
+		}
+		if seen[san] {
+			continue
+		}
+		seen[san] = true
+		result = append(result, san)
+	}
+	return result, nil
+}
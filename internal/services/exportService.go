@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	models "ssl-manager/internal/models"
+	utils "ssl-manager/internal/utils"
+)
+
+func (s *Service) GetCertificateExport(req models.ExportCertificateReq) (*models.CertificateExport, error) {
+	s.log.Debug("Exporting certificate............")
+	if !utils.IsValidExportFormat(req.Format) {
+		return nil, fmt.Errorf("unsupported export format: %s", req.Format)
+	}
+
+	// the key goes with it, only to the user who created the domain
+	if _, err := s.repository.GetUserDomain(s.ctx, req.DomainID, req.UserID); err != nil {
+		return nil, err
+	}
+	certs, err := s.repository.GetCertificatesByDomain(s.ctx, req.DomainID)
+	if err != nil {
+		s.log.Error("Error fetching certificate: ", err)
+		return nil, err
+	}
+
+	return s.client.ExportCertificate(s.ctx, certificatePaths(certs), req.Format, req.Password)
+}
+
+// validateExportFormats checks the formats a domain writes to disk and
+// encrypts the PKCS#12 password for storage.
+func (s *Service) validateExportFormats(formats []string, password string, hasKey bool) (string, error) {
+	needsPassword := false
+	for _, format := range formats {
+		if !utils.IsValidExportFormat(format) {
+			return "", fmt.Errorf("unsupported export format: %s", format)
+		}
+		if !hasKey && utils.ExportFormatNeedsKey(format) {
+			return "", fmt.Errorf("export format %s needs the private key, which a supplied csr does not provide", format)
+		}
+		if format == utils.ExportFormatPKCS12 || format == utils.ExportFormatPKCS12Legacy {
+			needsPassword = true
+		}
+	}
+
+	if !needsPassword {
+		return "", nil
+	}
+	if password == "" {
+		return "", errors.New("export_password is required for pkcs12 exports")
+	}
+	return utils.EncryptWithSecret(s.cfg.Certs.AccountKeySecret, []byte(password))
+}
+
+// writeExportFiles refreshes the configured exports after the certificate
+// files were written.
+func (s *Service) writeExportFiles(paths models.CertificatePaths, formats []string, encryptedPassword *string) error {
+	if len(formats) == 0 {
+		return nil
+	}
+
+	password, err := s.exportPassword(encryptedPassword)
+	if err != nil {
+		return err
+	}
+	return s.client.WriteExportFiles(s.ctx, paths, formats, password)
+}
+
+func (s *Service) exportPassword(encryptedPassword *string) (string, error) {
+	if encryptedPassword == nil || *encryptedPassword == "" {
+		return "", nil
+	}
+	decrypted, err := utils.DecryptWithSecret(s.cfg.Certs.AccountKeySecret, *encryptedPassword)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt export password: %w", err)
+	}
+	return string(decrypted), nil
+}
+
+func certificatePaths(certs models.CertsDTO) models.CertificatePaths {
+	return models.CertificatePaths{
+		Cert:      certs.CertPath,
+		Key:       valueOrEmpty(certs.KeyPath),
+		Chain:     valueOrEmpty(certs.ChainPath),
+		Fullchain: valueOrEmpty(certs.FullchainPath),
+	}
+}
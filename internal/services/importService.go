@@ -0,0 +1,234 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	models "ssl-manager/internal/models"
+	utils "ssl-manager/internal/utils"
+	"strings"
+	"time"
+)
+
+// ImportCertificate takes an existing certificate under management without
+// reissuing it. The domain is renewed through ACME like any other once it is
+// due, if auto renew is set.
+func (s *Service) ImportCertificate(req models.ImportCertificateReq) (string, error) {
+	s.log.Debug("Importing certificate...............")
+	certPEM, keyPEM, chainPEM := []byte(req.Cert), []byte(req.Key), []byte(req.Chain)
+	certData, names, err := s.client.ParseCertificateBundle(certPEM, keyPEM, chainPEM, req.CA)
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("certificate has no dns names")
+	}
+
+	if req.Domain == "" {
+		req.Domain = names[0]
+	}
+	if !utils.IsValidDomain(req.Domain) {
+		return "", fmt.Errorf("invalid domain: %s", req.Domain)
+	}
+	var sans []string
+	covered := false
+	for _, name := range names {
+		if name == req.Domain {
+			covered = true
+			continue
+		}
+		sans = append(sans, name)
+	}
+	if !covered {
+		return "", fmt.Errorf("certificate does not cover %s", req.Domain)
+	}
+	sans, err = normalizeSANs(req.Domain, sans)
+	if err != nil {
+		return "", err
+	}
+
+	if req.VerificationMethod == "" {
+		req.VerificationMethod = "http-01"
+		for _, name := range names {
+			if utils.IsWildcardDomain(name) {
+				req.VerificationMethod = "dns-01"
+			}
+		}
+	}
+	if !utils.IsValidVerificationMethod(req.VerificationMethod) {
+		return "", fmt.Errorf("unsupported verification method: %s", req.VerificationMethod)
+	}
+
+	if req.CA == "" {
+		req.CA = s.cfg.Certs.DefaultCA
+	}
+	if !s.client.HasCA(req.CA) {
+		return "", fmt.Errorf("unknown ca: %s", req.CA)
+	}
+
+	exportPassword, err := s.validateExportFormats(req.ExportFormats, req.ExportPassword, true)
+	if err != nil {
+		return "", err
+	}
+	pipeline, err := s.deployers.Pipeline(req.Deployers)
+	if err != nil {
+		return "", err
+	}
+
+	// renewals use the imported key type when the ca issues it
+	keyType := certData.KeyType
+	if keyType == "" || !s.client.CASupportsKeyType(req.CA, keyType) {
+		keyType = utils.KeyTypeECDSAP256
+	}
+
+	if time.Now().After(certData.ValidTo) {
+		s.log.Warn("Imported certificate for ", req.Domain, " expired at ", certData.ValidTo.Format(time.RFC3339))
+	}
+
+	exists, err := s.repository.IsDomainExists(s.ctx, req.Domain)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "", models.ErrDomainExists
+	}
+
+	tx, err := s.repository.BeginTx(s.ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			s.log.Warn("Rollback started")
+			if rollbackErr := tx.Rollback(s.ctx); rollbackErr != nil {
+				s.log.Error("Rollback error: ", rollbackErr)
+			}
+		}
+	}()
+
+	domainEntity := models.Entity{
+		EntityName: "domains",
+		StringParameters: map[string]string{
+			"domain_name":         req.Domain,
+			"status":              "active",
+			"verification_method": req.VerificationMethod,
+			"ca":                  req.CA,
+			"key_type":            keyType,
+			"created_by":          req.CreatedBy,
+		},
+		IntegerParameters: make(map[string]int),
+		TimeParameters:    make(map[string]time.Time),
+		BoolParameters: map[string]bool{
+			"auto_renew": req.AutoRenew,
+		},
+	}
+	if len(req.ExportFormats) > 0 {
+		domainEntity.StringParameters["export_formats"] = strings.Join(req.ExportFormats, ",")
+	}
+	if exportPassword != "" {
+		domainEntity.StringParameters["export_password"] = exportPassword
+	}
+	if req.VerifyAddress != "" {
+		domainEntity.StringParameters["verify_address"] = req.VerifyAddress
+	}
+	if len(pipeline) > 0 {
+		deployersJSON, _ := json.Marshal(pipeline)
+		domainEntity.StringParameters["deployers"] = string(deployersJSON)
+	}
+	domainID, err := s.repository.InsertTx(s.ctx, tx, domainEntity)
+	if err != nil {
+		s.log.Error("Error while creating domain: ", err)
+		return "", err
+	}
+
+	for _, san := range sans {
+		sanEntity := models.Entity{
+			EntityName: "domain_sans",
+			StringParameters: map[string]string{
+				"domain_id":  domainID,
+				"san":        san,
+				"created_by": req.CreatedBy,
+			},
+			IntegerParameters: make(map[string]int),
+			TimeParameters:    make(map[string]time.Time),
+			BoolParameters:    make(map[string]bool),
+		}
+		_, err = s.repository.InsertTx(s.ctx, tx, sanEntity)
+		if err != nil {
+			s.log.Error("Error while adding san: ", err)
+			return "", err
+		}
+	}
+
+	certPaths, err := s.client.SaveCertificateFiles(s.ctx, req.Domain, certData)
+	if err != nil {
+		return "", fmt.Errorf("failed to save certificate files: %w", err)
+	}
+	if exportErr := s.writeExportFiles(*certPaths, req.ExportFormats, &exportPassword); exportErr != nil {
+		s.log.Error("Error while writing certificate exports: ", exportErr)
+	}
+
+	certEntity := models.Entity{
+		EntityName: "certificates",
+		StringParameters: map[string]string{
+			"domain_id":      domainID,
+			"issuer":         certData.Issuer,
+			"key_type":       certData.KeyType,
+			"cert_path":      certPaths.Cert,
+			"key_path":       certPaths.Key,
+			"chain_path":     certPaths.Chain,
+			"fullchain_path": certPaths.Fullchain,
+			"created_by":     req.CreatedBy,
+		},
+		IntegerParameters: make(map[string]int),
+		TimeParameters: map[string]time.Time{
+			"valid_from": certData.ValidFrom,
+			"valid_to":   certData.ValidTo,
+			"renew_at":   s.lifetimeRenewAt(&certData.ValidFrom, &certData.ValidTo),
+		},
+		BoolParameters: make(map[string]bool),
+	}
+	certID, err := s.repository.InsertTx(s.ctx, tx, certEntity)
+	if err != nil {
+		s.log.Error("Error while saving certs to db: ", err)
+		return "", err
+	}
+
+	eventEntity := models.Entity{
+		EntityName: "events",
+		StringParameters: map[string]string{
+			"domain_id":  domainID,
+			"event_type": "created",
+			"message":    fmt.Sprintf("Certificate issued by %s imported, valid until %s", certData.Issuer, certData.ValidTo.Format(time.RFC3339)),
+			"created_by": req.CreatedBy,
+		},
+		IntegerParameters: make(map[string]int),
+		TimeParameters:    make(map[string]time.Time),
+		BoolParameters:    make(map[string]bool),
+	}
+	_, err = s.repository.InsertTx(s.ctx, tx, eventEntity)
+	if err != nil {
+		s.log.Error("Error while writing new event: ", err)
+		return "", err
+	}
+
+	err = tx.Commit(s.ctx)
+	if err != nil {
+		s.log.Error("Error while commit transaction: ", err)
+		return "", err
+	}
+
+	s.deployCertificate(models.DomainsDTO{
+		ID:         domainID,
+		DomainName: req.Domain,
+		Details: models.DetailsDTO{
+			ExportFormats:  req.ExportFormats,
+			ExportPassword: &exportPassword,
+			Deployers:      pipeline,
+			VerifyAddress:  req.VerifyAddress,
+		},
+	}, certID, *certPaths, nil, req.CreatedBy)
+
+	s.log.Debug("Certificate imported")
+	return domainID, nil
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	deployers "ssl-manager/internal/deployers"
+	models "ssl-manager/internal/models"
+	"strings"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Ingress annotations read by kubernetes discovery.
+const (
+	annotationEnabled      = "ssl-manager/enabled" // "true" to manage the tls hosts of the ingress
+	annotationVerification = "ssl-manager/verification"
+	annotationCA           = "ssl-manager/ca"
+
+	ingressDiscoveryUser = "kubernetes-discovery"
+)
+
+// StartIngressDiscovery registers a domain for every tls entry of the
+// ingresses annotated with ssl-manager/enabled: "true". The certificate
+// is deployed to the entry's secret. The watch runs until the process
+// exits and resyncs every ten minutes.
+func (s *Service) StartIngressDiscovery(client kubernetes.Interface) {
+	var release func(*networkingv1.Ingress)
+	if s.cfg.Discovery.Kubernetes.DisableAutoRenew {
+		release = s.releaseIngress
+	}
+	if err := watchIngresses(s.ctx, client, s.cfg.Discovery.Kubernetes.Namespace, s.registerIngress, release); err != nil {
+		s.log.Error("Error watching ingresses: ", err)
+	}
+}
+
+// watchIngresses calls register for every ingress added or updated in
+// namespace, all namespaces when empty, and release, if given, for every
+// ingress deleted, until ctx is done.
+func watchIngresses(ctx context.Context, client kubernetes.Interface, namespace string, register, release func(*networkingv1.Ingress)) error {
+	options := []informers.SharedInformerOption{}
+	if namespace != "" {
+		options = append(options, informers.WithNamespace(namespace))
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 10*time.Minute, options...)
+
+	informer := factory.Networking().V1().Ingresses().Informer()
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if ingress, ok := obj.(*networkingv1.Ingress); ok {
+				register(ingress)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if ingress, ok := obj.(*networkingv1.Ingress); ok {
+				register(ingress)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if ingress, ok := obj.(*networkingv1.Ingress); ok && release != nil {
+				release(ingress)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	factory.Start(ctx.Done())
+	return nil
+}
+
+// ingressDomain is the domain a tls entry of an ingress asks for.
+type ingressDomain struct {
+	names    []string // lower case, the first one is the domain
+	pipeline []models.DeployerConfig
+}
+
+// ingressDomains returns the domains of an annotated ingress, none for any
+// other.
+func (s *Service) ingressDomains(ingress *networkingv1.Ingress) []ingressDomain {
+	if ingress.Annotations[annotationEnabled] != "true" {
+		return nil
+	}
+	var domains []ingressDomain
+	for _, tls := range ingress.Spec.TLS {
+		if len(tls.Hosts) == 0 || tls.SecretName == "" {
+			s.log.Warn("Ignoring tls entry of ingress ", ingress.Namespace, "/", ingress.Name, " without hosts or secret")
+			continue
+		}
+		names := make([]string, 0, len(tls.Hosts))
+		for _, host := range tls.Hosts {
+			names = append(names, strings.ToLower(host))
+		}
+		domains = append(domains, ingressDomain{
+			names: names,
+			pipeline: []models.DeployerConfig{{
+				Type:      deployers.TypeKubernetes,
+				Namespace: ingress.Namespace,
+				Secret:    tls.SecretName,
+			}},
+		})
+	}
+	return domains
+}
+
+// ingressDomainChanges returns what to update on domain, registered from an
+// ingress before, to follow its current pipeline. Auto renew turned off
+// when the ingress was deleted is turned on again when reenable is set.
+func ingressDomainChanges(domain models.DomainsDTO, pipeline []models.DeployerConfig, reenable bool) (map[string]string, map[string]bool) {
+	params := map[string]string{}
+	if !sameDeployers(domain.Details.Deployers, pipeline) {
+		data, _ := json.Marshal(pipeline)
+		params["deployers"] = string(data)
+	}
+	bools := map[string]bool{}
+	if reenable && !domain.Details.AutoRenew {
+		bools["auto_renew"] = true
+	}
+	return params, bools
+}
+
+// registerIngress creates the domains of an annotated ingress, or points
+// the ones created from it before at the current secret. The names are only
+// read when a domain is created.
+func (s *Service) registerIngress(ingress *networkingv1.Ingress) {
+	for _, d := range s.ingressDomains(ingress) {
+		domain, err := s.repository.GetDomainByName(s.ctx, d.names[0])
+		if errors.Is(err, models.ErrDomainNotFound) {
+			s.log.Info("Registering ", d.names[0], " from ingress ", ingress.Namespace, "/", ingress.Name)
+			_, err = s.CreateDomain(models.CreateDomainReq{
+				CreatedBy:          ingressDiscoveryUser,
+				Domain:             d.names[0],
+				SANs:               d.names[1:],
+				VerificationMethod: ingress.Annotations[annotationVerification],
+				CA:                 ingress.Annotations[annotationCA],
+				Pipeline:           d.pipeline,
+				AutoRenew:          true,
+			})
+			if err != nil {
+				s.log.Error("Error registering ", d.names[0], " from ingress ", ingress.Namespace, "/", ingress.Name, ": ", err)
+			}
+			continue
+		}
+		if err != nil {
+			s.log.Error("Error fetching domain ", d.names[0], ": ", err)
+			continue
+		}
+		// domains registered otherwise are left alone
+		if domain.Details.CreatedBy != ingressDiscoveryUser {
+			continue
+		}
+
+		params, bools := ingressDomainChanges(domain, d.pipeline, s.cfg.Discovery.Kubernetes.DisableAutoRenew)
+		if len(params) == 0 && len(bools) == 0 {
+			continue
+		}
+		s.log.Info("Updating ", d.names[0], " from ingress ", ingress.Namespace, "/", ingress.Name)
+		if err := s.updateDiscoveredDomain(domain.ID, ingressDiscoveryUser, params, bools); err != nil {
+			s.log.Error("Error updating ", d.names[0], " from ingress ", ingress.Namespace, "/", ingress.Name, ": ", err)
+		}
+	}
+}
+
+// releaseIngress turns off auto renew of the domains created from a deleted
+// ingress.
+func (s *Service) releaseIngress(ingress *networkingv1.Ingress) {
+	if ingress.Annotations[annotationEnabled] != "true" {
+		return
+	}
+	for _, tls := range ingress.Spec.TLS {
+		if len(tls.Hosts) == 0 {
+			continue
+		}
+		name := strings.ToLower(tls.Hosts[0])
+		domain, err := s.repository.GetDomainByName(s.ctx, name)
+		if err != nil {
+			if !errors.Is(err, models.ErrDomainNotFound) {
+				s.log.Error("Error fetching domain ", name, ": ", err)
+			}
+			continue
+		}
+		if domain.Details.CreatedBy != ingressDiscoveryUser || !domain.Details.AutoRenew {
+			continue
+		}
+
+		s.log.Info("Ingress ", ingress.Namespace, "/", ingress.Name, " deleted, disabling auto renew of ", name)
+		if err := s.updateDiscoveredDomain(domain.ID, ingressDiscoveryUser, map[string]string{}, map[string]bool{"auto_renew": false}); err != nil {
+			s.log.Error("Error disabling auto renew of ", name, ": ", err)
+			continue
+		}
+		s.createDeployEvent(domain.ID, "auto_renew_disabled",
+			fmt.Sprintf("Ingress %s/%s was deleted, auto renew disabled", ingress.Namespace, ingress.Name),
+			map[string]string{"ingress": ingress.Namespace + "/" + ingress.Name}, ingressDiscoveryUser)
+	}
+}
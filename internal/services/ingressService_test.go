@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	deployers "ssl-manager/internal/deployers"
+	models "ssl-manager/internal/models"
+	utils "ssl-manager/internal/utils"
+	"sync"
+	"testing"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testIngress(namespace, name string, enabled bool, tls ...networkingv1.IngressTLS) *networkingv1.Ingress {
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       networkingv1.IngressSpec{TLS: tls},
+	}
+	if enabled {
+		ingress.Annotations = map[string]string{annotationEnabled: "true"}
+	}
+	return ingress
+}
+
+// ingressEvents records the calls of watchIngresses as "register ns/name"
+// or "release ns/name".
+type ingressEvents struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (e *ingressEvents) record(kind string) func(*networkingv1.Ingress) {
+	return func(ingress *networkingv1.Ingress) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.events = append(e.events, kind+" "+ingress.Namespace+"/"+ingress.Name)
+	}
+}
+
+// waitFor waits until event was recorded.
+func (e *ingressEvents) waitFor(t *testing.T, event string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		e.mu.Lock()
+		for _, got := range e.events {
+			if got == event {
+				e.mu.Unlock()
+				return
+			}
+		}
+		e.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no %q, got %v", event, e.events)
+}
+
+// watchedClientset returns a fake clientset holding objects and a channel
+// closed once an informer watches ingresses. The fake clientset drops
+// changes made between the informer's list and its watch.
+func watchedClientset(objects ...runtime.Object) (*fake.Clientset, <-chan struct{}) {
+	client := fake.NewClientset(objects...)
+	watching := make(chan struct{})
+	var once sync.Once
+	client.PrependWatchReactor("ingresses", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w, err := client.Tracker().Watch(action.GetResource(), action.GetNamespace())
+		once.Do(func() { close(watching) })
+		return true, w, err
+	})
+	return client, watching
+}
+
+func TestWatchIngresses(t *testing.T) {
+	client, watching := watchedClientset(testIngress("web", "shop", true))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	events := &ingressEvents{}
+	if err := watchIngresses(ctx, client, "web", events.record("register"), events.record("release")); err != nil {
+		t.Fatal(err)
+	}
+	events.waitFor(t, "register web/shop")
+	<-watching
+
+	ingresses := client.NetworkingV1().Ingresses("web")
+	created := testIngress("web", "blog", true)
+	if _, err := ingresses.Create(ctx, created, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	events.waitFor(t, "register web/blog")
+
+	created.Spec.TLS = []networkingv1.IngressTLS{{Hosts: []string{"blog.example.com"}, SecretName: "blog-tls"}}
+	events.mu.Lock()
+	events.events = nil
+	events.mu.Unlock()
+	if _, err := ingresses.Update(ctx, created, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	events.waitFor(t, "register web/blog")
+
+	if err := ingresses.Delete(ctx, "blog", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	events.waitFor(t, "release web/blog")
+
+	// other namespaces are not watched
+	if _, err := client.NetworkingV1().Ingresses("other").Create(ctx, testIngress("other", "api", true), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ingresses.Delete(ctx, "shop", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	events.waitFor(t, "release web/shop")
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	for _, event := range events.events {
+		if event == "register other/api" {
+			t.Error("ingress of another namespace registered")
+		}
+	}
+}
+
+// Without disable_auto_renew deletes are ignored.
+func TestWatchIngressesWithoutRelease(t *testing.T) {
+	client, watching := watchedClientset(testIngress("web", "shop", true))
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	events := &ingressEvents{}
+	if err := watchIngresses(ctx, client, "", events.record("register"), nil); err != nil {
+		t.Fatal(err)
+	}
+	events.waitFor(t, "register web/shop")
+	<-watching
+
+	if err := client.NetworkingV1().Ingresses("web").Delete(ctx, "shop", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// events arrive in order, the delete was handled once this is
+	if _, err := client.NetworkingV1().Ingresses("web").Create(ctx, testIngress("web", "blog", true), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	events.waitFor(t, "register web/blog")
+}
+
+func TestIngressDomains(t *testing.T) {
+	s := &Service{log: utils.NewLogger("error")}
+
+	tests := []struct {
+		name    string
+		ingress *networkingv1.Ingress
+		want    []ingressDomain
+	}{
+		{
+			name:    "not annotated",
+			ingress: testIngress("web", "shop", false, networkingv1.IngressTLS{Hosts: []string{"shop.example.com"}, SecretName: "shop-tls"}),
+		},
+		{
+			name: "one entry per domain",
+			ingress: testIngress("web", "shop", true,
+				networkingv1.IngressTLS{Hosts: []string{"Shop.Example.com", "www.shop.example.com"}, SecretName: "shop-tls"},
+				networkingv1.IngressTLS{Hosts: []string{"api.example.com"}, SecretName: "api-tls"},
+			),
+			want: []ingressDomain{
+				{
+					names:    []string{"shop.example.com", "www.shop.example.com"},
+					pipeline: []models.DeployerConfig{{Type: deployers.TypeKubernetes, Namespace: "web", Secret: "shop-tls"}},
+				},
+				{
+					names:    []string{"api.example.com"},
+					pipeline: []models.DeployerConfig{{Type: deployers.TypeKubernetes, Namespace: "web", Secret: "api-tls"}},
+				},
+			},
+		},
+		{
+			name: "entries without hosts or secret",
+			ingress: testIngress("web", "shop", true,
+				networkingv1.IngressTLS{SecretName: "default-tls"},
+				networkingv1.IngressTLS{Hosts: []string{"shop.example.com"}},
+			),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.ingressDomains(tt.ingress)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d domains, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !sameDeployers(got[i].pipeline, tt.want[i].pipeline) || len(got[i].names) != len(tt.want[i].names) {
+					t.Fatalf("domain %d: got %+v, want %+v", i, got[i], tt.want[i])
+				}
+				for j := range got[i].names {
+					if got[i].names[j] != tt.want[i].names[j] {
+						t.Errorf("domain %d: names %v, want %v", i, got[i].names, tt.want[i].names)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestIngressDomainChanges(t *testing.T) {
+	pipeline := []models.DeployerConfig{{Type: deployers.TypeKubernetes, Namespace: "web", Secret: "shop-tls"}}
+	domain := func(autoRenew bool, secret string) models.DomainsDTO {
+		d := models.DomainsDTO{}
+		d.Details.AutoRenew = autoRenew
+		d.Details.Deployers = []models.DeployerConfig{{Type: deployers.TypeKubernetes, Namespace: "web", Secret: secret}}
+		return d
+	}
+
+	tests := []struct {
+		name      string
+		domain    models.DomainsDTO
+		reenable  bool
+		deployers bool
+		autoRenew bool
+	}{
+		{name: "unchanged", domain: domain(true, "shop-tls"), reenable: true},
+		{name: "secret renamed", domain: domain(true, "old-tls"), deployers: true},
+		// the ingress is back after a delete turned auto renew off
+		{name: "recreated", domain: domain(false, "shop-tls"), reenable: true, autoRenew: true},
+		{name: "turned off by hand", domain: domain(false, "shop-tls")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, bools := ingressDomainChanges(tt.domain, pipeline, tt.reenable)
+			if _, ok := params["deployers"]; ok != tt.deployers {
+				t.Errorf("deployers updated: %v, want %v", ok, tt.deployers)
+			}
+			if on, ok := bools["auto_renew"]; ok != tt.autoRenew || (ok && !on) {
+				t.Errorf("auto_renew change %v, want %v", bools, tt.autoRenew)
+			}
+		})
+	}
+}
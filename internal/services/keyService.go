@@ -0,0 +1,50 @@
+package services
+
+import (
+	"fmt"
+	models "ssl-manager/internal/models"
+)
+
+// RotateKeyEncryptionKey re-wraps every stored private key and acme account
+// key with the current KEK. Run it after putting a new KEK first in the kek
+// file; the old KEKs can be dropped once it succeeds.
+func (s *Service) RotateKeyEncryptionKey() (*models.KeyRotationResp, error) {
+	s.log.Info("Re-wrapping stored private keys")
+	resp, err := s.client.RewrapKeys(s.ctx)
+	if err != nil {
+		s.log.Error("Error re-wrapping keys: ", err)
+		return resp, err
+	}
+	if err := s.rewrapAccountKeys(resp); err != nil {
+		s.log.Error("Error re-wrapping account keys: ", err)
+		return resp, err
+	}
+	s.log.Info(fmt.Sprintf("Keys re-wrapped: %d, encrypted: %d, unchanged: %d", resp.Rewrapped, resp.Encrypted, resp.Unchanged))
+	return resp, nil
+}
+
+func (s *Service) rewrapAccountKeys(resp *models.KeyRotationResp) error {
+	accounts, err := s.repository.GetACMEAccounts(s.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch acme accounts: %w", err)
+	}
+
+	for _, account := range accounts {
+		if valueOrEmpty(account.EncryptedKey) == "" {
+			continue
+		}
+		encryptedKey, changed, err := s.client.RewrapAccountKey(s.ctx, *account.EncryptedKey, resp)
+		if err != nil {
+			return fmt.Errorf("failed to re-wrap key of acme account %s: %w", account.ID, err)
+		}
+		if !changed {
+			continue
+		}
+		if err := s.saveACMEAccountChange(account.ID, "system", map[string]string{
+			"encrypted_key": encryptedKey,
+		}, "Account key re-wrapped"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	models "ssl-manager/internal/models"
+	utils "ssl-manager/internal/utils"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Service) RevokeCertificate(req models.RevokeCertificateReq) error {
+	s.log.Debug("Revoking certificate...............")
+	if !utils.IsValidRevocationReason(req.Reason) {
+		return fmt.Errorf("invalid revocation reason: %d", req.Reason)
+	}
+
+	// only the user who created the domain revokes its certificates
+	if _, err := s.repository.GetUserDomain(s.ctx, req.DomainID, req.UserID); err != nil {
+		return err
+	}
+	certs, err := s.repository.GetCertificateByID(s.ctx, req.DomainID, req.CertificateID)
+	if err != nil {
+		s.log.Error("Error fetching certificate: ", err)
+		return err
+	}
+	if certs.RevokedAt != nil {
+		return models.ErrCertificateRevoked
+	}
+
+	tx, err := s.repository.BeginTx(s.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			s.log.Warn("Rollback started")
+			if rollbackErr := tx.Rollback(s.ctx); rollbackErr != nil {
+				s.log.Error("Rollback error: ", rollbackErr)
+			}
+		}
+	}()
+
+	err = s.revokeCertificateTx(tx, req.DomainID, certs, req.Reason, req.UseCertificateKey, req.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(s.ctx)
+	if err != nil {
+		s.log.Error("Error while commit transaction: ", err)
+		return err
+	}
+
+	s.log.Debug("Certificate revoked")
+	return nil
+}
+
+// revokeCertificateTx revokes the certificate with the CA that issued it and
+// records the revocation in tx. The files are left in place.
+func (s *Service) revokeCertificateTx(tx pgx.Tx, domainID string, certs models.CertsDTO, reason int, useCertificateKey bool, userID string) error {
+	ca, err := s.caForIssuer(valueOrEmpty(certs.Issuer))
+	if err != nil {
+		return err
+	}
+
+	keyPath := ""
+	if useCertificateKey {
+		if certs.KeyPath == nil {
+			return errors.New("certificate was issued for a supplied csr, its key is not on file")
+		}
+		keyPath = *certs.KeyPath
+	} else if err := s.ensureACMEAccount(ca); err != nil {
+		return err
+	}
+
+	if err := s.client.RevokeCertificate(s.ctx, ca, certs.CertPath, keyPath, reason); err != nil {
+		s.log.Error("Error while revoking certificate: ", err)
+		return err
+	}
+
+	certEntity := models.Entity{
+		EntityName: "certificates",
+		StringParameters: map[string]string{
+			"revoked_by": userID,
+			"updated_by": userID,
+		},
+		IntegerParameters: map[string]int{
+			"revocation_reason": reason,
+		},
+		TimeParameters: map[string]time.Time{
+			"revoked_at": time.Now(),
+		},
+		BoolParameters: make(map[string]bool),
+	}
+	err = s.repository.UpdateTx(s.ctx, tx, certEntity, certs.ID)
+	if err != nil {
+		s.log.Error("Error updating certificate record: ", err)
+		return err
+	}
+
+	signedWith := "account_key"
+	if useCertificateKey {
+		signedWith = "certificate_key"
+	}
+	metadata, err := json.Marshal(map[string]interface{}{
+		"certificate_id": certs.ID,
+		"ca":             ca,
+		"reason":         reason,
+		"signed_with":    signedWith,
+	})
+	if err != nil {
+		return err
+	}
+
+	eventEntity := models.Entity{
+		EntityName: "events",
+		StringParameters: map[string]string{
+			"domain_id":  domainID,
+			"event_type": "revoked",
+			"message":    fmt.Sprintf("Certificate %s revoked with reason %d", certs.ID, reason),
+			"metadata":   string(metadata),
+			"created_by": userID,
+		},
+		IntegerParameters: make(map[string]int),
+		TimeParameters:    make(map[string]time.Time),
+		BoolParameters:    make(map[string]bool),
+	}
+	_, err = s.repository.InsertTx(s.ctx, tx, eventEntity)
+	if err != nil {
+		s.log.Error("Error while writing new event: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// caForIssuer maps certificates.issuer to a configured CA. Rows written before
+// multi-CA support hold a free-form issuer and fall back to the default CA.
+// Imported certificates no configured CA verifies have none.
+func (s *Service) caForIssuer(issuer string) (string, error) {
+	if s.client.HasCA(issuer) {
+		return issuer, nil
+	}
+	if strings.HasPrefix(issuer, models.ExternalIssuerPrefix) {
+		return "", models.ErrExternalIssuer
+	}
+	return s.cfg.Certs.DefaultCA, nil
+}
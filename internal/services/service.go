@@ -2,10 +2,14 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	clients "ssl-manager/internal/clients"
+	deployers "ssl-manager/internal/deployers"
 	models "ssl-manager/internal/models"
 	repositories "ssl-manager/internal/repositories"
 	utils "ssl-manager/internal/utils"
+	"sync"
 	"time"
 )
 
@@ -13,31 +17,63 @@ type ServiceInterface interface {
 	Validate(token string) (string, error)
 	GetDomains(filters models.GetDomainsReq) (models.GetDomainsResp, error)
 	CreateDomain(req models.CreateDomainReq) (string, error)
+	ImportCertificate(req models.ImportCertificateReq) (string, error)
 	DeleteDomain(filters models.DeleteDomainReq) error
+	RevokeCertificate(req models.RevokeCertificateReq) error
+	GetCertificateExport(req models.ExportCertificateReq) (*models.CertificateExport, error)
+	GetHTTP01Response(token string) (string, error)
+	GetACMEAccounts() (models.GetACMEAccountsResp, error)
+	RegisterACMEAccount(req models.RegisterACMEAccountReq) (string, error)
+	UpdateACMEAccount(req models.UpdateACMEAccountReq) error
+	RolloverACMEAccountKey(req models.ACMEAccountActionReq) error
+	DeactivateACMEAccount(req models.ACMEAccountActionReq) error
+	RotateKeyEncryptionKey() (*models.KeyRotationResp, error)
 }
 
 type Service struct {
 	client     *clients.Client
+	deployers  *deployers.Builder
 	repository *repositories.Repository
 	log        *utils.Logger
 	cfg        *utils.Config
 	ctx        context.Context
+	accountMu  sync.Mutex
+	leader     *repositories.Lock // held while this instance runs the renewal cycle
+	discovery  *discoveryQueue    // domains docker discovery is about to register
 }
 
-func NewService(cfg *utils.Config, client *clients.Client, repo *repositories.Repository, log *utils.Logger) (*Service, error) {
+func NewService(cfg *utils.Config, client *clients.Client, deployers *deployers.Builder, repo *repositories.Repository, log *utils.Logger) (*Service, error) {
 	ctx := context.Background()
 
-	return &Service{
+	if cfg.Certs.AccountKeySecret == "" {
+		return nil, errors.New("certs.account_key_secret is not configured")
+	}
+
+	s := &Service{
 		client:     client,
+		deployers:  deployers,
 		repository: repo,
 		log:        log,
 		cfg:        cfg,
 		ctx:        ctx,
-	}, nil
+	}
+
+	// not fatal, issuance retries before every order
+	for _, ca := range client.CANames() {
+		if err := s.ensureACMEAccount(ca); err != nil {
+			log.Warn("Failed to set up ACME account for ca ", ca, ": ", err)
+		}
+	}
+
+	return s, nil
 }
 
-func (s *Service) createFailureEvent(domainID string, err error) {
+func (s *Service) createFailureEvent(domainID string, failure error) {
 	tx, err := s.repository.BeginTx(s.ctx)
+	if err != nil {
+		s.log.Error("Error start transaction while logging failure: ", err)
+		return
+	}
 	defer func() {
 		if err != nil {
 			s.log.Warn("Rollback started")
@@ -51,7 +87,8 @@ func (s *Service) createFailureEvent(domainID string, err error) {
 		StringParameters: map[string]string{
 			"domain_id":  domainID,
 			"event_type": "renewal_failed",
-			"message":    err.Error(),
+			"message":    failure.Error(),
+			"metadata":   errorMetadata(failure),
 			"created_by": "system-renewal",
 		},
 		IntegerParameters: make(map[string]int),
@@ -70,3 +107,27 @@ func (s *Service) createFailureEvent(domainID string, err error) {
 		s.log.Error("Error while commit transaction: ", err)
 	}
 }
+
+// errorMetadata renders err as JSON for events.metadata, keeping the ACME
+// step and problem details when the error came from the order flow.
+func errorMetadata(err error) string {
+	meta := map[string]interface{}{"error": err.Error()}
+
+	var acmeErr *clients.ACMEError
+	if errors.As(err, &acmeErr) {
+		meta = acmeErr.Metadata()
+	}
+
+	data, marshalErr := json.Marshal(meta)
+	if marshalErr != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+func valueOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
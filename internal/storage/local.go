@@ -0,0 +1,392 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	utils "ssl-manager/internal/utils"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LocalStore keeps certificates under dir the way certbot does: every
+// version is archived as archive/<domain>/certN.pem, keyN.pem, ..., and
+// live/<domain>/ holds a link per file to the current version. The links of
+// a version are written to a directory of their own, live/.<domain>/vN, and
+// live/<domain> is a symlink to it swapped with a single rename, so readers
+// see every file of either the old or the new version, never a mix of both.
+// References are the absolute archive paths.
+type LocalStore struct {
+	dir       string
+	retention int
+	log       *utils.Logger
+
+	mu sync.Mutex // orders the swaps of the live links
+}
+
+func NewLocalStore(dir string, retention int, log *utils.Logger) *LocalStore {
+	return &LocalStore{dir: dir, retention: retention, log: log}
+}
+
+func (s *LocalStore) archiveDir(domain string) string {
+	return filepath.Join(s.dir, "archive", domain)
+}
+
+func (s *LocalStore) liveDir(domain string) string {
+	return filepath.Join(s.dir, "live", domain)
+}
+
+// linksDir holds the link directories of every version of domain.
+func (s *LocalStore) linksDir(domain string) string {
+	return filepath.Join(s.dir, "live", "."+domain)
+}
+
+func (s *LocalStore) linkDir(domain string, version int) string {
+	return filepath.Join(s.linksDir(domain), "v"+strconv.Itoa(version))
+}
+
+// versionDirName turns "v3" into 3.
+func versionDirName(name string) (int, bool) {
+	digits, ok := strings.CutPrefix(name, "v")
+	if !ok {
+		return 0, false
+	}
+	version, err := strconv.Atoi(digits)
+	return version, err == nil && version > 0
+}
+
+// archived returns the domain and version of a file in the archive. ok is
+// false for paths written before versioned storage.
+func (s *LocalStore) archived(ref string) (domain string, version int, ok bool) {
+	dir := filepath.Dir(ref)
+	if filepath.Dir(dir) != filepath.Join(s.dir, "archive") {
+		return "", 0, false
+	}
+	if _, version, ok = unversioned(filepath.Base(ref)); !ok {
+		return "", 0, false
+	}
+	return filepath.Base(dir), version, true
+}
+
+// versions returns the version of every archived file of domain.
+func (s *LocalStore) versions(domain string) (map[string]int, error) {
+	entries, err := os.ReadDir(s.archiveDir(domain))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	versions := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		if _, v, ok := unversioned(entry.Name()); ok && entry.Type().IsRegular() {
+			versions[entry.Name()] = v
+		}
+	}
+	return versions, nil
+}
+
+func (s *LocalStore) Save(ctx context.Context, domain string, files map[string][]byte) (map[string]string, error) {
+	if err := os.MkdirAll(s.archiveDir(domain), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create archive dir: %w", err)
+	}
+	if err := os.MkdirAll(s.linksDir(domain), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create live dir: %w", err)
+	}
+
+	versions, err := s.versions(domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	version := 1
+	for _, v := range versions {
+		version = max(version, v+1)
+	}
+
+	// archived files are created exclusively, a save that took the version
+	// meanwhile fails this one
+	refs := make(map[string]string, len(files))
+	for name, data := range files {
+		path := filepath.Join(s.archiveDir(domain), versioned(name, version))
+		if err := writeArchiveFile(path, data); err != nil {
+			for _, written := range refs {
+				os.Remove(written)
+			}
+			if errors.Is(err, os.ErrExist) {
+				err = ErrVersionTaken
+			}
+			return nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		refs[name] = path
+	}
+	if err := s.link(domain, version); err != nil {
+		return nil, fmt.Errorf("failed to link certificate: %w", err)
+	}
+
+	s.mu.Lock()
+	err = s.activate(domain, version)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to link certificate: %w", err)
+	}
+	if err := s.prune(domain, version); err != nil {
+		s.log.Warn("Pruning certificate archive of ", domain, ": ", err)
+	}
+	return refs, nil
+}
+
+func (s *LocalStore) Attach(ctx context.Context, ref string, files map[string][]byte) error {
+	domain, version, ok := s.archived(ref)
+	if !ok {
+		// the <storage_dir>/<domain> directory of releases before versioned
+		// storage, written in place as they did
+		for name, data := range files {
+			if err := os.WriteFile(filepath.Join(filepath.Dir(ref), name), data, 0600); err != nil {
+				return fmt.Errorf("failed to write %s: %w", name, err)
+			}
+		}
+		return nil
+	}
+
+	for name, data := range files {
+		file := versioned(name, version)
+		// a file written before is kept, archived files are never overwritten
+		if err := writeArchiveFile(filepath.Join(s.archiveDir(domain), file), data); err != nil && !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		err := os.Symlink(s.linkTarget(domain, file), filepath.Join(s.linkDir(domain, version), name))
+		if err != nil && !errors.Is(err, os.ErrExist) && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to link %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (s *LocalStore) Read(ctx context.Context, ref string) ([]byte, error) {
+	data, err := os.ReadFile(ref)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *LocalStore) Activate(ctx context.Context, ref, replaced string) error {
+	domain, version, ok := s.archived(ref)
+	if !ok {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if replaced != "" {
+		replacedDomain, replacedVersion, ok := s.archived(replaced)
+		if !ok || replacedDomain != domain {
+			return ErrForeignRef
+		}
+		current, ok := s.current(domain)
+		if !ok || current != replacedVersion {
+			return ErrVersionReplaced
+		}
+	}
+	if _, err := os.Stat(s.linkDir(domain, version)); errors.Is(err, os.ErrNotExist) {
+		// left behind by a save that failed before linking
+		if err := s.link(domain, version); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	return s.activate(domain, version)
+}
+
+func (s *LocalStore) Delete(ctx context.Context, ref string) error {
+	domain, _, ok := s.archived(ref)
+	if !ok {
+		// the flat <storage_dir>/<domain> directory of older releases
+		dir := filepath.Dir(ref)
+		if filepath.Dir(dir) != filepath.Clean(s.dir) {
+			return ErrForeignRef
+		}
+		return os.RemoveAll(dir)
+	}
+
+	for _, dir := range []string{s.liveDir(domain), s.linksDir(domain)} {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to delete live links: %w", err)
+		}
+	}
+	if err := os.RemoveAll(s.archiveDir(domain)); err != nil {
+		return fmt.Errorf("failed to delete archive: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalStore) List(ctx context.Context) ([]string, error) {
+	var refs []string
+	err := filepath.WalkDir(s.dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() && path == filepath.Join(s.dir, "live") {
+			return filepath.SkipDir
+		}
+		if entry.Type().IsRegular() {
+			refs = append(refs, path)
+		}
+		return nil
+	})
+	return refs, err
+}
+
+func (s *LocalStore) Update(ctx context.Context, ref string, data []byte) error {
+	if _, err := os.Stat(ref); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return writeFileAtomic(ref, data)
+}
+
+// writeArchiveFile writes one file of a version. Archived files are never
+// overwritten.
+func writeArchiveFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// linkTarget is the target of the link to the archived file in a link
+// directory, relative so the storage dir can be moved.
+func (s *LocalStore) linkTarget(domain, file string) string {
+	return filepath.Join("..", "..", "..", "archive", domain, file)
+}
+
+// link writes the link directory of version, a link per archived file. It
+// is built under a temporary name and renamed into place, so it is never
+// seen with some of the links missing.
+func (s *LocalStore) link(domain string, version int) error {
+	versions, err := s.versions(domain)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	tmp, err := os.MkdirTemp(s.linksDir(domain), ".v"+strconv.Itoa(version)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	linked := 0
+	for file, v := range versions {
+		name, _, _ := unversioned(file)
+		if v != version {
+			continue
+		}
+		if err := os.Symlink(s.linkTarget(domain, file), filepath.Join(tmp, name)); err != nil {
+			return fmt.Errorf("failed to link %s: %w", file, err)
+		}
+		linked++
+	}
+	if linked == 0 {
+		return ErrVersionGone
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.linkDir(domain, version))
+}
+
+// activate points live/<domain> at the link directory of version.
+func (s *LocalStore) activate(domain string, version int) error {
+	live := s.liveDir(domain)
+	target, err := filepath.Rel(filepath.Dir(live), s.linkDir(domain, version))
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(live), "."+domain+".tmp")
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, live); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// current returns the version live/<domain> links to.
+func (s *LocalStore) current(domain string) (version int, ok bool) {
+	target, err := os.Readlink(s.liveDir(domain))
+	if err != nil {
+		return 0, false
+	}
+	return versionDirName(filepath.Base(target))
+}
+
+// prune removes the versions older than the newest retention ones, their
+// archived files and link directories.
+func (s *LocalStore) prune(domain string, current int) error {
+	versions, err := s.versions(domain)
+	if err != nil {
+		return err
+	}
+	for file, v := range versions {
+		if pruned(v, current, s.retention) {
+			if err := os.Remove(filepath.Join(s.archiveDir(domain), file)); err != nil {
+				return err
+			}
+		}
+	}
+
+	entries, err := os.ReadDir(s.linksDir(domain))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if v, ok := versionDirName(entry.Name()); ok && pruned(v, current, s.retention) {
+			if err := os.RemoveAll(filepath.Join(s.linksDir(domain), entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data through a temporary file in the
+// same directory.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	utils "ssl-manager/internal/utils"
+	"strconv"
+	"testing"
+)
+
+func newLocalStore(t *testing.T, retention int) *LocalStore {
+	t.Helper()
+	return NewLocalStore(t.TempDir(), retention, utils.NewLogger("error"))
+}
+
+func readLive(t *testing.T, s *LocalStore, domain, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(s.liveDir(domain), name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestLocalStore(t *testing.T) {
+	testCertStore(t, newLocalStore(t, 2), "example.com")
+}
+
+func TestLocalStoreArchived(t *testing.T) {
+	s := NewLocalStore("/certs", 2, nil)
+	tests := []struct {
+		ref     string
+		domain  string
+		version int
+		ok      bool
+	}{
+		{"/certs/archive/example.com/cert3.pem", "example.com", 3, true},
+		{"/certs/archive/example.com/cert-legacy12.p12", "example.com", 12, true},
+		{"/certs/archive/example.com/cert.pem", "", 0, false},
+		{"/certs/archive/example.com/v3/cert.pem", "", 0, false},
+		{"/certs/live/example.com/cert.pem", "", 0, false},
+		{"/certs/example.com/cert.pem", "", 0, false},
+		{"/other/archive/example.com/cert3.pem", "", 0, false},
+	}
+	for _, tt := range tests {
+		domain, version, ok := s.archived(tt.ref)
+		if domain != tt.domain || version != tt.version || ok != tt.ok {
+			t.Errorf("archived(%q) = %q, %d, %v, want %q, %d, %v", tt.ref, domain, version, ok, tt.domain, tt.version, tt.ok)
+		}
+	}
+}
+
+func TestLocalStoreSave(t *testing.T) {
+	s := newLocalStore(t, 2)
+	ctx := t.Context()
+
+	var refs []map[string]string
+	for v := 1; v <= 4; v++ {
+		files := map[string][]byte{"cert.pem": []byte("cert " + strconv.Itoa(v))}
+		if v == 1 {
+			files["key.pem"] = []byte("key 1")
+		}
+		saved, err := s.Save(ctx, "example.com", files)
+		if err != nil {
+			t.Fatalf("Save %d: %v", v, err)
+		}
+		if want := filepath.Join(s.archiveDir("example.com"), "cert"+strconv.Itoa(v)+".pem"); saved["cert.pem"] != want {
+			t.Fatalf("Save %d: ref %q, want %q", v, saved["cert.pem"], want)
+		}
+		refs = append(refs, saved)
+		if got := readLive(t, s, "example.com", "cert.pem"); got != "cert "+strconv.Itoa(v) {
+			t.Fatalf("live cert after save %d is %q", v, got)
+		}
+	}
+
+	// the key of version 1 went with it, live is one version as a whole
+	if _, err := os.Stat(filepath.Join(s.liveDir("example.com"), "key.pem")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("live key.pem of an older version: %v", err)
+	}
+	if target, err := os.Readlink(s.liveDir("example.com")); err != nil || target != filepath.Join(".example.com", "v4") {
+		t.Errorf("live link points at %q, %v", target, err)
+	}
+	// live/<domain>/cert.pem links to the archived file, as with certbot
+	if target, err := filepath.EvalSymlinks(filepath.Join(s.liveDir("example.com"), "cert.pem")); err != nil || target != refs[3]["cert.pem"] {
+		t.Errorf("live cert.pem resolves to %q, %v", target, err)
+	}
+
+	// retention 2 keeps the previous version to roll back to
+	for v, saved := range refs {
+		_, err := s.Read(ctx, saved["cert.pem"])
+		if kept := v+1 >= 3; kept != (err == nil) {
+			t.Errorf("version %d: kept %v, read error %v", v+1, kept, err)
+		}
+		if _, err := os.Stat(s.linkDir("example.com", v+1)); (v+1 >= 3) != (err == nil) {
+			t.Errorf("version %d: link dir %v", v+1, err)
+		}
+	}
+	if err := s.Activate(ctx, refs[2]["cert.pem"], refs[3]["cert.pem"]); err != nil {
+		t.Fatalf("Activate previous: %v", err)
+	}
+	if got := readLive(t, s, "example.com", "cert.pem"); got != "cert 3" {
+		t.Errorf("live cert after rollback is %q", got)
+	}
+	// version 4 is no longer current, a late restore must leave version 3
+	if err := s.Activate(ctx, refs[3]["cert.pem"], refs[3]["cert.pem"]); !errors.Is(err, ErrVersionReplaced) {
+		t.Errorf("Activate replaced: got %v, want %v", err, ErrVersionReplaced)
+	}
+	if got := readLive(t, s, "example.com", "cert.pem"); got != "cert 3" {
+		t.Errorf("live cert after a refused activation is %q", got)
+	}
+	if err := s.Activate(ctx, refs[2]["cert.pem"], filepath.Join(s.archiveDir("other.com"), "cert3.pem")); !errors.Is(err, ErrForeignRef) {
+		t.Errorf("Activate replacing another domain: got %v, want %v", err, ErrForeignRef)
+	}
+	if err := s.Activate(ctx, refs[0]["cert.pem"], ""); !errors.Is(err, ErrVersionGone) {
+		t.Errorf("Activate pruned: got %v, want %v", err, ErrVersionGone)
+	}
+
+	if err := s.Attach(ctx, refs[2]["cert.pem"], map[string][]byte{"cert.p12": []byte("p12")}); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	if got := readLive(t, s, "example.com", "cert.p12"); got != "p12" {
+		t.Errorf("attached live file is %q", got)
+	}
+}
+
+func TestLocalStoreActivateRelinks(t *testing.T) {
+	s := newLocalStore(t, 2)
+	ctx := t.Context()
+
+	first, err := s.Save(ctx, "example.com", map[string][]byte{"cert.pem": []byte("cert 1"), "key.pem": []byte("key 1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Save(ctx, "example.com", map[string][]byte{"cert.pem": []byte("cert 2")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a save that failed before linking leaves the archived files only
+	if err := os.RemoveAll(s.linkDir("example.com", 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Activate(ctx, first["cert.pem"], ""); err != nil {
+		t.Fatalf("Activate: %v", err)
+	}
+	if got := readLive(t, s, "example.com", "key.pem"); got != "key 1" {
+		t.Errorf("live key is %q", got)
+	}
+}
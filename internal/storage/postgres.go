@@ -0,0 +1,294 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	utils "ssl-manager/internal/utils"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const postgresRefPrefix = "postgres:"
+
+// PostgresStore keeps certificate files encrypted in the certificate_files
+// table, so every instance sharing the database sees the same certificates.
+// References look like postgres:<domain>/<version>/<name>.
+type PostgresStore struct {
+	db        *pgxpool.Pool
+	secret    string
+	retention int
+}
+
+func NewPostgresStore(db *pgxpool.Pool, secret string, retention int) *PostgresStore {
+	return &PostgresStore{db: db, secret: secret, retention: retention}
+}
+
+func postgresRef(domain string, version int, name string) string {
+	return fmt.Sprintf("%s%s/%d/%s", postgresRefPrefix, domain, version, name)
+}
+
+func parsePostgresRef(ref string) (domain string, version int, name string, err error) {
+	rest, ok := strings.CutPrefix(ref, postgresRefPrefix)
+	if !ok {
+		return "", 0, "", ErrForeignRef
+	}
+	parts := strings.SplitN(rest, "/", 3)
+	if len(parts) != 3 {
+		return "", 0, "", fmt.Errorf("malformed reference %q", ref)
+	}
+	if version, err = strconv.Atoi(parts[1]); err != nil {
+		return "", 0, "", fmt.Errorf("malformed reference %q", ref)
+	}
+	return parts[0], version, parts[2], nil
+}
+
+func (s *PostgresStore) Save(ctx context.Context, domain string, files map[string][]byte) (map[string]string, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// a concurrent save of the same domain fails on the unique constraint
+	var version int
+	err = tx.QueryRow(ctx,
+		`SELECT COALESCE(MAX(version), 0) + 1 FROM certificate_files WHERE domain_name = $1`,
+		domain,
+	).Scan(&version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read versions: %w", err)
+	}
+
+	refs, err := s.insert(ctx, tx, domain, version, files)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx,
+		`UPDATE certificate_files SET live = (version = $2) WHERE domain_name = $1`,
+		domain, version,
+	); err != nil {
+		return nil, fmt.Errorf("failed to activate version: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM certificate_files WHERE domain_name = $1 AND version <= $2`,
+		domain, version-s.retention,
+	); err != nil {
+		return nil, fmt.Errorf("failed to prune versions: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed commit: %w", err)
+	}
+	return refs, nil
+}
+
+func (s *PostgresStore) Attach(ctx context.Context, ref string, files map[string][]byte) error {
+	domain, version, _, err := parsePostgresRef(ref)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		stored int
+		live   bool
+	)
+	err = tx.QueryRow(ctx,
+		`SELECT COUNT(*), COALESCE(bool_or(live), FALSE) FROM certificate_files WHERE domain_name = $1 AND version = $2`,
+		domain, version,
+	).Scan(&stored, &live)
+	if err != nil {
+		return fmt.Errorf("failed to read version: %w", err)
+	}
+	if stored == 0 {
+		return ErrVersionGone
+	}
+
+	// exports are rendered again on every attach, replace older ones
+	for name := range files {
+		if _, err := tx.Exec(ctx,
+			`DELETE FROM certificate_files WHERE domain_name = $1 AND version = $2 AND name = $3`,
+			domain, version, name,
+		); err != nil {
+			return fmt.Errorf("failed to replace %s: %w", name, err)
+		}
+	}
+	if _, err := s.insert(ctx, tx, domain, version, files); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE certificate_files SET live = $3 WHERE domain_name = $1 AND version = $2`,
+		domain, version, live,
+	); err != nil {
+		return fmt.Errorf("failed to activate files: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed commit: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Read(ctx context.Context, ref string) ([]byte, error) {
+	domain, version, name, err := parsePostgresRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var encrypted string
+	err = s.db.QueryRow(ctx,
+		`SELECT encrypted_data FROM certificate_files WHERE domain_name = $1 AND version = $2 AND name = $3`,
+		domain, version, name,
+	).Scan(&encrypted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := utils.DecryptWithSecret(s.secret, encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", ref, err)
+	}
+	return data, nil
+}
+
+func (s *PostgresStore) Activate(ctx context.Context, ref, replaced string) error {
+	domain, version, _, err := parsePostgresRef(ref)
+	if err != nil {
+		return err
+	}
+	// 0 matches no version, any is current then
+	replacedVersion := 0
+	if replaced != "" {
+		var replacedDomain string
+		replacedDomain, replacedVersion, _, err = parsePostgresRef(replaced)
+		if err != nil {
+			return err
+		}
+		if replacedDomain != domain {
+			return ErrForeignRef
+		}
+	}
+
+	// a single statement, the check and the swap see the same rows
+	tag, err := s.db.Exec(ctx,
+		`UPDATE certificate_files SET live = (version = $2)
+		WHERE domain_name = $1 AND EXISTS (
+			SELECT 1 FROM certificate_files WHERE domain_name = $1 AND version = $2
+		) AND ($3 = 0 OR EXISTS (
+			SELECT 1 FROM certificate_files WHERE domain_name = $1 AND version = $3 AND live
+		))`,
+		domain, version, replacedVersion,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to activate version: %w", err)
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+	if replacedVersion == 0 {
+		return ErrVersionGone
+	}
+
+	var stored bool
+	err = s.db.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM certificate_files WHERE domain_name = $1 AND version = $2)`,
+		domain, version,
+	).Scan(&stored)
+	if err != nil {
+		return fmt.Errorf("failed to activate version: %w", err)
+	}
+	if !stored {
+		return ErrVersionGone
+	}
+	return ErrVersionReplaced
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, ref string) error {
+	domain, _, _, err := parsePostgresRef(ref)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(ctx, `DELETE FROM certificate_files WHERE domain_name = $1`, domain)
+	return err
+}
+
+func (s *PostgresStore) List(ctx context.Context) ([]string, error) {
+	rows, err := s.db.Query(ctx, `SELECT domain_name, version, name FROM certificate_files ORDER BY domain_name, version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refs []string
+	for rows.Next() {
+		var (
+			domain, name string
+			version      int
+		)
+		if err := rows.Scan(&domain, &version, &name); err != nil {
+			return nil, err
+		}
+		refs = append(refs, postgresRef(domain, version, name))
+	}
+	return refs, rows.Err()
+}
+
+func (s *PostgresStore) Update(ctx context.Context, ref string, data []byte) error {
+	domain, version, name, err := parsePostgresRef(ref)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := utils.EncryptWithSecret(s.secret, data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", name, err)
+	}
+	tag, err := s.db.Exec(ctx,
+		`UPDATE certificate_files SET encrypted_data = $4 WHERE domain_name = $1 AND version = $2 AND name = $3`,
+		domain, version, name, encrypted,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStore) insert(ctx context.Context, tx pgx.Tx, domain string, version int, files map[string][]byte) (map[string]string, error) {
+	refs := make(map[string]string, len(files))
+	for name, data := range files {
+		encrypted, err := utils.EncryptWithSecret(s.secret, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt %s: %w", name, err)
+		}
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO certificate_files (domain_name, version, name, encrypted_data) VALUES ($1, $2, $3, $4)`,
+			domain, version, name, encrypted,
+		); err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				err = ErrVersionTaken
+			}
+			return nil, fmt.Errorf("failed to store %s: %w", name, err)
+		}
+		refs[name] = postgresRef(domain, version, name)
+	}
+	return refs, nil
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TestPostgresStore runs against SSL_MANAGER_TEST_DATABASE_URL, in a schema
+// of its own that is dropped afterwards.
+func TestPostgresStore(t *testing.T) {
+	url := os.Getenv("SSL_MANAGER_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("SSL_MANAGER_TEST_DATABASE_URL is not set")
+	}
+	migration, err := os.ReadFile("../../migrations/000011_certificate_files.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "storage_test_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+	db, err := pgxpool.NewWithConfig(t.Context(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	if _, err := db.Exec(t.Context(), "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// t.Context is done by now
+		if _, err := db.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("failed to drop %s: %v", schema, err)
+		}
+	})
+	if _, err := db.Exec(t.Context(), string(migration)); err != nil {
+		t.Fatalf("migration: %v", err)
+	}
+
+	testCertStore(t, NewPostgresStore(db, "storage test secret", 2), "example.com")
+}
+
+func TestParsePostgresRef(t *testing.T) {
+	tests := []struct {
+		ref     string
+		domain  string
+		version int
+		name    string
+		wantErr bool
+	}{
+		{ref: "postgres:example.com/3/cert.pem", domain: "example.com", version: 3, name: "cert.pem"},
+		{ref: "postgres:*.example.com/12/cert-legacy.p12", domain: "*.example.com", version: 12, name: "cert-legacy.p12"},
+		{ref: "postgres:example.com/3", wantErr: true},
+		{ref: "postgres:example.com/three/cert.pem", wantErr: true},
+		{ref: "postgres:", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			domain, version, name, err := parsePostgresRef(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if domain != tt.domain || version != tt.version || name != tt.name {
+				t.Errorf("got %q, %d, %q, want %q, %d, %q", domain, version, name, tt.domain, tt.version, tt.name)
+			}
+			if !tt.wantErr && postgresRef(domain, version, name) != tt.ref {
+				t.Errorf("postgresRef gives %q", postgresRef(domain, version, name))
+			}
+		})
+	}
+
+	for _, ref := range []string{"/certs/archive/example.com/v3/cert.pem", "s3://bucket/archive/example.com/cert3.pem"} {
+		if _, _, _, err := parsePostgresRef(ref); !errors.Is(err, ErrForeignRef) {
+			t.Errorf("parsePostgresRef(%q): got %v, want %v", ref, err, ErrForeignRef)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	utils "ssl-manager/internal/utils"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Store keeps certificates in an S3 compatible bucket: versions under
+// archive/<domain>/certN.pem, ... and copies of the current one under
+// live/<domain>/. References look like s3://<bucket>/<key>.
+//
+// Objects cannot be renamed, so live/ is not a consistent snapshot: while a
+// version is activated it holds files of the old and the new one. Anything
+// needing matching files reads the archive objects through their
+// references, as the deployers do.
+type S3Store struct {
+	client    *minio.Client
+	bucket    string
+	prefix    string
+	retention int
+	log       *utils.Logger
+}
+
+func NewS3Store(cfg utils.S3Config, retention int, log *utils.Logger) (*S3Store, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("s3 storage needs an endpoint and a bucket")
+	}
+
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: !cfg.Insecure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	return &S3Store{
+		client:    client,
+		bucket:    cfg.Bucket,
+		prefix:    strings.Trim(cfg.Prefix, "/"),
+		retention: retention,
+		log:       log,
+	}, nil
+}
+
+func (s *S3Store) key(parts ...string) string {
+	return path.Join(append([]string{s.prefix}, parts...)...)
+}
+
+func (s *S3Store) ref(key string) string {
+	return "s3://" + s.bucket + "/" + key
+}
+
+// archived returns the domain, version and object key of ref.
+func (s *S3Store) archived(ref string) (domain string, version int, key string, err error) {
+	key, ok := strings.CutPrefix(ref, "s3://"+s.bucket+"/")
+	if !ok {
+		return "", 0, "", ErrForeignRef
+	}
+	dir, file := path.Split(key)
+	if path.Dir(path.Clean(dir)) != s.key("archive") {
+		return "", 0, "", fmt.Errorf("malformed reference %q", ref)
+	}
+	if _, version, ok = unversioned(file); !ok {
+		return "", 0, "", fmt.Errorf("malformed reference %q", ref)
+	}
+	return path.Base(dir), version, key, nil
+}
+
+func (s *S3Store) list(ctx context.Context, dir string) ([]string, error) {
+	var names []string
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: dir + "/"}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		names = append(names, path.Base(object.Key))
+	}
+	return names, nil
+}
+
+func (s *S3Store) get(ctx context.Context, key string) ([]byte, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *S3Store) put(ctx context.Context, key string, data []byte) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	return err
+}
+
+// putNew uploads key unless it exists, with If-None-Match: *. It returns
+// ErrVersionTaken when it does.
+func (s *S3Store) putNew(ctx context.Context, key string, data []byte) error {
+	opts := minio.PutObjectOptions{ContentType: "application/octet-stream"}
+	opts.SetMatchETagExcept("*")
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)), opts)
+	if minio.ToErrorResponse(err).Code == minio.PreconditionFailed {
+		return ErrVersionTaken
+	}
+	return err
+}
+
+func (s *S3Store) Save(ctx context.Context, domain string, files map[string][]byte) (map[string]string, error) {
+	archived, err := s.list(ctx, s.key("archive", domain))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archive: %w", err)
+	}
+	version := latestVersion(archived) + 1
+
+	// archived objects are only created, never overwritten, so of two
+	// instances saving the same version at least one fails and backs out
+	refs := make(map[string]string, len(files))
+	for name, data := range files {
+		key := s.key("archive", domain, versioned(name, version))
+		if err := s.putNew(ctx, key, data); err != nil {
+			for _, ref := range refs {
+				_, _, uploaded, _ := s.archived(ref)
+				_ = s.client.RemoveObject(ctx, s.bucket, uploaded, minio.RemoveObjectOptions{})
+			}
+			return nil, fmt.Errorf("failed to upload %s: %w", name, err)
+		}
+		refs[name] = s.ref(key)
+	}
+
+	if err := s.activate(ctx, domain, version); err != nil {
+		return nil, err
+	}
+	if err := s.prune(ctx, domain, version); err != nil {
+		s.log.Warn("Pruning certificate archive of ", domain, ": ", err)
+	}
+	return refs, nil
+}
+
+func (s *S3Store) Attach(ctx context.Context, ref string, files map[string][]byte) error {
+	domain, version, _, err := s.archived(ref)
+	if err != nil {
+		return err
+	}
+
+	for name, data := range files {
+		if err := s.put(ctx, s.key("archive", domain, versioned(name, version)), data); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", name, err)
+		}
+		if err := s.put(ctx, s.key("live", domain, name), data); err != nil {
+			return fmt.Errorf("failed to upload live %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (s *S3Store) Read(ctx context.Context, ref string) ([]byte, error) {
+	_, _, key, err := s.archived(ref)
+	if err != nil {
+		return nil, err
+	}
+	return s.get(ctx, key)
+}
+
+// Activate compares the live copy of the replaced file with its archived
+// one to tell the current version. S3 offers no compare-and-swap, another
+// instance activating a version between the check and the copy still wins
+// or loses at random.
+func (s *S3Store) Activate(ctx context.Context, ref, replaced string) error {
+	domain, version, _, err := s.archived(ref)
+	if err != nil {
+		return err
+	}
+	if replaced != "" {
+		replacedDomain, _, key, err := s.archived(replaced)
+		if err != nil {
+			return err
+		}
+		if replacedDomain != domain {
+			return ErrForeignRef
+		}
+		current, err := s.isLive(ctx, domain, key)
+		if err != nil {
+			return err
+		}
+		if !current {
+			return ErrVersionReplaced
+		}
+	}
+	return s.activate(ctx, domain, version)
+}
+
+func (s *S3Store) Delete(ctx context.Context, ref string) error {
+	domain, _, _, err := s.archived(ref)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range []string{s.key("live", domain), s.key("archive", domain)} {
+		names, err := s.list(ctx, dir)
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", dir, err)
+		}
+		for _, name := range names {
+			if err := s.client.RemoveObject(ctx, s.bucket, dir+"/"+name, minio.RemoveObjectOptions{}); err != nil {
+				return fmt.Errorf("failed to delete %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *S3Store) List(ctx context.Context) ([]string, error) {
+	var refs []string
+	opts := minio.ListObjectsOptions{Prefix: s.key("archive") + "/", Recursive: true}
+	for object := range s.client.ListObjects(ctx, s.bucket, opts) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		refs = append(refs, s.ref(object.Key))
+	}
+	return refs, nil
+}
+
+func (s *S3Store) Update(ctx context.Context, ref string, data []byte) error {
+	domain, _, key, err := s.archived(ref)
+	if err != nil {
+		return err
+	}
+	old, err := s.get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := s.put(ctx, key, data); err != nil {
+		return err
+	}
+
+	// the live copy of the current version has to follow
+	liveKey := s.key("live", domain, FileName(key))
+	live, err := s.get(ctx, liveKey)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err == nil && bytes.Equal(live, old) {
+		return s.put(ctx, liveKey, data)
+	}
+	return nil
+}
+
+// activate copies every file of version over live/<domain>/ and removes the
+// live files the version has none for. Each copy replaces its object
+// atomically, the live files as a whole do not change at once.
+func (s *S3Store) activate(ctx context.Context, domain string, version int) error {
+	archived, err := s.list(ctx, s.key("archive", domain))
+	if err != nil {
+		return fmt.Errorf("failed to list archive: %w", err)
+	}
+
+	copied := map[string]bool{}
+	for _, file := range archived {
+		name, v, ok := unversioned(file)
+		if !ok || v != version {
+			continue
+		}
+		_, err := s.client.CopyObject(ctx,
+			minio.CopyDestOptions{Bucket: s.bucket, Object: s.key("live", domain, name)},
+			minio.CopySrcOptions{Bucket: s.bucket, Object: s.key("archive", domain, file)},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to activate %s: %w", name, err)
+		}
+		copied[name] = true
+	}
+	if len(copied) == 0 {
+		return ErrVersionGone
+	}
+
+	live, err := s.list(ctx, s.key("live", domain))
+	if err != nil {
+		return fmt.Errorf("failed to list live files: %w", err)
+	}
+	for _, name := range live {
+		if !copied[name] {
+			if err := s.client.RemoveObject(ctx, s.bucket, s.key("live", domain, name), minio.RemoveObjectOptions{}); err != nil {
+				return fmt.Errorf("failed to delete live %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// isLive tells whether the archived file key is the one served from live/.
+func (s *S3Store) isLive(ctx context.Context, domain, key string) (bool, error) {
+	name, _, ok := unversioned(path.Base(key))
+	if !ok {
+		return false, ErrForeignRef
+	}
+	archived, err := s.get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	live, err := s.get(ctx, s.key("live", domain, name))
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(archived, live), nil
+}
+
+// prune removes the versions older than the newest retention ones.
+func (s *S3Store) prune(ctx context.Context, domain string, current int) error {
+	archived, err := s.list(ctx, s.key("archive", domain))
+	if err != nil {
+		return err
+	}
+	for _, file := range archived {
+		if _, v, ok := unversioned(file); ok && pruned(v, current, s.retention) {
+			if err := s.client.RemoveObject(ctx, s.bucket, s.key("archive", domain, file), minio.RemoveObjectOptions{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	utils "ssl-manager/internal/utils"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestS3Store runs against the bucket of SSL_MANAGER_TEST_S3_ENDPOINT, e.g.
+// localhost:9000 after make minio-up.
+func TestS3Store(t *testing.T) {
+	endpoint := os.Getenv("SSL_MANAGER_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("SSL_MANAGER_TEST_S3_ENDPOINT is not set")
+	}
+	cfg := utils.S3Config{
+		Endpoint:  endpoint,
+		Bucket:    envOr("SSL_MANAGER_TEST_S3_BUCKET", "ssl-manager"),
+		Prefix:    "test-" + strconv.FormatInt(time.Now().UnixNano(), 36),
+		AccessKey: envOr("SSL_MANAGER_TEST_S3_ACCESS_KEY", "minioadmin"),
+		SecretKey: envOr("SSL_MANAGER_TEST_S3_SECRET_KEY", "minioadmin"),
+		Insecure:  os.Getenv("SSL_MANAGER_TEST_S3_SECURE") == "",
+	}
+	s, err := NewS3Store(cfg, 2, utils.NewLogger("error"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCertStore(t, s, "example.com")
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func TestS3StoreArchived(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		ref     string
+		domain  string
+		version int
+		key     string
+		wantErr error
+	}{
+		{
+			name:    "no prefix",
+			ref:     "s3://certs/archive/example.com/cert3.pem",
+			domain:  "example.com",
+			version: 3,
+			key:     "archive/example.com/cert3.pem",
+		},
+		{
+			name:    "prefix",
+			prefix:  "prod/ssl",
+			ref:     "s3://certs/prod/ssl/archive/example.com/cert-legacy2.p12",
+			domain:  "example.com",
+			version: 2,
+			key:     "prod/ssl/archive/example.com/cert-legacy2.p12",
+		},
+		{name: "other bucket", ref: "s3://other/archive/example.com/cert3.pem", wantErr: ErrForeignRef},
+		{name: "local ref", ref: "/certs/archive/example.com/cert3.pem", wantErr: ErrForeignRef},
+		{name: "live copy", ref: "s3://certs/live/example.com/cert.pem", wantErr: errMalformed},
+		{name: "unversioned", ref: "s3://certs/archive/example.com/cert.pem", wantErr: errMalformed},
+		{name: "outside prefix", prefix: "prod", ref: "s3://certs/archive/example.com/cert3.pem", wantErr: errMalformed},
+		{name: "nested", ref: "s3://certs/archive/example.com/old/cert3.pem", wantErr: errMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &S3Store{bucket: "certs", prefix: tt.prefix}
+			domain, version, key, err := s.archived(tt.ref)
+			switch {
+			case tt.wantErr == errMalformed:
+				if err == nil || errors.Is(err, ErrForeignRef) {
+					t.Fatalf("got %v, want a malformed reference error", err)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("archived: %v", err)
+			}
+			if domain != tt.domain || version != tt.version || key != tt.key {
+				t.Errorf("got %q, %d, %q, want %q, %d, %q", domain, version, key, tt.domain, tt.version, tt.key)
+			}
+			if tt.wantErr == nil && s.ref(key) != tt.ref {
+				t.Errorf("ref gives %q", s.ref(key))
+			}
+		})
+	}
+}
+
+// errMalformed stands for the unwrapped malformed reference errors.
+var errMalformed = errors.New("malformed reference")
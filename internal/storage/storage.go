@@ -0,0 +1,115 @@
+// Package storage keeps the certificate files of domains. Every issuance is
+// stored as a new version next to the older ones, and one version per domain
+// is the current (live) one. The certificates rows hold the references Save
+// returns, so a file can always be read back from the store that wrote it.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	utils "ssl-manager/internal/utils"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNotFound    = errors.New("certificate file not found")
+	ErrForeignRef  = errors.New("reference belongs to another certificate store")
+	ErrVersionGone = errors.New("certificate version is no longer stored")
+	// ErrVersionTaken is returned by Save when another save of the domain
+	// took the version meanwhile. Nothing of the failed save is kept.
+	ErrVersionTaken = errors.New("certificate version was saved concurrently")
+	// ErrVersionReplaced is returned by Activate when the version it was to
+	// replace is no longer the current one.
+	ErrVersionReplaced = errors.New("another certificate version became current")
+)
+
+type CertStore interface {
+	// Save stores files, keyed by name (cert.pem, key.pem, ...), as a new
+	// version of domain and makes it the current one. It returns the
+	// reference of every file.
+	Save(ctx context.Context, domain string, files map[string][]byte) (map[string]string, error)
+	// Attach adds files to the version ref belongs to, e.g. exports rendered
+	// after the certificate was saved.
+	Attach(ctx context.Context, ref string, files map[string][]byte) error
+	Read(ctx context.Context, ref string) ([]byte, error)
+	// Activate makes the version ref belongs to the current one again. With
+	// replaced set it only does so while the version replaced belongs to is
+	// still the current one, and returns ErrVersionReplaced otherwise.
+	Activate(ctx context.Context, ref, replaced string) error
+	// Delete removes every version of the domain ref belongs to.
+	Delete(ctx context.Context, ref string) error
+	// List returns the reference of every stored file, all versions.
+	List(ctx context.Context) ([]string, error)
+	// Update replaces the contents of a stored file, e.g. to re-wrap an
+	// encrypted key. The reference stays the same.
+	Update(ctx context.Context, ref string, data []byte) error
+}
+
+// New creates the store selected by certs.storage.backend. db is only used
+// by the postgres backend.
+func New(cfg *utils.Config, db *pgxpool.Pool, log *utils.Logger) (CertStore, error) {
+	switch cfg.Certs.Storage.Backend {
+	case "", "local":
+		return NewLocalStore(cfg.Certs.StorageDir, cfg.Certs.ArchiveRetention, log), nil
+	case "postgres":
+		return NewPostgresStore(db, cfg.Certs.AccountKeySecret, cfg.Certs.ArchiveRetention), nil
+	case "s3":
+		return NewS3Store(cfg.Certs.Storage.S3, cfg.Certs.ArchiveRetention, log)
+	}
+	return nil, fmt.Errorf("unknown certificate storage backend %q", cfg.Certs.Storage.Backend)
+}
+
+// FileName returns the name a reference was saved under, e.g. key.pem.
+func FileName(ref string) string {
+	base := path.Base(filepath.ToSlash(ref))
+	if name, _, ok := unversioned(base); ok {
+		return name
+	}
+	return base
+}
+
+// versionedFile splits e.g. "cert-legacy12.p12" into "cert-legacy", 12, ".p12".
+var versionedFile = regexp.MustCompile(`^(.+?)(\d+)(\.[a-z0-9]+)$`)
+
+// versioned turns "cert.pem" into "cert3.pem".
+func versioned(name string, version int) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + strconv.Itoa(version) + ext
+}
+
+// unversioned turns "cert3.pem" into "cert.pem" and 3.
+func unversioned(file string) (string, int, bool) {
+	m := versionedFile.FindStringSubmatch(file)
+	if m == nil {
+		return "", 0, false
+	}
+	version, err := strconv.Atoi(m[2])
+	if err != nil {
+		return "", 0, false
+	}
+	return m[1] + m[3], version, true
+}
+
+// latestVersion is the newest version among the archived file names.
+func latestVersion(files []string) int {
+	latest := 0
+	for _, file := range files {
+		if _, v, ok := unversioned(file); ok && v > latest {
+			latest = v
+		}
+	}
+	return latest
+}
+
+// pruned tells whether version falls out of the newest retention versions
+// once current is saved.
+func pruned(version, current, retention int) bool {
+	return version <= current-retention
+}
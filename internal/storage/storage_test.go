@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestVersioned(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		want    string
+	}{
+		{"cert.pem", 1, "cert1.pem"},
+		{"key.pem", 12, "key12.pem"},
+		{"cert-legacy.p12", 3, "cert-legacy3.p12"},
+		{"cert.der", 7, "cert7.der"},
+	}
+	for _, tt := range tests {
+		if got := versioned(tt.name, tt.version); got != tt.want {
+			t.Errorf("versioned(%q, %d) = %q, want %q", tt.name, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestUnversioned(t *testing.T) {
+	tests := []struct {
+		file    string
+		name    string
+		version int
+		ok      bool
+	}{
+		{"cert1.pem", "cert.pem", 1, true},
+		{"fullchain12.pem", "fullchain.pem", 12, true},
+		{"cert-legacy3.p12", "cert-legacy.p12", 3, true},
+		{"cert.pem", "", 0, false},
+		{"cert.p12", "", 0, false},
+		{"v3", "", 0, false},
+		{"README", "", 0, false},
+	}
+	for _, tt := range tests {
+		name, version, ok := unversioned(tt.file)
+		if name != tt.name || version != tt.version || ok != tt.ok {
+			t.Errorf("unversioned(%q) = %q, %d, %v, want %q, %d, %v", tt.file, name, version, ok, tt.name, tt.version, tt.ok)
+		}
+	}
+
+	// every name survives a round trip, including the p12 exports ending in
+	// a digit themselves
+	for _, name := range []string{"cert.pem", "key.pem", "combined.pem", "cert.p12", "cert-legacy.p12"} {
+		if got, v, ok := unversioned(versioned(name, 5)); got != name || v != 5 || !ok {
+			t.Errorf("round trip of %q gave %q, %d, %v", name, got, v, ok)
+		}
+	}
+}
+
+func TestFileName(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"/certs/archive/example.com/cert3.pem", "cert.pem"},
+		{"/certs/archive/example.com/v3/cert.pem", "cert.pem"},
+		{"s3://bucket/archive/example.com/key2.pem", "key.pem"},
+		{"postgres:example.com/2/cert.p12", "cert.p12"},
+		{"/certs/example.com/cert.pem", "cert.pem"},
+	}
+	for _, tt := range tests {
+		if got := FileName(tt.ref); got != tt.want {
+			t.Errorf("FileName(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestLatestVersion(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  int
+	}{
+		{"empty", nil, 0},
+		{"one version", []string{"cert1.pem", "key1.pem"}, 1},
+		{"numeric order", []string{"cert9.pem", "cert10.pem", "cert2.pem"}, 10},
+		{"unversioned files ignored", []string{"cert.pem", "notes", "key4.pem"}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := latestVersion(tt.files); got != tt.want {
+				t.Errorf("latestVersion(%v) = %d, want %d", tt.files, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruned(t *testing.T) {
+	tests := []struct {
+		version, current, retention int
+		want                        bool
+	}{
+		{5, 5, 2, false},
+		{4, 5, 2, false},
+		{3, 5, 2, true},
+		{1, 5, 5, false},
+		{1, 6, 5, true},
+		{1, 1, 2, false},
+	}
+	for _, tt := range tests {
+		if got := pruned(tt.version, tt.current, tt.retention); got != tt.want {
+			t.Errorf("pruned(%d, %d, %d) = %v, want %v", tt.version, tt.current, tt.retention, got, tt.want)
+		}
+	}
+}
+
+// testCertStore runs the CertStore contract against s, which keeps two
+// versions. The store tests call it with their backend; the s3 and postgres
+// ones only when pointed at a server.
+func testCertStore(t *testing.T, s CertStore, domain string) {
+	ctx := t.Context()
+	read := func(ref, want string) {
+		t.Helper()
+		data, err := s.Read(ctx, ref)
+		if err != nil {
+			t.Fatalf("Read %s: %v", ref, err)
+		}
+		if string(data) != want {
+			t.Fatalf("Read %s = %q, want %q", ref, data, want)
+		}
+	}
+
+	var saved []map[string]string
+	for v := 1; v <= 3; v++ {
+		refs, err := s.Save(ctx, domain, map[string][]byte{
+			"cert.pem": []byte("cert " + strconv.Itoa(v)),
+			"key.pem":  []byte("key " + strconv.Itoa(v)),
+		})
+		if err != nil {
+			t.Fatalf("Save %d: %v", v, err)
+		}
+		read(refs["cert.pem"], "cert "+strconv.Itoa(v))
+		read(refs["key.pem"], "key "+strconv.Itoa(v))
+		saved = append(saved, refs)
+	}
+	if err := s.Attach(ctx, saved[2]["cert.pem"], map[string][]byte{"cert.p12": []byte("p12 3")}); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+
+	// version 1 fell out of the retention
+	if _, err := s.Read(ctx, saved[0]["cert.pem"]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read of a pruned version: %v", err)
+	}
+	if err := s.Activate(ctx, saved[0]["cert.pem"], ""); !errors.Is(err, ErrVersionGone) {
+		t.Errorf("Activate of a pruned version: %v", err)
+	}
+
+	// rolling back to version 2 only while version 3 is current
+	if err := s.Activate(ctx, saved[1]["cert.pem"], saved[2]["cert.pem"]); err != nil {
+		t.Fatalf("Activate 2 replacing 3: %v", err)
+	}
+	if err := s.Activate(ctx, saved[1]["cert.pem"], saved[2]["cert.pem"]); !errors.Is(err, ErrVersionReplaced) {
+		t.Errorf("Activate replacing a version no longer current: %v", err)
+	}
+	if err := s.Activate(ctx, saved[2]["cert.pem"], ""); err != nil {
+		t.Fatalf("Activate 3: %v", err)
+	}
+
+	// concurrent saves never share a version; the ones that lose keep nothing
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		won  []map[string]string
+		errs []error
+	)
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			refs, err := s.Save(ctx, domain, map[string][]byte{"cert.pem": []byte("racer " + strconv.Itoa(i))})
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			won = append(won, refs)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if !errors.Is(err, ErrVersionTaken) {
+			t.Errorf("concurrent Save: %v", err)
+		}
+	}
+	if len(won) == 0 {
+		t.Fatal("every concurrent Save failed")
+	}
+	// the winners may have pruned each other, the last one is stored
+	seen := map[string]bool{}
+	stored := false
+	for _, refs := range won {
+		if seen[refs["cert.pem"]] {
+			t.Errorf("two saves returned %s", refs["cert.pem"])
+		}
+		seen[refs["cert.pem"]] = true
+		if _, err := s.Read(ctx, refs["cert.pem"]); err == nil {
+			stored = true
+		}
+	}
+	if !stored {
+		t.Error("no concurrent Save is stored")
+	}
+
+	if err := s.Delete(ctx, saved[2]["cert.pem"]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Read(ctx, saved[2]["key.pem"]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read after Delete: %v", err)
+	}
+	refs, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if i := slices.IndexFunc(refs, func(ref string) bool { return strings.Contains(ref, "/"+domain+"/") }); i >= 0 {
+		t.Errorf("List still has %s", refs[i])
+	}
+}
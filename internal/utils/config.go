@@ -2,7 +2,10 @@ package utils
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	models "ssl-manager/internal/models"
+	"strings"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
@@ -28,10 +31,78 @@ type Config struct {
 		RefreshSecKey string `yaml:"refresh_sec_key"`
 	} `yaml:"auth"`
 	Certs struct {
-		StorageDir      string        `yaml:"storage_dir"`
-		Email           string        `yaml:"email"`
-		RenewalDuration time.Duration `yaml:"renuwal_duration"` // in hours
+		StorageDir             string        `yaml:"storage_dir"`
+		ArchiveRetention       int           `yaml:"archive_retention" env-default:"5"` // certificate versions kept per domain
+		Email                  string        `yaml:"email"`
+		RenewalDuration        time.Duration `yaml:"renuwal_duration"`                          // in hours
+		RenewalLifetimePercent int           `yaml:"renewal_lifetime_percent" env-default:"66"` // renew after this share of the lifetime when the CA has no ARI
+		DirectoryURL           string        `yaml:"directory_url" env-default:"https://acme-v02.api.letsencrypt.org/directory"`
+		OrderTimeout           time.Duration `yaml:"order_timeout" env-default:"5m"`
+		DeployTimeout          time.Duration `yaml:"deploy_timeout" env-default:"2m"` // per deployer
+		TLSVerify              struct {
+			Attempts int           `yaml:"attempts" env-default:"5"` // the server may still be reloading
+			Interval time.Duration `yaml:"interval" env-default:"3s"`
+		} `yaml:"tls_verify"`
+		AccountKeySecret string     `yaml:"account_key_secret"` // encrypts acme account keys in the database
+		CAs              []CAConfig `yaml:"cas"`                // when empty, directory_url is used as the only CA
+		DefaultCA        string     `yaml:"default_ca"`
+		HTTP01           struct {
+			Mode       string `yaml:"mode"`        // responder | webroot
+			Webroot    string `yaml:"webroot"`     // directory served as / by the web server
+			ListenAddr string `yaml:"listen_addr"` // separate listener for the responder, e.g. ":80"
+		} `yaml:"http01"`
+		DNS struct {
+			Provider           string        `yaml:"provider"`  // rfc2136 | exec
+			Resolvers          []string      `yaml:"resolvers"` // host:port used for propagation checks
+			PropagationTimeout time.Duration `yaml:"propagation_timeout" env-default:"2m"`
+			PollingInterval    time.Duration `yaml:"polling_interval" env-default:"5s"`
+			RFC2136            struct {
+				Nameserver    string `yaml:"nameserver"`
+				Zone          string `yaml:"zone"`
+				TSIGKey       string `yaml:"tsig_key"`
+				TSIGSecret    string `yaml:"tsig_secret"`
+				TSIGAlgorithm string `yaml:"tsig_algorithm" env-default:"hmac-sha256."`
+				TTL           int    `yaml:"ttl" env-default:"60"`
+			} `yaml:"rfc2136"`
+			Exec struct {
+				Path string `yaml:"path"`
+			} `yaml:"exec"`
+		} `yaml:"dns"`
+		Storage struct {
+			Backend string   `yaml:"backend" env-default:"local"` // local | postgres | s3
+			S3      S3Config `yaml:"s3"`
+		} `yaml:"storage"`
+		Encryption struct {
+			KMS       string `yaml:"kms"`        // local, the default when kek or kek_file is set
+			KEK       string `yaml:"kek"`        // base64 AES-256 key-encryption key
+			KEKFile   string `yaml:"kek_file"`   // one base64 kek per line, the first one encrypts
+			DeployDir string `yaml:"deploy_dir"` // decrypted copies of the live certificates for the web server
+		} `yaml:"encryption"`
 	} `yaml:"certs"`
+	// deploy targets by name, domains created through the api pick theirs
+	// from these
+	Deployers map[string]models.DeployerConfig `yaml:"deployers"`
+	Docker    struct {
+		Socket string `yaml:"socket" env-default:"/var/run/docker.sock"` // engine api, used by docker deployers and discovery
+	} `yaml:"docker"`
+	Kubernetes struct {
+		Enabled    bool   `yaml:"enabled"`
+		Kubeconfig string `yaml:"kubeconfig"` // the pod's service account when empty
+	} `yaml:"kubernetes"`
+	Envoy struct {
+		SDS SDSConfig `yaml:"sds"`
+	} `yaml:"envoy"`
+	Discovery struct {
+		Docker struct {
+			Enabled          bool `yaml:"enabled"`            // register domains from ssl-manager.* container labels
+			DisableAutoRenew bool `yaml:"disable_auto_renew"` // when the container of a discovered domain is removed
+		} `yaml:"docker"`
+		Kubernetes struct {
+			Enabled          bool   `yaml:"enabled"`            // register the tls hosts of ingresses annotated ssl-manager/enabled
+			Namespace        string `yaml:"namespace"`          // all namespaces when empty
+			DisableAutoRenew bool   `yaml:"disable_auto_renew"` // when the ingress of a discovered domain is deleted
+		} `yaml:"kubernetes"`
+	} `yaml:"discovery"`
 	Server struct {
 		Port string `yaml:"port"`
 	} `yaml:"server"`
@@ -40,6 +111,41 @@ type Config struct {
 	} `yaml:"logger"`
 }
 
+// S3Config points the s3 certificate storage at a bucket, e.g. on MinIO.
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"` // host:port without scheme
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"`
+	Region    string `yaml:"region"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	Insecure  bool   `yaml:"insecure"` // plain http, for a local MinIO
+}
+
+// SDSConfig sets up the secret discovery service envoy deployers publish
+// to. It is off when Listen is empty.
+type SDSConfig struct {
+	Listen          string        `yaml:"listen"`    // unix:///run/ssl-manager/sds.sock, or host:port with mutual tls
+	CertFile        string        `yaml:"cert_file"` // server certificate for host:port
+	KeyFile         string        `yaml:"key_file"`
+	ClientCAFile    string        `yaml:"client_ca_file"`                    // CA of the client certificates envoy presents
+	RefreshInterval time.Duration `yaml:"refresh_interval" env-default:"1m"` // how often the secrets are reloaded from the database
+}
+
+// CAConfig describes one ACME certificate authority.
+type CAConfig struct {
+	Name         string   `yaml:"name"`
+	DirectoryURL string   `yaml:"directory_url"`
+	EABKeyID     string   `yaml:"eab_key_id"`
+	EABHMACKey   string   `yaml:"eab_hmac_key"`  // base64url, as handed out by the CA
+	TrustedRoots []string `yaml:"trusted_roots"` // PEM files trusted in addition to the system pool
+	KeyTypes     []string `yaml:"key_types"`     // certificate key types the CA accepts, defaults to RSA and ECDSA
+
+	// issued chains are verified against the trusted roots unless this is set,
+	// e.g. for a staging CA whose root is not at hand
+	SkipChainVerification bool `yaml:"skip_chain_verification"`
+}
+
 func LoadConfig(confPath string) (*Config, error) {
 	if confPath == "" {
 		return nil, errors.New("config path is empty")
@@ -55,5 +161,65 @@ func LoadConfig(confPath string) (*Config, error) {
 		return nil, err
 	}
 
+	if err := normalizeCAs(&cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.Certs.RenewalLifetimePercent <= 0 || cfg.Certs.RenewalLifetimePercent >= 100 {
+		return nil, errors.New("certs.renewal_lifetime_percent must be between 1 and 99")
+	}
+	enc := cfg.Certs.Encryption
+	if (enc.KMS != "" || enc.KEK != "" || enc.KEKFile != "") && enc.DeployDir == "" {
+		return nil, errors.New("certs.encryption.deploy_dir is required, the web server cannot read encrypted keys")
+	}
+	if cfg.Discovery.Kubernetes.Enabled && !cfg.Kubernetes.Enabled {
+		return nil, errors.New("discovery.kubernetes needs kubernetes.enabled")
+	}
+	if sds := cfg.Envoy.SDS; sds.Listen != "" && !strings.HasPrefix(sds.Listen, "unix://") &&
+		(sds.CertFile == "" || sds.KeyFile == "" || sds.ClientCAFile == "") {
+		return nil, errors.New("envoy.sds needs cert_file, key_file and client_ca_file unless it listens on a unix socket")
+	}
+	// the previous version has to outlive a save until the renewal is
+	// committed and deployed, or there is nothing to roll back to
+	if cfg.Certs.ArchiveRetention < 2 {
+		return nil, errors.New("certs.archive_retention must keep at least two versions")
+	}
+
 	return &cfg, nil
 }
+
+// normalizeCAs keeps single-CA configs working and checks that every CA is
+// named once and the default one exists.
+func normalizeCAs(cfg *Config) error {
+	if len(cfg.Certs.CAs) == 0 {
+		cfg.Certs.CAs = []CAConfig{{Name: "letsencrypt", DirectoryURL: cfg.Certs.DirectoryURL}}
+	}
+
+	names := make(map[string]bool)
+	for _, ca := range cfg.Certs.CAs {
+		if ca.Name == "" || ca.DirectoryURL == "" {
+			return errors.New("every ca needs a name and a directory_url")
+		}
+		if names[ca.Name] {
+			return fmt.Errorf("duplicate ca name %q", ca.Name)
+		}
+		if (ca.EABKeyID == "") != (ca.EABHMACKey == "") {
+			return fmt.Errorf("ca %q: eab_key_id and eab_hmac_key must be set together", ca.Name)
+		}
+		for _, keyType := range ca.KeyTypes {
+			if !IsValidKeyType(keyType) {
+				return fmt.Errorf("ca %q: unknown key type %q", ca.Name, keyType)
+			}
+		}
+		names[ca.Name] = true
+	}
+
+	if cfg.Certs.DefaultCA == "" {
+		cfg.Certs.DefaultCA = cfg.Certs.CAs[0].Name
+	}
+	if !names[cfg.Certs.DefaultCA] {
+		return fmt.Errorf("default_ca %q is not configured", cfg.Certs.DefaultCA)
+	}
+
+	return nil
+}
@@ -2,13 +2,74 @@ package utils
 
 import (
 	"regexp"
+	"strings"
 )
 
 var domainRegexp = regexp.MustCompile(`^[a-zA-Z0-9-]{1,63}(?:\.[a-zA-Z0-9-]{1,63})*$`)
 
+// IsValidDomain accepts plain hostnames and wildcards whose "*" is the whole
+// leftmost label, e.g. *.example.com.
 func IsValidDomain(domain string) bool {
 	if len(domain) == 0 || len(domain) > 253 {
 		return false
 	}
+	if base, ok := strings.CutPrefix(domain, "*."); ok {
+		return strings.Contains(base, ".") && domainRegexp.MatchString(base)
+	}
 	return domainRegexp.MatchString(domain)
 }
+
+func IsWildcardDomain(domain string) bool {
+	return strings.HasPrefix(domain, "*.")
+}
+
+// Certificate key types a domain can request.
+const (
+	KeyTypeRSA2048   = "rsa2048"
+	KeyTypeRSA3072   = "rsa3072"
+	KeyTypeRSA4096   = "rsa4096"
+	KeyTypeECDSAP256 = "ecdsa-p256"
+	KeyTypeECDSAP384 = "ecdsa-p384"
+	KeyTypeEd25519   = "ed25519"
+)
+
+func IsValidKeyType(keyType string) bool {
+	switch keyType {
+	case KeyTypeRSA2048, KeyTypeRSA3072, KeyTypeRSA4096, KeyTypeECDSAP256, KeyTypeECDSAP384, KeyTypeEd25519:
+		return true
+	}
+	return false
+}
+
+// Formats a certificate can be exported in.
+const (
+	ExportFormatPEM          = "pem"       // leaf certificate
+	ExportFormatFullchain    = "fullchain" // leaf and intermediates
+	ExportFormatCombined     = "combined"  // full chain and private key, for HAProxy
+	ExportFormatPKCS12       = "pkcs12"
+	ExportFormatPKCS12Legacy = "pkcs12-legacy" // 3DES, for Java 8 and older Windows
+	ExportFormatDER          = "der"
+)
+
+func IsValidExportFormat(format string) bool {
+	switch format {
+	case ExportFormatPEM, ExportFormatFullchain, ExportFormatCombined, ExportFormatPKCS12, ExportFormatPKCS12Legacy, ExportFormatDER:
+		return true
+	}
+	return false
+}
+
+// ExportFormatNeedsKey reports whether format includes the private key.
+func ExportFormatNeedsKey(format string) bool {
+	return format == ExportFormatCombined || format == ExportFormatPKCS12 || format == ExportFormatPKCS12Legacy
+}
+
+func IsValidVerificationMethod(method string) bool {
+	return method == "http-01" || method == "dns-01"
+}
+
+// IsValidRevocationReason accepts the RFC 5280 CRLReason codes. 7 is unused
+// by the RFC.
+func IsValidRevocationReason(reason int) bool {
+	return reason >= 0 && reason <= 10 && reason != 7
+}
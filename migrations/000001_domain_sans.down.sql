@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS trg_update_domain_sans_timestamp ON domain_sans;
+
+DROP INDEX IF EXISTS idx_domain_sans_domain_id;
+
+DROP TABLE IF EXISTS domain_sans CASCADE;
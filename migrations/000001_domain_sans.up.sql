@@ -0,0 +1,26 @@
+-- ============================================================
+-- DOMAIN SANS
+-- ============================================================
+CREATE TABLE IF NOT EXISTS domain_sans (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    domain_id UUID NOT NULL REFERENCES domains(id) ON DELETE CASCADE,
+    san VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    created_by TEXT NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_by TEXT,
+    deleted_at TIMESTAMPTZ,
+    deleted_by TEXT,
+    CHECK ((deleted_at IS NULL) = (deleted_by IS NULL)),
+    UNIQUE (domain_id, san)
+);
+
+COMMENT ON TABLE domain_sans IS
+    'Additional subject alternative names issued on the certificates of a domain.';
+COMMENT ON COLUMN domain_sans.san IS 'DNS name, e.g. www.example.com or *.example.com. Wildcards are validated with dns-01.';
+
+CREATE INDEX idx_domain_sans_domain_id ON domain_sans(domain_id);
+
+CREATE TRIGGER trg_update_domain_sans_timestamp
+BEFORE UPDATE ON domain_sans
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_acme_accounts_directory_url;
+
+ALTER TABLE acme_accounts
+    DROP COLUMN IF EXISTS directory_url,
+    DROP COLUMN IF EXISTS encrypted_key,
+    DROP COLUMN IF EXISTS status;
@@ -0,0 +1,13 @@
+ALTER TABLE acme_accounts
+    ADD COLUMN IF NOT EXISTS directory_url TEXT,
+    ADD COLUMN IF NOT EXISTS encrypted_key TEXT,
+    ADD COLUMN IF NOT EXISTS status VARCHAR(50) NOT NULL DEFAULT 'valid';  -- valid | deactivated
+
+COMMENT ON COLUMN acme_accounts.email IS 'Comma separated contact emails registered with the CA.';
+COMMENT ON COLUMN acme_accounts.directory_url IS 'ACME directory the account is registered with.';
+COMMENT ON COLUMN acme_accounts.encrypted_key IS 'Account private key (PEM), AES-GCM encrypted and base64 encoded.';
+COMMENT ON COLUMN acme_accounts.status IS 'Account state as reported by the CA (valid, deactivated).';
+COMMENT ON COLUMN acme_accounts.registration_json IS
+    'Serialized ACME account object as returned by the CA.';
+
+CREATE INDEX idx_acme_accounts_directory_url ON acme_accounts(directory_url);
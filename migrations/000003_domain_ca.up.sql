@@ -0,0 +1,5 @@
+ALTER TABLE domains
+    ADD COLUMN IF NOT EXISTS ca VARCHAR(100);
+
+COMMENT ON COLUMN domains.ca IS 'Name of the configured ACME CA tried first for this domain. NULL means the default CA.';
+COMMENT ON COLUMN certificates.issuer IS 'Name of the configured ACME CA that issued the certificate.';
@@ -0,0 +1,2 @@
+ALTER TABLE acme_accounts
+    DROP COLUMN IF EXISTS eab_key_id;
@@ -0,0 +1,5 @@
+ALTER TABLE acme_accounts
+    ADD COLUMN IF NOT EXISTS eab_key_id TEXT;
+
+COMMENT ON COLUMN acme_accounts.eab_key_id IS
+    'Key ID of the External Account Binding the account was registered with, if any.';
@@ -0,0 +1,4 @@
+ALTER TABLE certificates
+    DROP COLUMN IF EXISTS revoked_at,
+    DROP COLUMN IF EXISTS revoked_by,
+    DROP COLUMN IF EXISTS revocation_reason;
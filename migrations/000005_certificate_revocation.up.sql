@@ -0,0 +1,9 @@
+ALTER TABLE certificates
+    ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS revoked_by TEXT,
+    ADD COLUMN IF NOT EXISTS revocation_reason INTEGER;
+
+COMMENT ON COLUMN certificates.revoked_at IS 'When the certificate was revoked with the CA. NULL if it was never revoked.';
+COMMENT ON COLUMN certificates.revoked_by IS 'User who requested the revocation.';
+COMMENT ON COLUMN certificates.revocation_reason IS 'RFC 5280 CRLReason code sent with the revocation.';
+COMMENT ON COLUMN events.event_type IS 'Type of event (e.g. created, renewed, failed, revoked).';
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_certificates_renew_at;
+
+ALTER TABLE certificates
+    DROP COLUMN IF EXISTS renewal_window_start,
+    DROP COLUMN IF EXISTS renewal_window_end,
+    DROP COLUMN IF EXISTS renew_at,
+    DROP COLUMN IF EXISTS ari_next_check;
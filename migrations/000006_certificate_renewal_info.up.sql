@@ -0,0 +1,12 @@
+ALTER TABLE certificates
+    ADD COLUMN IF NOT EXISTS renewal_window_start TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS renewal_window_end TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS renew_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS ari_next_check TIMESTAMPTZ;
+
+COMMENT ON COLUMN certificates.renewal_window_start IS 'Start of the renewal window suggested by the CA through ARI (RFC 9773).';
+COMMENT ON COLUMN certificates.renewal_window_end IS 'End of the renewal window suggested by the CA through ARI.';
+COMMENT ON COLUMN certificates.renew_at IS 'When the scheduler renews the certificate: a random point in the ARI window, or a share of the lifetime without ARI.';
+COMMENT ON COLUMN certificates.ari_next_check IS 'Earliest time to query the renewal window again, from the Retry-After header.';
+
+CREATE INDEX IF NOT EXISTS idx_certificates_renew_at ON certificates(renew_at);
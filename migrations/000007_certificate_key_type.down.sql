@@ -0,0 +1,6 @@
+ALTER TABLE certificates
+    DROP COLUMN IF EXISTS key_type;
+
+ALTER TABLE domains
+    DROP COLUMN IF EXISTS key_type,
+    DROP COLUMN IF EXISTS key_reuse;
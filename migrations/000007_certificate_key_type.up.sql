@@ -0,0 +1,10 @@
+ALTER TABLE domains
+    ADD COLUMN IF NOT EXISTS key_type VARCHAR(20),
+    ADD COLUMN IF NOT EXISTS key_reuse BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE certificates
+    ADD COLUMN IF NOT EXISTS key_type VARCHAR(20);
+
+COMMENT ON COLUMN domains.key_type IS 'Key type requested for certificates (rsa2048, rsa3072, rsa4096, ecdsa-p256, ecdsa-p384, ed25519). NULL means ecdsa-p256.';
+COMMENT ON COLUMN domains.key_reuse IS 'Keep the private key on renewal instead of generating a new one.';
+COMMENT ON COLUMN certificates.key_type IS 'Type of the certificate private key.';
@@ -0,0 +1,7 @@
+ALTER TABLE domains
+    DROP COLUMN IF EXISTS csr_pem;
+
+UPDATE certificates SET key_path = '' WHERE key_path IS NULL;
+
+ALTER TABLE certificates
+    ALTER COLUMN key_path SET NOT NULL;
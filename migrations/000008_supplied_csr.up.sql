@@ -0,0 +1,8 @@
+ALTER TABLE certificates
+    ALTER COLUMN key_path DROP NOT NULL;
+
+ALTER TABLE domains
+    ADD COLUMN IF NOT EXISTS csr_pem TEXT;
+
+COMMENT ON COLUMN certificates.key_path IS 'Absolute path to the private key file. NULL when the certificate was issued for a supplied CSR.';
+COMMENT ON COLUMN domains.csr_pem IS 'User-supplied PEM CSR reused for every issuance. NULL when the SSL manager generates the key.';
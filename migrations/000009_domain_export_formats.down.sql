@@ -0,0 +1,3 @@
+ALTER TABLE domains
+    DROP COLUMN IF EXISTS export_formats,
+    DROP COLUMN IF EXISTS export_password;
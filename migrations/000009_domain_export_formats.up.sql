@@ -0,0 +1,6 @@
+ALTER TABLE domains
+    ADD COLUMN IF NOT EXISTS export_formats TEXT,
+    ADD COLUMN IF NOT EXISTS export_password TEXT;
+
+COMMENT ON COLUMN domains.export_formats IS 'Comma separated formats (fullchain, combined, pkcs12, pkcs12-legacy, der) written next to cert.pem on every issuance.';
+COMMENT ON COLUMN domains.export_password IS 'PKCS#12 export password, encrypted with certs.account_key_secret.';
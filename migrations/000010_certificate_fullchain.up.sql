@@ -0,0 +1,5 @@
+ALTER TABLE certificates
+    ADD COLUMN IF NOT EXISTS fullchain_path TEXT;
+
+COMMENT ON COLUMN certificates.chain_path IS 'Intermediates only, without the leaf.';
+COMMENT ON COLUMN certificates.fullchain_path IS 'Leaf followed by the intermediates.';
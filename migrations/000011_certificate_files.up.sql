@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS certificate_files (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    domain_name VARCHAR(255) NOT NULL,
+    version INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,          -- cert.pem | key.pem | chain.pem | fullchain.pem | exports
+    encrypted_data TEXT NOT NULL,
+    live BOOLEAN DEFAULT FALSE NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    UNIQUE (domain_name, version, name)
+);
+
+COMMENT ON TABLE certificate_files IS 'Certificate files of the postgres storage backend, one row per file and version.';
+COMMENT ON COLUMN certificate_files.encrypted_data IS 'File contents, AES-GCM encrypted with certs.account_key_secret and base64 encoded.';
+COMMENT ON COLUMN certificate_files.live IS 'Set on the files of the current version of the domain.';
+
+CREATE INDEX idx_certificate_files_live ON certificate_files(domain_name) WHERE live;
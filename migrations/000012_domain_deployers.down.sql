@@ -0,0 +1,2 @@
+ALTER TABLE domains
+    DROP COLUMN IF EXISTS deployers;
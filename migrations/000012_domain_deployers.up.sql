@@ -0,0 +1,8 @@
+ALTER TABLE domains
+    ADD COLUMN IF NOT EXISTS deployers JSONB;
+
+-- superseded by deployers, domains created through the api never set it
+ALTER TABLE domains
+    ALTER COLUMN nginx_container_name DROP NOT NULL;
+
+COMMENT ON COLUMN domains.deployers IS 'Ordered deploy pipeline run after every issuance. NULL falls back to a docker reload of nginx_container_name and reload_cmd.';
@@ -0,0 +1,7 @@
+ALTER TABLE certificates
+    DROP COLUMN IF EXISTS tls_verification,
+    DROP COLUMN IF EXISTS tls_verification_error,
+    DROP COLUMN IF EXISTS tls_verified_at;
+
+ALTER TABLE domains
+    DROP COLUMN IF EXISTS verify_address;
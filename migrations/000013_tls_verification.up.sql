@@ -0,0 +1,12 @@
+ALTER TABLE domains
+    ADD COLUMN IF NOT EXISTS verify_address TEXT;
+
+ALTER TABLE certificates
+    ADD COLUMN IF NOT EXISTS tls_verification VARCHAR(20),
+    ADD COLUMN IF NOT EXISTS tls_verification_error TEXT,
+    ADD COLUMN IF NOT EXISTS tls_verified_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN domains.verify_address IS 'host:port checked after every deploy for the certificate it serves. NULL skips the check.';
+COMMENT ON COLUMN certificates.tls_verification IS 'Result of the last post-deploy check: ok, mismatch, incomplete_chain or unreachable.';
+COMMENT ON COLUMN certificates.tls_verification_error IS 'Why the last post-deploy check failed.';
+COMMENT ON COLUMN certificates.tls_verified_at IS 'When the served certificate was last checked.';
@@ -0,0 +1,3 @@
+ALTER TABLE domains
+    DROP COLUMN IF EXISTS issue_attempts,
+    DROP COLUMN IF EXISTS next_issue_at;
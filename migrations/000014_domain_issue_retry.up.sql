@@ -0,0 +1,6 @@
+ALTER TABLE domains
+    ADD COLUMN IF NOT EXISTS issue_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS next_issue_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN domains.issue_attempts IS 'Failed attempts at issuing the first certificate of the domain, reset once it is issued.';
+COMMENT ON COLUMN domains.next_issue_at IS 'When the renewal cycle retries a failed first issuance.';
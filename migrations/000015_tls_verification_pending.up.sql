@@ -0,0 +1 @@
+COMMENT ON COLUMN certificates.tls_verification IS 'Result of the last post-deploy check: ok, mismatch, incomplete_chain or unreachable, pending while it runs.';